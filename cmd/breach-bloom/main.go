@@ -0,0 +1,104 @@
+// breach-bloom строит bloom-фильтр утёкших паролей из файла HIBP
+// со строками HASH:COUNT (полный SHA-1 в hex) для проверки паролей без сети.
+package main
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"log"
+	"math"
+	"os"
+	"strings"
+
+	"github.com/Slintox/user-service/internal/password"
+)
+
+var errNoHashes = errors.New("no hashes found")
+
+func main() {
+	var (
+		inputPath         string
+		outputPath        string
+		falsePositiveRate float64
+	)
+	flag.StringVar(&inputPath, "in", "", "path to HIBP SHA-1 file")
+	flag.StringVar(&outputPath, "out", "breached.bloom", "path to the resulting bloom filter")
+	flag.Float64Var(&falsePositiveRate, "fp-rate", 0.001, "target false positive rate")
+	flag.Parse()
+
+	if inputPath == "" {
+		log.Fatal("-in is required")
+	}
+
+	filter, count, err := build(inputPath, falsePositiveRate)
+	if err != nil {
+		log.Fatalf("failed to build filter: %s", err.Error())
+	}
+
+	out, err := os.Create(outputPath)
+	if err != nil {
+		log.Fatalf("failed to create output: %s", err.Error())
+	}
+	defer out.Close()
+
+	w := bufio.NewWriter(out)
+	if _, err = filter.WriteTo(w); err != nil {
+		log.Fatalf("failed to write filter: %s", err.Error())
+	}
+	if err = w.Flush(); err != nil {
+		log.Fatalf("failed to write filter: %s", err.Error())
+	}
+
+	log.Printf("wrote %d hashes into %s", count, outputPath)
+}
+
+// build строит фильтр из хешей файла inputPath и возвращает его вместе с числом хешей
+func build(inputPath string, falsePositiveRate float64) (*password.BloomFilter, int, error) {
+	count, err := forEachHash(inputPath, func([20]byte) {})
+	if err != nil {
+		return nil, 0, err
+	}
+	if count == 0 {
+		return nil, 0, errNoHashes
+	}
+
+	// Оптимальные размер и число хеш-функций для заданной доли ложных срабатываний
+	m := uint64(math.Ceil(-float64(count) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2)))
+	k := uint32(math.Max(1, math.Round(float64(m)/float64(count)*math.Ln2)))
+
+	filter := password.NewBloomFilter(m, k)
+	if _, err = forEachHash(inputPath, filter.AddHash); err != nil {
+		return nil, 0, err
+	}
+
+	return filter, count, nil
+}
+
+func forEachHash(path string, fn func([20]byte)) (int, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var count int
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		hashHex, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if len(hashHex) != 40 {
+			continue
+		}
+
+		var hash [20]byte
+		if _, err = hex.Decode(hash[:], []byte(hashHex)); err != nil {
+			continue
+		}
+
+		fn(hash)
+		count++
+	}
+
+	return count, scanner.Err()
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Slintox/user-service/internal/password"
+)
+
+// writeFilter строит фильтр из паролей breached так же, как утилита, и сохраняет его в файл
+func writeFilter(t *testing.T, breached ...string) string {
+	t.Helper()
+
+	dir := t.TempDir()
+
+	var hibp strings.Builder
+	for _, p := range breached {
+		hash := password.Sum(p)
+		hibp.WriteString(strings.ToUpper(hex.EncodeToString(hash[:])) + ":42\n")
+	}
+	inputPath := filepath.Join(dir, "hibp.txt")
+	if err := os.WriteFile(inputPath, []byte(hibp.String()), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	filter, count, err := build(inputPath, 0.001)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != len(breached) {
+		t.Fatalf("count = %d, want %d", count, len(breached))
+	}
+
+	var buf bytes.Buffer
+	if _, err = filter.WriteTo(&buf); err != nil {
+		t.Fatal(err)
+	}
+
+	outputPath := filepath.Join(dir, "breached.bloom")
+	if err = os.WriteFile(outputPath, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	return outputPath
+}
+
+func TestFilterLoadsIntoBreachChecker(t *testing.T) {
+	path := writeFilter(t, "password1", "qwerty123", "correct horse")
+
+	checker, err := password.LoadBreachChecker(path)
+	if err != nil {
+		t.Fatalf("LoadBreachChecker() err = %v", err)
+	}
+
+	tests := map[string]bool{
+		"password1":                    true,
+		"qwerty123":                    true,
+		"correct horse":                true,
+		"Tr0ub4dor&3-not-in-the-list":  false,
+		"another clean passphrase 417": false,
+	}
+
+	for p, want := range tests {
+		breached, err := checker.IsBreached(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if breached != want {
+			t.Fatalf("IsBreached(%q) = %v, want %v", p, breached, want)
+		}
+	}
+}
+
+func TestCorruptFilterIsRejected(t *testing.T) {
+	src, err := os.ReadFile(writeFilter(t, "password1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header := len(password.BloomMagic) + 4 + 8
+	zeroK := append([]byte(nil), src...)
+	copy(zeroK[len(password.BloomMagic):], []byte{0, 0, 0, 0})
+
+	tests := map[string][]byte{
+		"truncated header": src[:header-1],
+		"truncated bits":   src[:header+1],
+		"zero hash count":  zeroK,
+		"garbage":          []byte("not a filter\n"),
+	}
+
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "breached.bloom")
+			if err := os.WriteFile(path, content, 0o600); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, err := password.LoadBreachChecker(path); err == nil {
+				t.Fatal("expected load error")
+			}
+		})
+	}
+}
+
+func TestBuildWithoutHashes(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hibp.txt")
+	if err := os.WriteFile(path, []byte("not a hash\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := build(path, 0.001); err != errNoHashes {
+		t.Fatalf("build() err = %v, want %v", err, errNoHashes)
+	}
+}
@@ -0,0 +1,66 @@
+// canonicalize-usernames пересчитывает username_canonical всех пользователей
+// через normalize.Username. Миграция 20261019092000 заполнила столбец приближением
+// средствами Postgres (lower + NFKC), которое расходится с case folding для части
+// символов, например "ß". Запускается один раз после миграций; повторный запуск
+// ничего не меняет.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"log"
+
+	"github.com/Slintox/user-service/config"
+	repo "github.com/Slintox/user-service/internal/repository"
+	organizationRepo "github.com/Slintox/user-service/internal/repository/organization"
+	uRepo "github.com/Slintox/user-service/internal/repository/user"
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/pkg/database/postgres"
+)
+
+func main() {
+	var configPath string
+	flag.StringVar(&configPath, "config-path", "", "")
+	flag.Parse()
+
+	ctx := context.Background()
+
+	cfg, err := config.InitConfig(configPath)
+	if err != nil {
+		log.Fatalf("failed to get config: %s", err.Error())
+	}
+
+	pgPool, err := postgres.Connect(ctx, cfg.Postgres, repo.SetTenant)
+	if err != nil {
+		log.Fatalf("failed to get postgres connect: %s", err.Error())
+	}
+	defer pgPool.Close()
+
+	organizations, err := organizationRepo.NewRepository(pgPool).List(ctx)
+	if err != nil {
+		log.Fatalf("failed to list organizations: %s", err.Error())
+	}
+
+	users := uRepo.NewRepository(pgPool, cfg.Password.HistoryDepth)
+
+	failed := false
+	for _, organization := range organizations {
+		updated, err := users.CanonicalizeUsernames(tenant.NewContext(ctx, organization.ID))
+		if err != nil {
+			failed = true
+			if errors.Is(err, repo.ErrUsernameTaken) {
+				log.Printf("organization %s: usernames collide after normalization, rename them and run again", organization.Name)
+				continue
+			}
+			log.Printf("organization %s: %s", organization.Name, err.Error())
+			continue
+		}
+
+		log.Printf("organization %s: updated %d usernames", organization.Name, updated)
+	}
+
+	if failed {
+		log.Fatal("some organizations were not canonicalized")
+	}
+}
@@ -1,6 +1,10 @@
 package config
 
-import "github.com/ilyakaznacheev/cleanenv"
+import (
+	"time"
+
+	"github.com/ilyakaznacheev/cleanenv"
+)
 
 // Костыль
 const (
@@ -9,8 +13,32 @@ const (
 
 type (
 	Config struct {
-		GRPC     *GRPCServerConfig
-		Postgres *PostgresConfig
+		App         *AppConfig
+		GRPC        *GRPCServerConfig
+		Postgres    *PostgresConfig
+		Idempotency *IdempotencyConfig
+		Password    *PasswordPolicyConfig
+		Hash        *PasswordHashConfig
+		Login       *LoginThrottleConfig
+		Breach      *BreachedPasswordsConfig
+		Metrics     *MetricsConfig
+		Session     *SessionConfig
+		Reset       *PasswordResetConfig
+		Signing     *TokenSigningConfig
+		Verify      *EmailVerificationConfig
+		EmailChange *EmailChangeConfig
+		Mfa         *MfaConfig
+		WebAuthn    *WebAuthnConfig
+		ApiKey      *ApiKeyConfig
+		Policy      *PolicyConfig
+		SMTP        *SMTPConfig
+	}
+
+	// AppConfig описывает режим запуска. Только в режиме разработки допускаются
+	// упрощения, небезопасные в продакшене, например уведомления в лог вместо почты
+	// или случайный ключ подписи токенов
+	AppConfig struct {
+		Dev bool `yaml:"dev" env:"DEV" env-default:"false"`
 	}
 
 	GRPCServerConfig struct {
@@ -18,39 +46,205 @@ type (
 	}
 
 	PostgresConfig struct {
-		DSN string `yaml:"postgres_dsn" env:"PG_DSN" env-default:"host=localhost port=54322 dbname=user user=user-user password=user-password sslmode=disable"`
+		DSN string `yaml:"postgres_dsn" env:"PG_DSN" env-default:"host=localhost port=54322 dbname=user user=user-app password=app-password sslmode=disable"`
+	}
+
+	// IdempotencyConfig описывает хранение результатов запросов с ключом идемпотентности
+	IdempotencyConfig struct {
+		TTL time.Duration `yaml:"idempotency_ttl" env:"IDEMPOTENCY_TTL" env-default:"24h"`
+	}
+
+	// PasswordPolicyConfig описывает требования к паролям пользователей.
+	// MaxLength ограничен длиной в байтах, которую учитывает алгоритм хеширования (bcrypt - 72 байта)
+	PasswordPolicyConfig struct {
+		MinLength        int  `yaml:"password_min_length" env:"PASSWORD_MIN_LENGTH" env-default:"8"`
+		MaxLength        int  `yaml:"password_max_length" env:"PASSWORD_MAX_LENGTH" env-default:"72"`
+		RequireLowercase bool `yaml:"password_require_lowercase" env:"PASSWORD_REQUIRE_LOWERCASE" env-default:"true"`
+		RequireUppercase bool `yaml:"password_require_uppercase" env:"PASSWORD_REQUIRE_UPPERCASE" env-default:"true"`
+		RequireDigit     bool `yaml:"password_require_digit" env:"PASSWORD_REQUIRE_DIGIT" env-default:"true"`
+		RequireSymbol    bool `yaml:"password_require_symbol" env:"PASSWORD_REQUIRE_SYMBOL" env-default:"false"`
+		DisallowUsername bool `yaml:"password_disallow_username" env:"PASSWORD_DISALLOW_USERNAME" env-default:"true"`
+		DisallowEmail    bool `yaml:"password_disallow_email" env:"PASSWORD_DISALLOW_EMAIL" env-default:"true"`
+		// Сколько предыдущих паролей нельзя использовать повторно. Текущий пароль запрещён всегда
+		HistoryDepth int `yaml:"password_history_depth" env:"PASSWORD_HISTORY_DEPTH" env-default:"5"`
+	}
+
+	// PasswordHashConfig описывает текущий алгоритм хеширования паролей.
+	// Хеши, полученные другим алгоритмом или с другими параметрами,
+	// пересчитываются при успешном входе пользователя
+	PasswordHashConfig struct {
+		Algorithm     string `yaml:"password_hash_algorithm" env:"PASSWORD_HASH_ALGORITHM" env-default:"bcrypt"`
+		BcryptCost    int    `yaml:"password_bcrypt_cost" env:"PASSWORD_BCRYPT_COST" env-default:"10"`
+		Argon2Time    uint32 `yaml:"password_argon2_time" env:"PASSWORD_ARGON2_TIME" env-default:"3"`
+		Argon2Memory  uint32 `yaml:"password_argon2_memory" env:"PASSWORD_ARGON2_MEMORY" env-default:"65536"`
+		Argon2Threads uint8  `yaml:"password_argon2_threads" env:"PASSWORD_ARGON2_THREADS" env-default:"2"`
+		Argon2KeyLen  uint32 `yaml:"password_argon2_key_len" env:"PASSWORD_ARGON2_KEY_LEN" env-default:"32"`
+		Argon2SaltLen uint32 `yaml:"password_argon2_salt_len" env:"PASSWORD_ARGON2_SALT_LEN" env-default:"16"`
+	}
+
+	// LoginThrottleConfig описывает задержки и блокировки после неудачных попыток входа.
+	// Первые FreeAttempts неудач не ограничиваются, дальше задержка растёт вдвое
+	// с каждой неудачей начиная с BaseDelay, но не больше MaxDelay.
+	// После LockThreshold неудач учётная запись (или IP-адрес после IPLockThreshold)
+	// блокируется на LockDuration. Счётчик сбрасывается, если неудач не было дольше FailureWindow
+	LoginThrottleConfig struct {
+		FreeAttempts      int           `yaml:"login_free_attempts" env:"LOGIN_FREE_ATTEMPTS" env-default:"3"`
+		BaseDelay         time.Duration `yaml:"login_base_delay" env:"LOGIN_BASE_DELAY" env-default:"1s"`
+		MaxDelay          time.Duration `yaml:"login_max_delay" env:"LOGIN_MAX_DELAY" env-default:"5m"`
+		LockThreshold     int           `yaml:"login_lock_threshold" env:"LOGIN_LOCK_THRESHOLD" env-default:"10"`
+		IPLockThreshold   int           `yaml:"login_ip_lock_threshold" env:"LOGIN_IP_LOCK_THRESHOLD" env-default:"100"`
+		LockDuration      time.Duration `yaml:"login_lock_duration" env:"LOGIN_LOCK_DURATION" env-default:"30m"`
+		FailureWindow     time.Duration `yaml:"login_failure_window" env:"LOGIN_FAILURE_WINDOW" env-default:"1h"`
+		TrustForwardedFor bool          `yaml:"login_trust_forwarded_for" env:"LOGIN_TRUST_FORWARDED_FOR" env-default:"false"`
+	}
+
+	// BreachedPasswordsConfig указывает на локальную базу утёкших паролей:
+	// каталог диапазонов HIBP, файл SHA-1 хешей или bloom-фильтр.
+	// Пустой путь отключает проверку
+	BreachedPasswordsConfig struct {
+		Path string `yaml:"breached_passwords_path" env:"BREACHED_PASSWORDS_PATH"`
+	}
+
+	MetricsConfig struct {
+		Port string `yaml:"metrics_port" env:"METRICS_PORT" env-default:":9090"`
+	}
+
+	// SessionConfig описывает сессии, выдаваемые при входе
+	SessionConfig struct {
+		TTL time.Duration `yaml:"session_ttl" env:"SESSION_TTL" env-default:"24h"`
+	}
+
+	// PasswordResetConfig описывает одноразовые токены сброса пароля
+	PasswordResetConfig struct {
+		TokenTTL time.Duration `yaml:"password_reset_token_ttl" env:"PASSWORD_RESET_TOKEN_TTL" env-default:"1h"`
+	}
+
+	// TokenSigningConfig описывает ключ подписи токенов, которые не хранятся в базе.
+	// Ключ обязателен вне режима разработки. В нём пустой ключ заменяется случайным
+	// при запуске, тогда выданные токены перестают действовать после перезапуска
+	// и не принимаются другими репликами
+	TokenSigningConfig struct {
+		Secret string `yaml:"token_signing_secret" env:"TOKEN_SIGNING_SECRET"`
+	}
+
+	// EmailVerificationConfig описывает подтверждение email. Повторно письмо
+	// отправляется не чаще ResendInterval и не больше ResendLimit раз за ResendWindow
+	EmailVerificationConfig struct {
+		TokenTTL       time.Duration `yaml:"email_verification_token_ttl" env:"EMAIL_VERIFICATION_TOKEN_TTL" env-default:"48h"`
+		ResendInterval time.Duration `yaml:"email_verification_resend_interval" env:"EMAIL_VERIFICATION_RESEND_INTERVAL" env-default:"1m"`
+		ResendLimit    int           `yaml:"email_verification_resend_limit" env:"EMAIL_VERIFICATION_RESEND_LIMIT" env-default:"5"`
+		ResendWindow   time.Duration `yaml:"email_verification_resend_window" env:"EMAIL_VERIFICATION_RESEND_WINDOW" env-default:"24h"`
+	}
+
+	// EmailChangeConfig описывает смену email. Новый адрес нужно подтвердить за TokenTTL,
+	// прежний адрес может отменить смену до подтверждения и ещё CancelGracePeriod после него
+	EmailChangeConfig struct {
+		TokenTTL          time.Duration `yaml:"email_change_token_ttl" env:"EMAIL_CHANGE_TOKEN_TTL" env-default:"24h"`
+		CancelGracePeriod time.Duration `yaml:"email_change_cancel_grace_period" env:"EMAIL_CHANGE_CANCEL_GRACE_PERIOD" env-default:"72h"`
+	}
+
+	// MfaConfig описывает второй фактор (TOTP). Skew - сколько соседних 30-секундных
+	// шагов принимается в каждую сторону, чтобы учесть расхождение часов
+	MfaConfig struct {
+		Issuer        string `yaml:"mfa_issuer" env:"MFA_ISSUER" env-default:"user-service"`
+		Skew          int    `yaml:"mfa_skew" env:"MFA_SKEW" env-default:"1"`
+		RecoveryCodes int    `yaml:"mfa_recovery_codes" env:"MFA_RECOVERY_CODES" env-default:"10"`
+	}
+
+	// WebAuthnConfig описывает проверяющую сторону для входа по ключам доступа.
+	// RPID - домен сайта, Origins - адреса страниц, с которых разрешены церемонии
+	WebAuthnConfig struct {
+		RPID                    string        `yaml:"webauthn_rp_id" env:"WEBAUTHN_RP_ID" env-default:"localhost"`
+		RPName                  string        `yaml:"webauthn_rp_name" env:"WEBAUTHN_RP_NAME" env-default:"user-service"`
+		Origins                 []string      `yaml:"webauthn_origins" env:"WEBAUTHN_ORIGINS" env-separator:"," env-default:"http://localhost"`
+		RequireUserVerification bool          `yaml:"webauthn_require_user_verification" env:"WEBAUTHN_REQUIRE_USER_VERIFICATION" env-default:"true"`
+		ChallengeTTL            time.Duration `yaml:"webauthn_challenge_ttl" env:"WEBAUTHN_CHALLENGE_TTL" env-default:"5m"`
+	}
+
+	// ApiKeyConfig ограничивает число действующих API-ключей одного пользователя
+	ApiKeyConfig struct {
+		MaxPerUser int `yaml:"api_key_max_per_user" env:"API_KEY_MAX_PER_USER" env-default:"20"`
+	}
+
+	// PolicyConfig указывает файлы политик доступа на CEL. Изменённые файлы
+	// перечитываются без перезапуска, проверка изменений - раз в ReloadInterval.
+	// Пустой список отключает политики, остаются только проверки разрешений
+	PolicyConfig struct {
+		Paths          []string      `yaml:"policy_paths" env:"POLICY_PATHS" env-separator:","`
+		ReloadInterval time.Duration `yaml:"policy_reload_interval" env:"POLICY_RELOAD_INTERVAL" env-default:"10s"`
+	}
+
+	// SMTPConfig описывает доставку уведомлений по почте. Если Host не указан,
+	// уведомления пишутся в лог, что допускается только в режиме разработки
+	SMTPConfig struct {
+		Host     string        `yaml:"smtp_host" env:"SMTP_HOST"`
+		Port     int           `yaml:"smtp_port" env:"SMTP_PORT" env-default:"587"`
+		Username string        `yaml:"smtp_username" env:"SMTP_USERNAME"`
+		Password string        `yaml:"smtp_password" env:"SMTP_PASSWORD"`
+		From     string        `yaml:"smtp_from" env:"SMTP_FROM" env-default:"no-reply@localhost"`
+		Timeout  time.Duration `yaml:"smtp_timeout" env:"SMTP_TIMEOUT" env-default:"30s"`
 	}
 )
 
 func InitConfig(configPath string) (*Config, error) {
-	var err error
 	cfg := Config{
-		GRPC:     &GRPCServerConfig{},
-		Postgres: &PostgresConfig{},
+		App:         &AppConfig{},
+		GRPC:        &GRPCServerConfig{},
+		Postgres:    &PostgresConfig{},
+		Idempotency: &IdempotencyConfig{},
+		Password:    &PasswordPolicyConfig{},
+		Hash:        &PasswordHashConfig{},
+		Login:       &LoginThrottleConfig{},
+		Breach:      &BreachedPasswordsConfig{},
+		Metrics:     &MetricsConfig{},
+		Session:     &SessionConfig{},
+		Reset:       &PasswordResetConfig{},
+		Signing:     &TokenSigningConfig{},
+		Verify:      &EmailVerificationConfig{},
+		EmailChange: &EmailChangeConfig{},
+		Mfa:         &MfaConfig{},
+		WebAuthn:    &WebAuthnConfig{},
+		ApiKey:      &ApiKeyConfig{},
+		Policy:      &PolicyConfig{},
+		SMTP:        &SMTPConfig{},
 	}
 
-	// Игнорируем файлы конфигураций, если путь к файлу не указан.
-	// Если путь указан, но не валиден, возвращается ошибка
-	if configPath != "" {
-		err = cleanenv.ReadConfig(configPath, cfg.GRPC)
-		if err != nil {
-			return nil, err
+	sections := []interface{}{
+		cfg.App,
+		cfg.GRPC,
+		cfg.Postgres,
+		cfg.Idempotency,
+		cfg.Password,
+		cfg.Hash,
+		cfg.Login,
+		cfg.Breach,
+		cfg.Metrics,
+		cfg.Session,
+		cfg.Reset,
+		cfg.Signing,
+		cfg.Verify,
+		cfg.EmailChange,
+		cfg.Mfa,
+		cfg.WebAuthn,
+		cfg.ApiKey,
+		cfg.Policy,
+		cfg.SMTP,
+	}
+
+	for _, section := range sections {
+		// Игнорируем файлы конфигураций, если путь к файлу не указан.
+		// Если путь указан, но не валиден, возвращается ошибка
+		if configPath != "" {
+			if err := cleanenv.ReadConfig(configPath, section); err != nil {
+				return nil, err
+			}
 		}
 
-		if err = cleanenv.ReadConfig(configPath, cfg.Postgres); err != nil {
+		// Чтение конфигов из переменных окружения
+		if err := cleanenv.ReadEnv(section); err != nil {
 			return nil, err
 		}
 	}
 
-	// Чтение конфигов из переменных окружения
-
-	if err = cleanenv.ReadEnv(cfg.GRPC); err != nil {
-		return nil, err
-	}
-
-	if err = cleanenv.ReadEnv(cfg.Postgres); err != nil {
-		return nil, err
-	}
-
 	return &cfg, nil
 }
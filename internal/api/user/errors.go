@@ -1,7 +1,18 @@
 package user
 
-import "errors"
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
 
 var (
-	errNoDataToUpdate = errors.New("Нет полей для обновления")
+	errNoDataToUpdate = status.Error(codes.InvalidArgument, "Нет полей для обновления")
+	errNoPolicy       = status.Error(codes.InvalidArgument, "Политика не указана")
+
+	errUnauthenticated  = status.Error(codes.Unauthenticated, "Требуется вход")
+	errPermissionDenied = status.Error(codes.PermissionDenied, "Недостаточно прав для выполнения действия")
+	errScopeNotAllowed  = status.Error(codes.PermissionDenied, "Области действия API-ключа недостаточно для выполнения действия")
+	errSessionRequired  = status.Error(codes.PermissionDenied, "Действие доступно только после входа, а не по API-ключу")
+
+	errMfaEnrollmentRequired = status.Error(codes.PermissionDenied, "Роль требует второй фактор: подключите его, чтобы продолжить")
 )
@@ -0,0 +1,266 @@
+package user
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	"github.com/Slintox/user-service/internal/policy"
+	desc "github.com/Slintox/user-service/pkg/user_v1"
+)
+
+// Кто может вызывать метод
+type access int
+
+const (
+	// accessGranted - только роли с разрешением метода
+	accessGranted access = iota
+	// accessSelf - пользователь над своей учётной записью и роли с разрешением метода
+	accessSelf
+	// accessPublic - без аутентификации
+	accessPublic
+)
+
+type methodPolicy struct {
+	access access
+	// Разрешение, дающее доступ к методу для любой учётной записи
+	permission string
+	// Метод изменяет данные, API-ключу нужна область write, иначе read
+	write bool
+	// Метод меняет пароль или второй фактор и недоступен по API-ключу
+	// с любыми областями: украденный ключ не должен давать захватить учётную запись
+	session bool
+	// Метод меняет данные всех организаций и доступен только
+	// вызывающим из организации по умолчанию
+	global bool
+	// Метод доступен сессии, которой роль предписывает сначала подключить второй фактор
+	enrollment bool
+}
+
+// Методы, которых нет в списке, запрещены
+var methodPolicies = map[string]methodPolicy{
+	"Create":                     {access: accessPublic, write: true},
+	"Get":                        {access: accessSelf, permission: model.PermissionReadUsers},
+	"Update":                     {access: accessSelf, permission: model.PermissionUpdateUsers, write: true},
+	"Delete":                     {access: accessGranted, permission: model.PermissionDeleteUsers, write: true},
+	"GetPasswordPolicy":          {access: accessPublic},
+	"Login":                      {access: accessPublic, write: true},
+	"GetPasswordHashStats":       {access: accessGranted, permission: model.PermissionReadPasswordHashStats},
+	"UnlockUser":                 {access: accessGranted, permission: model.PermissionUnlockUsers, write: true},
+	"RequestPasswordReset":       {access: accessPublic, write: true},
+	"ResetPassword":              {access: accessPublic, write: true},
+	"ChangePassword":             {access: accessSelf, permission: model.PermissionChangePassword, write: true, session: true},
+	"VerifyEmail":                {access: accessPublic, write: true},
+	"ResendVerificationEmail":    {access: accessSelf, permission: model.PermissionResendVerification, write: true},
+	"ConfirmEmailChange":         {access: accessPublic, write: true},
+	"CancelEmailChange":          {access: accessPublic, write: true},
+	"EnrollMfa":                  {access: accessSelf, permission: model.PermissionManageMfa, write: true, session: true, enrollment: true},
+	"ConfirmMfa":                 {access: accessSelf, permission: model.PermissionManageMfa, write: true, session: true, enrollment: true},
+	"DisableMfa":                 {access: accessSelf, permission: model.PermissionManageMfa, write: true, session: true},
+	"GetMfaPolicy":               {access: accessGranted, permission: model.PermissionReadMfaPolicy},
+	"SetMfaPolicy":               {access: accessGranted, permission: model.PermissionUpdateMfaPolicy, write: true, global: true},
+	"BeginWebAuthnRegistration":  {access: accessSelf, permission: model.PermissionManageWebAuthn, write: true, session: true},
+	"FinishWebAuthnRegistration": {access: accessSelf, permission: model.PermissionManageWebAuthn, write: true, session: true},
+	"BeginWebAuthnLogin":         {access: accessPublic, write: true},
+	"FinishWebAuthnLogin":        {access: accessPublic, write: true},
+	"ListWebAuthnCredentials":    {access: accessSelf, permission: model.PermissionReadWebAuthn},
+	"DeleteWebAuthnCredential":   {access: accessSelf, permission: model.PermissionManageWebAuthn, write: true, session: true},
+	"CreateApiKey":               {access: accessSelf, permission: model.PermissionManageApiKeys, write: true},
+	"ListApiKeys":                {access: accessSelf, permission: model.PermissionReadApiKeys},
+	"RevokeApiKey":               {access: accessSelf, permission: model.PermissionManageApiKeys, write: true},
+	"CreateRole":                 {access: accessGranted, permission: model.PermissionManageRoles, write: true, global: true},
+	"RenameRole":                 {access: accessGranted, permission: model.PermissionManageRoles, write: true, global: true},
+	"ListRoles":                  {access: accessGranted, permission: model.PermissionReadRoles},
+	"DeleteRole":                 {access: accessGranted, permission: model.PermissionManageRoles, write: true, global: true},
+	"ListPermissions":            {access: accessGranted, permission: model.PermissionReadPermissions},
+	"GrantPermission":            {access: accessGranted, permission: model.PermissionManagePermissions, write: true, global: true},
+	"RevokePermission":           {access: accessGranted, permission: model.PermissionManagePermissions, write: true, global: true},
+	"CheckPermission":            {access: accessSelf, permission: model.PermissionReadPermissions},
+	"AssignRole":                 {access: accessGranted, permission: model.PermissionAssignRoles, write: true},
+	"UnassignRole":               {access: accessGranted, permission: model.PermissionAssignRoles, write: true},
+	"CreateOrganization":         {access: accessGranted, permission: model.PermissionManageOrganizations, write: true, global: true},
+	"ListOrganizations":          {access: accessGranted, permission: model.PermissionManageOrganizations, global: true},
+	"CreateGroup":                {access: accessGranted, permission: model.PermissionManageGroups, write: true},
+	"GetGroup":                   {access: accessGranted, permission: model.PermissionReadGroups},
+	"ListGroups":                 {access: accessGranted, permission: model.PermissionReadGroups},
+	"RenameGroup":                {access: accessGranted, permission: model.PermissionManageGroups, write: true},
+	"DeleteGroup":                {access: accessGranted, permission: model.PermissionManageGroups, write: true},
+	"AddGroupMember":             {access: accessGranted, permission: model.PermissionManageGroups, write: true},
+	"RemoveGroupMember":          {access: accessGranted, permission: model.PermissionManageGroups, write: true},
+	"ListGroupMembers":           {access: accessGranted, permission: model.PermissionReadGroups},
+	"ListUserGroups":             {access: accessSelf, permission: model.PermissionReadGroups},
+	"AssignGroupRole":            {access: accessGranted, permission: model.PermissionAssignRoles, write: true},
+	"UnassignGroupRole":          {access: accessGranted, permission: model.PermissionAssignRoles, write: true},
+	"DryRunPolicy":               {access: accessGranted, permission: model.PermissionDryRunPolicies, global: true},
+}
+
+// TargetLoader находит пользователя, к которому относится запрос,
+// для проверки правилами политик
+type TargetLoader interface {
+	Get(ctx context.Context, username string) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
+}
+
+// Policy проверяет права вызывающего на методы UserV1: по разрешениям ролей
+// из methodPolicies и правилами политик на CEL. Запрещающее правило
+// отменяет доступ по разрешению, разрешающее даёт доступ без разрешения
+type Policy struct {
+	methods   map[string]methodPolicy
+	evaluator *policy.Evaluator
+	targets   TargetLoader
+}
+
+// NewPolicy создаёт политику UserV1. Методы других сервисов из public
+// (например, рефлексии) доступны без аутентификации
+func NewPolicy(evaluator *policy.Evaluator, targets TargetLoader, public ...string) *Policy {
+	methods := make(map[string]methodPolicy, len(methodPolicies)+len(public))
+	for name, policy := range methodPolicies {
+		methods["/"+desc.UserV1_ServiceDesc.ServiceName+"/"+name] = policy
+	}
+	for _, fullMethod := range public {
+		methods[fullMethod] = methodPolicy{access: accessPublic}
+	}
+
+	return &Policy{
+		methods:   methods,
+		evaluator: evaluator,
+		targets:   targets,
+	}
+}
+
+func (p *Policy) Authorize(ctx context.Context, fullMethod string, req interface{}) error {
+	policy, ok := p.methods[fullMethod]
+	if !ok {
+		return errPermissionDenied
+	}
+
+	if policy.access == accessPublic {
+		return nil
+	}
+
+	principal := auth.FromContext(ctx)
+	if principal == nil {
+		return errUnauthenticated
+	}
+
+	if principal.MfaEnrollmentRequired && !policy.enrollment {
+		return errMfaEnrollmentRequired
+	}
+
+	scope := model.ApiKeyScopeRead
+	if policy.write {
+		scope = model.ApiKeyScopeWrite
+	}
+	if !principal.HasScope(scope) {
+		return errScopeNotAllowed
+	}
+
+	if policy.session && principal.ApiKey {
+		return errSessionRequired
+	}
+
+	if policy.global && !principal.InDefaultOrganization() {
+		return errPermissionDenied
+	}
+
+	effect, err := p.evaluate(ctx, fullMethod, principal, req)
+	if err != nil {
+		return err
+	}
+	if effect == model.PolicyEffectDeny {
+		return errPermissionDenied
+	}
+
+	if principal.Can(policy.permission) {
+		return nil
+	}
+
+	if policy.access == accessSelf && isSelf(principal, req) {
+		return nil
+	}
+
+	if effect == model.PolicyEffectAllow {
+		return nil
+	}
+
+	return errPermissionDenied
+}
+
+// evaluate проверяет запрос правилами политик. Пользователь, к которому
+// относится запрос, загружается, только если для метода есть правила
+func (p *Policy) evaluate(ctx context.Context, fullMethod string, principal *auth.Principal, req interface{}) (string, error) {
+	method := strings.TrimPrefix(fullMethod, "/"+desc.UserV1_ServiceDesc.ServiceName+"/")
+
+	rules := p.evaluator.Rules()
+	if !rules.Applies(method) {
+		return "", nil
+	}
+
+	target, err := p.target(ctx, req)
+	if err != nil {
+		return "", err
+	}
+
+	result := rules.Evaluate(&policy.Input{
+		Principal: principal,
+		Method:    method,
+		Target:    target,
+	})
+
+	return result.Effect, nil
+}
+
+// target возвращает пользователя, к которому относится запрос, или nil,
+// если запрос не относится к пользователю или такого пользователя нет
+func (p *Policy) target(ctx context.Context, req interface{}) (*model.User, error) {
+	var user *model.User
+	var err error
+
+	switch r := req.(type) {
+	case *desc.GetRequest:
+		if email, ok := r.GetKey().(*desc.GetRequest_Email); ok {
+			user, err = p.targets.GetByEmail(ctx, email.Email)
+		} else {
+			user, err = p.targets.Get(ctx, r.GetUsername())
+		}
+	case *desc.CheckPermissionRequest:
+		user, err = p.targets.Get(ctx, r.GetSubject())
+	case interface{ GetUsername() string }:
+		if r.GetUsername() == "" {
+			return nil, nil
+		}
+		user, err = p.targets.Get(ctx, r.GetUsername())
+	default:
+		return nil, nil
+	}
+
+	if status.Code(err) == codes.NotFound {
+		return nil, nil
+	}
+
+	return user, err
+}
+
+// isSelf сообщает, что запрос относится к учётной записи вызывающего
+func isSelf(principal *auth.Principal, req interface{}) bool {
+	switch r := req.(type) {
+	case *desc.GetRequest:
+		if email, ok := r.GetKey().(*desc.GetRequest_Email); ok {
+			return normalize.Email(email.Email) == normalize.Email(principal.Email)
+		}
+	case *desc.CheckPermissionRequest:
+		return normalize.Username(r.GetSubject()) == normalize.Username(principal.Username)
+	}
+
+	r, ok := req.(interface{ GetUsername() string })
+	if !ok {
+		return false
+	}
+
+	return normalize.Username(r.GetUsername()) == normalize.Username(principal.Username)
+}
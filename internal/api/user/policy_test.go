@@ -0,0 +1,240 @@
+package user
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/policy"
+	desc "github.com/Slintox/user-service/pkg/user_v1"
+)
+
+type memTargetLoader map[string]*model.User
+
+func (m memTargetLoader) Get(_ context.Context, username string) (*model.User, error) {
+	if user, ok := m[username]; ok {
+		return user, nil
+	}
+	return nil, status.Error(codes.NotFound, "not found")
+}
+
+func (m memTargetLoader) GetByEmail(_ context.Context, email string) (*model.User, error) {
+	for _, user := range m {
+		if user.Email == email {
+			return user, nil
+		}
+	}
+	return nil, status.Error(codes.NotFound, "not found")
+}
+
+// newTestPolicy создаёт политику UserV1 с правилами из src или без правил
+func newTestPolicy(t *testing.T, src string) *Policy {
+	t.Helper()
+
+	cfg := &config.PolicyConfig{}
+	if src != "" {
+		path := filepath.Join(t.TempDir(), "policy.yaml")
+		if err := os.WriteFile(path, []byte(src), 0o600); err != nil {
+			t.Fatal(err)
+		}
+		cfg.Paths = []string{path}
+	}
+
+	evaluator, err := policy.NewEvaluator(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return NewPolicy(evaluator, memTargetLoader{
+		"alice": {Username: "alice", Email: "alice@example.com"},
+		"bob":   {Username: "bob", Email: "bob@example.com"},
+		"root":  {Username: "root", Email: "root@example.com", Roles: []model.Role{{Name: "admin"}}},
+	})
+}
+
+func method(name string) string {
+	return "/" + desc.UserV1_ServiceDesc.ServiceName + "/" + name
+}
+
+func TestAuthorize(t *testing.T) {
+	p := newTestPolicy(t, "")
+
+	alice := &auth.Principal{OrganizationID: model.DefaultOrganizationID, Username: "alice", Email: "alice@example.com"}
+	admin := &auth.Principal{
+		OrganizationID: model.DefaultOrganizationID,
+		Username:       "root",
+		Permissions: map[string]bool{
+			model.PermissionReadUsers:           true,
+			model.PermissionDeleteUsers:         true,
+			model.PermissionChangePassword:      true,
+			model.PermissionManageOrganizations: true,
+		},
+	}
+	tenantAdmin := &auth.Principal{
+		OrganizationID: model.DefaultOrganizationID + 1,
+		Username:       "root",
+		Permissions:    admin.Permissions,
+	}
+	readKey := &auth.Principal{
+		OrganizationID: model.DefaultOrganizationID,
+		Username:       "alice",
+		ApiKey:         true,
+		Scopes:         []string{model.ApiKeyScopeRead},
+	}
+	fullKey := &auth.Principal{
+		OrganizationID: model.DefaultOrganizationID,
+		Username:       "alice",
+		ApiKey:         true,
+		Scopes:         []string{model.ApiKeyScopeAll},
+	}
+
+	// Роль требует второй фактор, а он не подключён
+	restricted := &auth.Principal{
+		OrganizationID:        model.DefaultOrganizationID,
+		Username:              "root",
+		Permissions:           admin.Permissions,
+		MfaEnrollmentRequired: true,
+	}
+
+	getByUsername := func(username string) *desc.GetRequest {
+		return &desc.GetRequest{Key: &desc.GetRequest_Username{Username: username}}
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		method    string
+		req       interface{}
+		want      error
+	}{
+		{name: "public method", method: "Login", req: &desc.LoginRequest{}},
+		{name: "unknown method", principal: admin, method: "Unknown", want: errPermissionDenied},
+		{name: "unauthenticated", method: "Get", req: getByUsername("alice"), want: errUnauthenticated},
+
+		{name: "self", principal: alice, method: "Get", req: getByUsername("alice")},
+		{name: "self by email", principal: alice, method: "Get", req: &desc.GetRequest{Key: &desc.GetRequest_Email{Email: "Alice@Example.com"}}},
+		{name: "self case insensitive", principal: alice, method: "Update", req: &desc.UpdateRequest{Username: "ALICE"}},
+		{name: "other user", principal: alice, method: "Get", req: getByUsername("bob"), want: errPermissionDenied},
+		{name: "self only with permission", principal: alice, method: "Delete", req: &desc.DeleteRequest{Username: "alice"}, want: errPermissionDenied},
+
+		{name: "admin", principal: admin, method: "Get", req: getByUsername("bob")},
+		{name: "admin delete", principal: admin, method: "Delete", req: &desc.DeleteRequest{Username: "bob"}},
+		{name: "admin without permission", principal: admin, method: "Update", req: &desc.UpdateRequest{Username: "bob"}, want: errPermissionDenied},
+
+		{name: "read scope on read method", principal: readKey, method: "Get", req: getByUsername("alice")},
+		{name: "read scope on write method", principal: readKey, method: "Update", req: &desc.UpdateRequest{Username: "alice"}, want: errScopeNotAllowed},
+		{name: "full scope on write method", principal: fullKey, method: "Update", req: &desc.UpdateRequest{Username: "alice"}},
+		{name: "session method by api key", principal: fullKey, method: "ChangePassword", req: &desc.ChangePasswordRequest{Username: "alice"}, want: errSessionRequired},
+		{name: "session method by session", principal: alice, method: "ChangePassword", req: &desc.ChangePasswordRequest{Username: "alice"}},
+
+		{name: "restricted session", principal: restricted, method: "Delete", req: &desc.DeleteRequest{Username: "bob"}, want: errMfaEnrollmentRequired},
+		{name: "restricted session on self", principal: restricted, method: "Get", req: getByUsername("root"), want: errMfaEnrollmentRequired},
+		{name: "restricted session enrolls", principal: restricted, method: "EnrollMfa", req: &desc.EnrollMfaRequest{Username: "root"}},
+		{name: "restricted session confirms", principal: restricted, method: "ConfirmMfa", req: &desc.ConfirmMfaRequest{Username: "root"}},
+
+		{name: "global method", principal: admin, method: "CreateOrganization", req: &desc.CreateOrganizationRequest{Name: "acme"}},
+		{name: "global method from other organization", principal: tenantAdmin, method: "CreateOrganization", req: &desc.CreateOrganizationRequest{Name: "acme"}, want: errPermissionDenied},
+		{name: "local method from other organization", principal: tenantAdmin, method: "Delete", req: &desc.DeleteRequest{Username: "bob"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.principal != nil {
+				ctx = auth.NewContext(ctx, tt.principal)
+			}
+
+			if err := p.Authorize(ctx, method(tt.method), tt.req); err != tt.want {
+				t.Fatalf("Authorize() err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+func TestAuthorizeWithRules(t *testing.T) {
+	p := newTestPolicy(t, `
+rules:
+  - name: support-reads
+    effect: allow
+    methods: [Get]
+    condition: '"support" in principal.roles'
+  - name: protect-admins
+    effect: deny
+    methods: [Get, Delete]
+    condition: target != null && "admin" in target.roles && principal.username != target.username
+`)
+
+	support := &auth.Principal{OrganizationID: model.DefaultOrganizationID, Username: "bob", RoleNames: []string{"support"}}
+	admin := &auth.Principal{
+		OrganizationID: model.DefaultOrganizationID,
+		Username:       "alice",
+		Permissions:    map[string]bool{model.PermissionReadUsers: true, model.PermissionDeleteUsers: true},
+	}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		method    string
+		req       interface{}
+		want      error
+	}{
+		{name: "allow rule without permission", principal: support, method: "Get", req: &desc.GetRequest{Key: &desc.GetRequest_Username{Username: "alice"}}},
+		{name: "allow rule for other method", principal: support, method: "Delete", req: &desc.DeleteRequest{Username: "alice"}, want: errPermissionDenied},
+		{name: "deny rule overrides permission", principal: admin, method: "Delete", req: &desc.DeleteRequest{Username: "root"}, want: errPermissionDenied},
+		{name: "deny rule overrides allow rule", principal: support, method: "Get", req: &desc.GetRequest{Key: &desc.GetRequest_Username{Username: "root"}}, want: errPermissionDenied},
+		{name: "deny rule not matched", principal: admin, method: "Delete", req: &desc.DeleteRequest{Username: "bob"}},
+		{name: "missing target", principal: admin, method: "Delete", req: &desc.DeleteRequest{Username: "carol"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := auth.NewContext(context.Background(), tt.principal)
+
+			if err := p.Authorize(ctx, method(tt.method), tt.req); err != tt.want {
+				t.Fatalf("Authorize() err = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
+
+// seededPermission имя разрешения в строковом литерале миграции
+var seededPermission = regexp.MustCompile(`'([a-z_]+\.[a-z_]+)'`)
+
+// Разрешение, которого нет в базе, нельзя выдать роли, и метод был бы доступен только через правила политик
+func TestMethodPermissionsAreSeeded(t *testing.T) {
+	files, err := filepath.Glob(filepath.Join("..", "..", "..", "migrations", "*.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) == 0 {
+		t.Fatal("no migrations found")
+	}
+
+	seeded := make(map[string]bool)
+	for _, file := range files {
+		src, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		up, _, _ := strings.Cut(string(src), "-- +goose Down")
+		for _, match := range seededPermission.FindAllStringSubmatch(up, -1) {
+			seeded[match[1]] = true
+		}
+	}
+
+	for name, policy := range methodPolicies {
+		if policy.permission != "" && !seeded[policy.permission] {
+			t.Errorf("%s: permission %q is not created by migrations", name, policy.permission)
+		}
+	}
+}
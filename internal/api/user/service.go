@@ -4,8 +4,10 @@ import (
 	"context"
 
 	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
 
 	converter "github.com/Slintox/user-service/internal/converter/user"
+	"github.com/Slintox/user-service/internal/model"
 	"github.com/Slintox/user-service/internal/service/user"
 	desc "github.com/Slintox/user-service/pkg/user_v1"
 )
@@ -32,7 +34,15 @@ func (i *Implementation) Create(ctx context.Context, req *desc.CreateRequest) (*
 }
 
 func (i *Implementation) Get(ctx context.Context, req *desc.GetRequest) (*desc.GetResponse, error) {
-	userView, err := i.userService.Get(ctx, req.GetUsername())
+	var userView *model.User
+	var err error
+
+	switch key := req.GetKey().(type) {
+	case *desc.GetRequest_Email:
+		userView, err = i.userService.GetByEmail(ctx, key.Email)
+	default:
+		userView, err = i.userService.Get(ctx, req.GetUsername())
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -55,11 +65,533 @@ func (i *Implementation) Update(ctx context.Context, req *desc.UpdateRequest) (*
 	return &emptypb.Empty{}, nil
 }
 
-func (i *Implementation) Delete(ctx context.Context, req *desc.DeleteRequest) (*emptypb.Empty, error) {
-	err := i.userService.Delete(ctx, req.GetUsername())
+func (i *Implementation) Delete(ctx context.Context, req *desc.DeleteRequest) (*desc.DeleteResponse, error) {
+	deletedUser, err := i.userService.Delete(ctx, req.GetUsername(), converter.ToDeleteUserDesc(req))
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.DeleteResponse{
+		User: converter.FromUserDesc(deletedUser),
+	}, nil
+}
+
+func (i *Implementation) GetPasswordPolicy(ctx context.Context, _ *emptypb.Empty) (*desc.GetPasswordPolicyResponse, error) {
+	return &desc.GetPasswordPolicyResponse{
+		Policy: converter.FromPasswordPolicyDesc(i.userService.GetPasswordPolicy(ctx)),
+	}, nil
+}
+
+func (i *Implementation) Login(ctx context.Context, req *desc.LoginRequest) (*desc.LoginResponse, error) {
+	userView, session, err := i.userService.Login(ctx, converter.ToCredentialsDesc(req))
 	if err != nil {
 		return nil, err
 	}
 
+	return loginResponse(userView, session), nil
+}
+
+func (i *Implementation) GetPasswordHashStats(ctx context.Context, _ *emptypb.Empty) (*desc.GetPasswordHashStatsResponse, error) {
+	stats, err := i.userService.GetPasswordHashStats(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.GetPasswordHashStatsResponse{
+		UsersByAlgorithm: stats,
+	}, nil
+}
+
+func (i *Implementation) UnlockUser(ctx context.Context, req *desc.UnlockUserRequest) (*emptypb.Empty, error) {
+	if err := i.userService.UnlockUser(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+
 	return &emptypb.Empty{}, nil
 }
+
+func (i *Implementation) RequestPasswordReset(ctx context.Context, req *desc.RequestPasswordResetRequest) (*emptypb.Empty, error) {
+	if err := i.userService.RequestPasswordReset(ctx, req.GetEmail()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) ResetPassword(ctx context.Context, req *desc.ResetPasswordRequest) (*emptypb.Empty, error) {
+	if err := i.userService.ResetPassword(ctx, req.GetToken(), req.GetNewPassword()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) ChangePassword(ctx context.Context, req *desc.ChangePasswordRequest) (*emptypb.Empty, error) {
+	if err := i.userService.ChangePassword(ctx, req.GetUsername(), converter.ToChangePasswordDesc(req)); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) VerifyEmail(ctx context.Context, req *desc.VerifyEmailRequest) (*emptypb.Empty, error) {
+	if err := i.userService.VerifyEmail(ctx, req.GetToken()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) ResendVerificationEmail(ctx context.Context, req *desc.ResendVerificationEmailRequest) (*emptypb.Empty, error) {
+	if err := i.userService.ResendEmailVerification(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) ConfirmEmailChange(ctx context.Context, req *desc.ConfirmEmailChangeRequest) (*emptypb.Empty, error) {
+	if err := i.userService.ConfirmEmailChange(ctx, req.GetToken()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) CancelEmailChange(ctx context.Context, req *desc.CancelEmailChangeRequest) (*emptypb.Empty, error) {
+	if err := i.userService.CancelEmailChange(ctx, req.GetToken()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) EnrollMfa(ctx context.Context, req *desc.EnrollMfaRequest) (*desc.EnrollMfaResponse, error) {
+	enrollment, err := i.userService.EnrollMfa(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.EnrollMfaResponse{
+		Secret:     enrollment.Secret,
+		OtpauthUri: enrollment.URI,
+	}, nil
+}
+
+func (i *Implementation) ConfirmMfa(ctx context.Context, req *desc.ConfirmMfaRequest) (*desc.ConfirmMfaResponse, error) {
+	recoveryCodes, err := i.userService.ConfirmMfa(ctx, req.GetUsername(), req.GetCode())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.ConfirmMfaResponse{
+		RecoveryCodes: recoveryCodes,
+	}, nil
+}
+
+func (i *Implementation) DisableMfa(ctx context.Context, req *desc.DisableMfaRequest) (*emptypb.Empty, error) {
+	if err := i.userService.DisableMfa(ctx, req.GetUsername()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) GetMfaPolicy(ctx context.Context, _ *emptypb.Empty) (*desc.GetMfaPolicyResponse, error) {
+	policies, err := i.userService.GetMfaPolicies(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &desc.GetMfaPolicyResponse{
+		Policies: make([]*desc.MfaRolePolicy, 0, len(policies)),
+	}
+	for _, policy := range policies {
+		resp.Policies = append(resp.Policies, converter.FromMfaRolePolicyDesc(policy))
+	}
+
+	return resp, nil
+}
+
+func (i *Implementation) SetMfaPolicy(ctx context.Context, req *desc.SetMfaPolicyRequest) (*emptypb.Empty, error) {
+	if req.GetPolicy() == nil {
+		return nil, errNoPolicy
+	}
+
+	if err := i.userService.SetMfaPolicy(ctx, converter.ToMfaRolePolicyDesc(req.GetPolicy())); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) BeginWebAuthnRegistration(ctx context.Context, req *desc.BeginWebAuthnRegistrationRequest) (*desc.BeginWebAuthnResponse, error) {
+	options, err := i.userService.BeginWebAuthnRegistration(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.BeginWebAuthnResponse{
+		OptionsJson: string(options),
+	}, nil
+}
+
+func (i *Implementation) FinishWebAuthnRegistration(ctx context.Context, req *desc.FinishWebAuthnRegistrationRequest) (*desc.FinishWebAuthnRegistrationResponse, error) {
+	credential, err := i.userService.FinishWebAuthnRegistration(ctx, req.GetUsername(), converter.ToWebAuthnRegistrationDesc(req))
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.FinishWebAuthnRegistrationResponse{
+		Credential: converter.FromWebAuthnCredentialDesc(credential),
+	}, nil
+}
+
+func (i *Implementation) BeginWebAuthnLogin(ctx context.Context, req *desc.BeginWebAuthnLoginRequest) (*desc.BeginWebAuthnResponse, error) {
+	options, err := i.userService.BeginWebAuthnLogin(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.BeginWebAuthnResponse{
+		OptionsJson: string(options),
+	}, nil
+}
+
+func (i *Implementation) FinishWebAuthnLogin(ctx context.Context, req *desc.FinishWebAuthnLoginRequest) (*desc.LoginResponse, error) {
+	userView, session, err := i.userService.FinishWebAuthnLogin(ctx, converter.ToWebAuthnAssertionDesc(req))
+	if err != nil {
+		return nil, err
+	}
+
+	return loginResponse(userView, session), nil
+}
+
+func (i *Implementation) ListWebAuthnCredentials(ctx context.Context, req *desc.ListWebAuthnCredentialsRequest) (*desc.ListWebAuthnCredentialsResponse, error) {
+	credentials, err := i.userService.ListWebAuthnCredentials(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &desc.ListWebAuthnCredentialsResponse{
+		Credentials: make([]*desc.WebAuthnCredential, 0, len(credentials)),
+	}
+	for _, credential := range credentials {
+		resp.Credentials = append(resp.Credentials, converter.FromWebAuthnCredentialDesc(credential))
+	}
+
+	return resp, nil
+}
+
+func (i *Implementation) DeleteWebAuthnCredential(ctx context.Context, req *desc.DeleteWebAuthnCredentialRequest) (*emptypb.Empty, error) {
+	if err := i.userService.DeleteWebAuthnCredential(ctx, req.GetUsername(), req.GetCredentialId()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) CreateApiKey(ctx context.Context, req *desc.CreateApiKeyRequest) (*desc.CreateApiKeyResponse, error) {
+	key, err := i.userService.CreateApiKey(ctx, req.GetUsername(), converter.ToCreateApiKeyDesc(req))
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.CreateApiKeyResponse{
+		ApiKey: converter.FromApiKeyDesc(key),
+		Key:    key.Key,
+	}, nil
+}
+
+func (i *Implementation) ListApiKeys(ctx context.Context, req *desc.ListApiKeysRequest) (*desc.ListApiKeysResponse, error) {
+	keys, err := i.userService.ListApiKeys(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &desc.ListApiKeysResponse{
+		ApiKeys: make([]*desc.ApiKey, 0, len(keys)),
+	}
+	for _, key := range keys {
+		resp.ApiKeys = append(resp.ApiKeys, converter.FromApiKeyDesc(key))
+	}
+
+	return resp, nil
+}
+
+func (i *Implementation) RevokeApiKey(ctx context.Context, req *desc.RevokeApiKeyRequest) (*emptypb.Empty, error) {
+	if err := i.userService.RevokeApiKey(ctx, req.GetUsername(), req.GetId()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) CreateRole(ctx context.Context, req *desc.CreateRoleRequest) (*desc.CreateRoleResponse, error) {
+	role, err := i.userService.CreateRole(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.CreateRoleResponse{
+		Role: converter.FromRoleDesc(role),
+	}, nil
+}
+
+func (i *Implementation) RenameRole(ctx context.Context, req *desc.RenameRoleRequest) (*emptypb.Empty, error) {
+	if err := i.userService.RenameRole(ctx, req.GetName(), req.GetNewName()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) ListRoles(ctx context.Context, _ *emptypb.Empty) (*desc.ListRolesResponse, error) {
+	roles, err := i.userService.ListRoles(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &desc.ListRolesResponse{
+		Roles: make([]*desc.Role, 0, len(roles)),
+	}
+	for _, role := range roles {
+		resp.Roles = append(resp.Roles, converter.FromRoleDesc(role))
+	}
+
+	return resp, nil
+}
+
+func (i *Implementation) DeleteRole(ctx context.Context, req *desc.DeleteRoleRequest) (*emptypb.Empty, error) {
+	if err := i.userService.DeleteRole(ctx, req.GetName()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) ListPermissions(ctx context.Context, req *desc.ListPermissionsRequest) (*desc.ListPermissionsResponse, error) {
+	permissions, err := i.userService.ListPermissions(ctx, req.GetRoleName())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &desc.ListPermissionsResponse{
+		Permissions: make([]*desc.Permission, 0, len(permissions)),
+	}
+	for _, permission := range permissions {
+		resp.Permissions = append(resp.Permissions, converter.FromPermissionDesc(permission))
+	}
+
+	return resp, nil
+}
+
+func (i *Implementation) GrantPermission(ctx context.Context, req *desc.GrantPermissionRequest) (*emptypb.Empty, error) {
+	if err := i.userService.GrantPermission(ctx, req.GetRoleName(), req.GetPermission()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) RevokePermission(ctx context.Context, req *desc.RevokePermissionRequest) (*emptypb.Empty, error) {
+	if err := i.userService.RevokePermission(ctx, req.GetRoleName(), req.GetPermission()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) CheckPermission(ctx context.Context, req *desc.CheckPermissionRequest) (*desc.CheckPermissionResponse, error) {
+	allowed, err := i.userService.CheckPermission(ctx, req.GetSubject(), req.GetPermission())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.CheckPermissionResponse{
+		Allowed: allowed,
+	}, nil
+}
+
+func (i *Implementation) AssignRole(ctx context.Context, req *desc.AssignRoleRequest) (*emptypb.Empty, error) {
+	if err := i.userService.AssignRole(ctx, req.GetUsername(), req.GetRoleName(), converter.ToRoleGrantDesc(req)); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) UnassignRole(ctx context.Context, req *desc.UnassignRoleRequest) (*emptypb.Empty, error) {
+	if err := i.userService.UnassignRole(ctx, req.GetUsername(), req.GetRoleName()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) CreateOrganization(ctx context.Context, req *desc.CreateOrganizationRequest) (*desc.CreateOrganizationResponse, error) {
+	var admin *model.CreateUser
+	if req.GetAdmin() != nil {
+		admin = converter.ToCreateUserDesc(req.GetAdmin())
+	}
+
+	organization, err := i.userService.CreateOrganization(ctx, req.GetName(), admin)
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.CreateOrganizationResponse{
+		Organization: converter.FromOrganizationDesc(organization),
+	}, nil
+}
+
+func (i *Implementation) ListOrganizations(ctx context.Context, _ *emptypb.Empty) (*desc.ListOrganizationsResponse, error) {
+	organizations, err := i.userService.ListOrganizations(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &desc.ListOrganizationsResponse{
+		Organizations: make([]*desc.Organization, 0, len(organizations)),
+	}
+	for _, organization := range organizations {
+		resp.Organizations = append(resp.Organizations, converter.FromOrganizationDesc(organization))
+	}
+
+	return resp, nil
+}
+
+func (i *Implementation) CreateGroup(ctx context.Context, req *desc.CreateGroupRequest) (*desc.CreateGroupResponse, error) {
+	group, err := i.userService.CreateGroup(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.CreateGroupResponse{
+		Group: converter.FromGroupDesc(group),
+	}, nil
+}
+
+func (i *Implementation) GetGroup(ctx context.Context, req *desc.GetGroupRequest) (*desc.GetGroupResponse, error) {
+	group, err := i.userService.GetGroup(ctx, req.GetName())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.GetGroupResponse{
+		Group: converter.FromGroupDesc(group),
+	}, nil
+}
+
+func (i *Implementation) ListGroups(ctx context.Context, _ *emptypb.Empty) (*desc.ListGroupsResponse, error) {
+	groups, err := i.userService.ListGroups(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &desc.ListGroupsResponse{
+		Groups: make([]*desc.Group, 0, len(groups)),
+	}
+	for _, group := range groups {
+		resp.Groups = append(resp.Groups, converter.FromGroupDesc(group))
+	}
+
+	return resp, nil
+}
+
+func (i *Implementation) RenameGroup(ctx context.Context, req *desc.RenameGroupRequest) (*emptypb.Empty, error) {
+	if err := i.userService.RenameGroup(ctx, req.GetName(), req.GetNewName()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) DeleteGroup(ctx context.Context, req *desc.DeleteGroupRequest) (*emptypb.Empty, error) {
+	if err := i.userService.DeleteGroup(ctx, req.GetName()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) AddGroupMember(ctx context.Context, req *desc.AddGroupMemberRequest) (*emptypb.Empty, error) {
+	if err := i.userService.AddGroupMember(ctx, req.GetGroupName(), converter.ToGroupMemberDesc(req)); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) RemoveGroupMember(ctx context.Context, req *desc.RemoveGroupMemberRequest) (*emptypb.Empty, error) {
+	if err := i.userService.RemoveGroupMember(ctx, req.GetGroupName(), converter.ToGroupMemberDesc(req)); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) ListGroupMembers(ctx context.Context, req *desc.ListGroupMembersRequest) (*desc.ListGroupMembersResponse, error) {
+	members, err := i.userService.ListGroupMembers(ctx, req.GetGroupName(), req.GetEffective())
+	if err != nil {
+		return nil, err
+	}
+
+	return &desc.ListGroupMembersResponse{
+		Usernames:  members.Usernames,
+		GroupNames: members.GroupNames,
+	}, nil
+}
+
+func (i *Implementation) ListUserGroups(ctx context.Context, req *desc.ListUserGroupsRequest) (*desc.ListUserGroupsResponse, error) {
+	memberships, err := i.userService.ListUserGroups(ctx, req.GetUsername())
+	if err != nil {
+		return nil, err
+	}
+
+	resp := &desc.ListUserGroupsResponse{
+		Groups: make([]*desc.GroupMembership, 0, len(memberships)),
+	}
+	for _, membership := range memberships {
+		resp.Groups = append(resp.Groups, &desc.GroupMembership{
+			GroupName: membership.GroupName,
+			Direct:    membership.Direct,
+		})
+	}
+
+	return resp, nil
+}
+
+func (i *Implementation) AssignGroupRole(ctx context.Context, req *desc.AssignGroupRoleRequest) (*emptypb.Empty, error) {
+	if err := i.userService.AssignGroupRole(ctx, req.GetGroupName(), req.GetRoleName()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) UnassignGroupRole(ctx context.Context, req *desc.UnassignGroupRoleRequest) (*emptypb.Empty, error) {
+	if err := i.userService.UnassignGroupRole(ctx, req.GetGroupName(), req.GetRoleName()); err != nil {
+		return nil, err
+	}
+
+	return &emptypb.Empty{}, nil
+}
+
+func (i *Implementation) DryRunPolicy(ctx context.Context, req *desc.DryRunPolicyRequest) (*desc.DryRunPolicyResponse, error) {
+	result, err := i.userService.DryRunPolicy(ctx, converter.ToPolicyDryRunDesc(req))
+	if err != nil {
+		return nil, err
+	}
+
+	return converter.FromPolicyResultDesc(result), nil
+}
+
+func loginResponse(user *model.User, session *model.Session) *desc.LoginResponse {
+	return &desc.LoginResponse{
+		User:                  converter.FromUserDesc(user),
+		SessionToken:          session.Token,
+		SessionExpiresAt:      timestamppb.New(session.ExpiresAt),
+		MfaEnrollmentRequired: session.MfaEnrollmentRequired,
+	}
+}
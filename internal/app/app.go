@@ -2,20 +2,61 @@ package app
 
 import (
 	"context"
+	"crypto/rand"
+	"errors"
+	"fmt"
 	"log"
 	"net"
+	"net/http"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
+	reflectionpb "google.golang.org/grpc/reflection/grpc_reflection_v1alpha"
 
 	"github.com/Slintox/user-service/config"
 	"github.com/Slintox/user-service/internal/api/user"
+	"github.com/Slintox/user-service/internal/interceptor"
+	"github.com/Slintox/user-service/internal/notifier"
+	"github.com/Slintox/user-service/internal/password"
+	"github.com/Slintox/user-service/internal/policy"
+	repo "github.com/Slintox/user-service/internal/repository"
+	apiKeyRepo "github.com/Slintox/user-service/internal/repository/apikey"
+	emailChangeRepo "github.com/Slintox/user-service/internal/repository/emailchange"
+	eventRepo "github.com/Slintox/user-service/internal/repository/event"
+	groupRepo "github.com/Slintox/user-service/internal/repository/group"
+	idemRepo "github.com/Slintox/user-service/internal/repository/idempotency"
+	mfaRepo "github.com/Slintox/user-service/internal/repository/mfa"
+	organizationRepo "github.com/Slintox/user-service/internal/repository/organization"
+	permissionRepo "github.com/Slintox/user-service/internal/repository/permission"
+	resetRepo "github.com/Slintox/user-service/internal/repository/reset"
+	roleRepo "github.com/Slintox/user-service/internal/repository/role"
+	sessionRepo "github.com/Slintox/user-service/internal/repository/session"
+	throttleRepo "github.com/Slintox/user-service/internal/repository/throttle"
 	uRepo "github.com/Slintox/user-service/internal/repository/user"
+	webAuthnRepo "github.com/Slintox/user-service/internal/repository/webauthn"
 	uService "github.com/Slintox/user-service/internal/service/user"
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/internal/token"
+	"github.com/Slintox/user-service/internal/webauthn"
 	"github.com/Slintox/user-service/pkg/database/postgres"
 	userV1 "github.com/Slintox/user-service/pkg/user_v1"
 )
 
+const (
+	idempotencyCleanupInterval = time.Hour
+	roleGrantSweepInterval     = time.Minute
+)
+
+// Изменяющие методы, для которых поддерживается ключ идемпотентности
+var idempotentMethods = []string{
+	"Create",
+	"Update",
+	"Delete",
+	"ResetPassword",
+}
+
 func Run(configPath string) {
 	ctx := context.Background()
 
@@ -29,22 +70,243 @@ func Run(configPath string) {
 		log.Fatalf("failed to get listener: %s", err.Error())
 	}
 
-	s := grpc.NewServer()
-	reflection.Register(s)
-
-	pgPool, err := postgres.Connect(ctx, cfg.Postgres)
+	pgPool, err := postgres.Connect(ctx, cfg.Postgres, repo.SetTenant)
 	if err != nil {
 		log.Fatalf("failed to get postgres connect: %s", err.Error())
 	}
 
+	breachChecker, err := password.LoadBreachChecker(cfg.Breach.Path)
+	if err != nil {
+		log.Fatalf("failed to load breached passwords: %s", err.Error())
+	}
+
+	policies, err := policy.NewEvaluator(cfg.Policy)
+	if err != nil {
+		log.Fatalf("failed to load policies: %s", err.Error())
+	}
+	go policies.Watch(ctx)
+
+	go serveMetrics(cfg.Metrics.Port)
+
+	organizations := organizationRepo.NewRepository(pgPool)
+
+	idempotencyRepo := idemRepo.NewRepository(pgPool)
+	go cleanupIdempotency(ctx, organizations, idempotencyRepo)
+
 	var userRepo uRepo.Repository
 	var userService uService.Service
 
-	userRepo = uRepo.NewRepository(pgPool)
-	userService = uService.NewService(userRepo)
+	hasher, err := password.NewHasher(cfg.Hash)
+	if err != nil {
+		log.Fatalf("failed to create password hasher: %s", err.Error())
+	}
+
+	signer, err := newSigner(cfg.Signing, cfg.App.Dev)
+	if err != nil {
+		log.Fatalf("failed to create token signer: %s", err.Error())
+	}
+
+	notify, err := newNotifier(cfg.SMTP, cfg.App.Dev)
+	if err != nil {
+		log.Fatalf("failed to create notifier: %s", err.Error())
+	}
+
+	userRepo = uRepo.NewRepository(pgPool, cfg.Password.HistoryDepth)
+	userService = uService.NewService(uService.Deps{
+		UserRepo:         userRepo,
+		ThrottleRepo:     throttleRepo.NewRepository(pgPool),
+		EventRepo:        eventRepo.NewRepository(pgPool),
+		SessionRepo:      sessionRepo.NewRepository(pgPool),
+		ResetRepo:        resetRepo.NewRepository(pgPool),
+		EmailChangeRepo:  emailChangeRepo.NewRepository(pgPool),
+		MfaRepo:          mfaRepo.NewRepository(pgPool),
+		WebAuthnRepo:     webAuthnRepo.NewRepository(pgPool),
+		ApiKeyRepo:       apiKeyRepo.NewRepository(pgPool),
+		RoleRepo:         roleRepo.NewRepository(pgPool),
+		PermissionRepo:   permissionRepo.NewRepository(pgPool),
+		OrganizationRepo: organizations,
+		GroupRepo:        groupRepo.NewRepository(pgPool),
+		PasswordPolicy:   password.NewPolicy(cfg.Password),
+		BreachChecker:    breachChecker,
+		Hasher:           hasher,
+		Notifier:         notify,
+		Signer:           signer,
+		RelyingParty:     newRelyingParty(cfg.WebAuthn),
+		Policies:         policies,
+		LoginCfg:         cfg.Login,
+		SessionCfg:       cfg.Session,
+		ResetCfg:         cfg.Reset,
+		VerifyCfg:        cfg.Verify,
+		EmailChangeCfg:   cfg.EmailChange,
+		MfaCfg:           cfg.Mfa,
+		WebAuthnCfg:      cfg.WebAuthn,
+		ApiKeyCfg:        cfg.ApiKey,
+	})
+	go expireRoleGrants(ctx, organizations, userService)
+
+	authorizer := user.NewPolicy(policies, userService, serviceMethodNames(reflectionpb.ServerReflection_ServiceDesc)...)
+
+	s := grpc.NewServer(
+		grpc.ChainUnaryInterceptor(
+			interceptor.ClientIP(cfg.Login.TrustForwardedFor),
+			interceptor.Tenant(userService),
+			interceptor.Auth(userService, authorizer),
+			interceptor.Idempotency(idempotencyRepo, cfg.Idempotency.TTL, fullMethodNames(idempotentMethods)...),
+		),
+		grpc.ChainStreamInterceptor(
+			interceptor.StreamTenant(userService),
+			interceptor.StreamAuth(userService, authorizer),
+		),
+	)
+	reflection.Register(s)
+
 	userV1.RegisterUserV1Server(s, user.NewImplementation(userService))
 
 	if err = s.Serve(list); err != nil {
 		log.Fatalf("failed to serve: %s", err.Error())
 	}
 }
+
+// newSigner создаёт подпись токенов. Без ключа в конфигурации используется
+// случайный ключ, действующий до перезапуска, что допускается только в режиме разработки
+func newSigner(cfg *config.TokenSigningConfig, dev bool) (*token.Signer, error) {
+	if cfg.Secret != "" {
+		return token.NewSigner([]byte(cfg.Secret)), nil
+	}
+
+	if !dev {
+		return nil, errors.New("token signing secret is not set")
+	}
+
+	log.Printf("token signing secret is not set, using a random one")
+
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return nil, err
+	}
+
+	return token.NewSigner(secret), nil
+}
+
+// newNotifier создаёт доставку уведомлений по почте. Без SMTP-сервера
+// уведомления пишутся в лог, что допускается только в режиме разработки
+func newNotifier(cfg *config.SMTPConfig, dev bool) (notifier.Notifier, error) {
+	if cfg.Host != "" {
+		return notifier.NewSMTPNotifier(cfg), nil
+	}
+
+	if !dev {
+		return nil, errors.New("smtp host is not set")
+	}
+
+	log.Printf("smtp host is not set, notifications are written to the log")
+
+	return notifier.NewLogNotifier(), nil
+}
+
+func newRelyingParty(cfg *config.WebAuthnConfig) *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:                      cfg.RPID,
+		Name:                    cfg.RPName,
+		Origins:                 cfg.Origins,
+		RequireUserVerification: cfg.RequireUserVerification,
+		Timeout:                 cfg.ChallengeTTL,
+	}
+}
+
+// serviceMethodNames возвращает полные имена всех методов сервиса
+func serviceMethodNames(sd grpc.ServiceDesc) []string {
+	names := make([]string, 0, len(sd.Methods)+len(sd.Streams))
+	for _, method := range sd.Methods {
+		names = append(names, "/"+sd.ServiceName+"/"+method.MethodName)
+	}
+	for _, stream := range sd.Streams {
+		names = append(names, "/"+sd.ServiceName+"/"+stream.StreamName)
+	}
+
+	return names
+}
+
+func fullMethodNames(methods []string) []string {
+	names := make([]string, 0, len(methods))
+	for _, method := range methods {
+		names = append(names, "/"+userV1.UserV1_ServiceDesc.ServiceName+"/"+method)
+	}
+
+	return names
+}
+
+// expireRoleGrants периодически удаляет истёкшие временные назначения ролей
+func expireRoleGrants(ctx context.Context, organizations organizationRepo.Repository, userService uService.Service) {
+	ticker := time.NewTicker(roleGrantSweepInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			forEachOrganization(ctx, organizations, func(ctx context.Context) error {
+				expired, err := userService.ExpireRoleGrants(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to expire role grants: %w", err)
+				}
+				if expired > 0 {
+					log.Printf("expired %d role grants", expired)
+				}
+
+				return nil
+			})
+		}
+	}
+}
+
+// cleanupIdempotency периодически удаляет просроченные ключи идемпотентности
+func cleanupIdempotency(ctx context.Context, organizations organizationRepo.Repository, idempotencyRepo idemRepo.Repository) {
+	ticker := time.NewTicker(idempotencyCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			forEachOrganization(ctx, organizations, func(ctx context.Context) error {
+				deleted, err := idempotencyRepo.DeleteExpired(ctx)
+				if err != nil {
+					return fmt.Errorf("failed to cleanup idempotency keys: %w", err)
+				}
+				if deleted > 0 {
+					log.Printf("deleted %d expired idempotency keys", deleted)
+				}
+
+				return nil
+			})
+		}
+	}
+}
+
+// forEachOrganization выполняет job в контексте каждой организации:
+// запросы фоновых задач, как и запросы клиентов, ограничены организацией
+func forEachOrganization(ctx context.Context, organizations organizationRepo.Repository, job func(ctx context.Context) error) {
+	list, err := organizations.List(ctx)
+	if err != nil {
+		log.Printf("failed to list organizations: %s", err.Error())
+		return
+	}
+
+	for _, organization := range list {
+		if err = job(tenant.NewContext(ctx, organization.ID)); err != nil {
+			log.Printf("organization %s: %s", organization.Name, err.Error())
+		}
+	}
+}
+
+func serveMetrics(port string) {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+
+	if err := http.ListenAndServe(port, mux); err != nil {
+		log.Printf("failed to serve metrics: %s", err.Error())
+	}
+}
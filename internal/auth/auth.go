@@ -0,0 +1,67 @@
+package auth
+
+import (
+	"context"
+
+	"github.com/Slintox/user-service/internal/model"
+)
+
+// Principal описывает аутентифицированного вызывающего
+type Principal struct {
+	// Организация, в которой аутентифицирован вызывающий
+	OrganizationID int64
+	Username       string
+	Email          string
+	Roles          []model.UserRole
+	// Имена ролей, в том же порядке, что и Roles
+	RoleNames []string
+	// Разрешения всех ролей вызывающего
+	Permissions map[string]bool
+	// Вызывающий аутентифицирован API-ключом, а не сессией
+	ApiKey bool
+	// Области действия API-ключа. Пусто для сессий
+	Scopes []string
+	// Сессия позволяет только подключить второй фактор, обязательный для роли
+	MfaEnrollmentRequired bool
+	// Сессия вызывающего. 0 для API-ключей
+	SessionID int64
+}
+
+// Can сообщает, что одна из ролей вызывающего имеет разрешение permission
+func (p *Principal) Can(permission string) bool {
+	return p != nil && p.Permissions[permission]
+}
+
+// InDefaultOrganization сообщает, что вызывающий из организации по умолчанию
+func (p *Principal) InDefaultOrganization() bool {
+	return p != nil && p.OrganizationID == model.DefaultOrganizationID
+}
+
+// HasScope сообщает, разрешена ли вызывающему область scope.
+// Сессии не ограничены, API-ключу нужна сама область или model.ApiKeyScopeAll
+func (p *Principal) HasScope(scope string) bool {
+	if p == nil || !p.ApiKey {
+		return true
+	}
+
+	for _, s := range p.Scopes {
+		if s == scope || s == model.ApiKeyScopeAll {
+			return true
+		}
+	}
+
+	return false
+}
+
+type ctxKey struct{}
+
+// NewContext сохраняет вызывающего в контексте запроса
+func NewContext(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, ctxKey{}, principal)
+}
+
+// FromContext возвращает вызывающего или nil, если запрос не аутентифицирован
+func FromContext(ctx context.Context) *Principal {
+	principal, _ := ctx.Value(ctxKey{}).(*Principal)
+	return principal
+}
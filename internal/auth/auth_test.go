@@ -0,0 +1,30 @@
+package auth
+
+import (
+	"testing"
+
+	"github.com/Slintox/user-service/internal/model"
+)
+
+func TestHasScope(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *Principal
+		scope     string
+		want      bool
+	}{
+		{name: "session", principal: &Principal{}, scope: model.ApiKeyScopeWrite, want: true},
+		{name: "read key reads", principal: &Principal{ApiKey: true, Scopes: []string{model.ApiKeyScopeRead}}, scope: model.ApiKeyScopeRead, want: true},
+		{name: "read key writes", principal: &Principal{ApiKey: true, Scopes: []string{model.ApiKeyScopeRead}}, scope: model.ApiKeyScopeWrite},
+		{name: "all key writes", principal: &Principal{ApiKey: true, Scopes: []string{model.ApiKeyScopeAll}}, scope: model.ApiKeyScopeWrite, want: true},
+		{name: "key without scopes", principal: &Principal{ApiKey: true}, scope: model.ApiKeyScopeRead},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.principal.HasScope(tt.scope); got != tt.want {
+				t.Fatalf("HasScope(%q) = %v, want %v", tt.scope, got, tt.want)
+			}
+		})
+	}
+}
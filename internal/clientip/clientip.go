@@ -0,0 +1,16 @@
+package clientip
+
+import "context"
+
+type ctxKey struct{}
+
+// NewContext сохраняет адрес клиента в контексте запроса
+func NewContext(ctx context.Context, ip string) context.Context {
+	return context.WithValue(ctx, ctxKey{}, ip)
+}
+
+// FromContext возвращает адрес клиента или пустую строку, если он неизвестен
+func FromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(ctxKey{}).(string)
+	return ip
+}
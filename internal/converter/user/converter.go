@@ -9,14 +9,37 @@ import (
 
 // FromUserDesc converts model.User -> grpc.User
 func FromUserDesc(user *model.User) *desc.User {
-	return &desc.User{
-		Username:  user.Username,
-		Email:     user.Email,
-		Password:  user.Password,
-		Role:      desc.UserRole(user.Role),
-		CreatedAt: timestamppb.New(user.CreatedAt),
-		UpdatedAt: timestamppb.New(user.UpdatedAt),
+	if user == nil {
+		return nil
 	}
+
+	descUser := &desc.User{
+		Username:      user.Username,
+		Email:         user.Email,
+		CreatedAt:     timestamppb.New(user.CreatedAt),
+		UpdatedAt:     timestamppb.New(user.UpdatedAt),
+		Version:       user.Version,
+		EmailVerified: user.EmailVerifiedAt != nil,
+		Roles:         make([]string, 0, len(user.Roles)),
+	}
+
+	for _, role := range user.Roles {
+		descUser.Roles = append(descUser.Roles, role.Name)
+	}
+
+	// Для клиентов, читающих единственную роль
+	if primary := user.PrimaryRole(); primary != nil {
+		descUser.RoleName = primary.Name
+		if primary.ID == model.UserRoleUser || primary.ID == model.UserRoleAdmin {
+			descUser.Role = desc.UserRole(primary.ID)
+		}
+	}
+
+	if user.EmailVerifiedAt != nil {
+		descUser.EmailVerifiedAt = timestamppb.New(*user.EmailVerifiedAt)
+	}
+
+	return descUser
 }
 
 // ToCreateUserDesc converts grpc.CreateRequest -> model.User
@@ -27,6 +50,7 @@ func ToCreateUserDesc(user *desc.CreateRequest) *model.CreateUser {
 		Password:        user.GetPassword(),
 		ConfirmPassword: user.GetConfirmPassword(),
 		Role:            model.UserRole(user.GetRole()),
+		RoleName:        user.GetRoleName(),
 	}
 }
 
@@ -42,6 +66,243 @@ func ToUpdateUserDesc(updateUserFields *desc.UpdateUserFields) *model.UpdateUser
 		updUser.Role = new(model.UserRole)
 		*updUser.Role = model.UserRole(*updateUserFields.Role)
 	}
+	if updateUserFields.RoleName != nil {
+		updUser.RoleName = updateUserFields.RoleName
+	}
 
 	return updUser
 }
+
+// ToDeleteUserDesc converts grpc.DeleteRequest -> model.DeleteUser
+func ToDeleteUserDesc(req *desc.DeleteRequest) *model.DeleteUser {
+	return &model.DeleteUser{
+		ExpectedVersion: req.ExpectedVersion,
+		AllowMissing:    req.GetAllowMissing(),
+	}
+}
+
+// ToChangePasswordDesc converts grpc.ChangePasswordRequest -> model.ChangePassword
+func ToChangePasswordDesc(req *desc.ChangePasswordRequest) *model.ChangePassword {
+	return &model.ChangePassword{
+		CurrentPassword: req.GetCurrentPassword(),
+		NewPassword:     req.GetNewPassword(),
+		ConfirmPassword: req.GetConfirmPassword(),
+	}
+}
+
+// ToCredentialsDesc converts grpc.LoginRequest -> model.Credentials
+func ToCredentialsDesc(req *desc.LoginRequest) *model.Credentials {
+	return &model.Credentials{
+		Username:     req.GetUsername(),
+		Password:     req.GetPassword(),
+		MfaCode:      req.GetMfaCode(),
+		RecoveryCode: req.GetRecoveryCode(),
+	}
+}
+
+// FromMfaRolePolicyDesc converts model.MfaRolePolicy -> grpc.MfaRolePolicy
+func FromMfaRolePolicyDesc(policy *model.MfaRolePolicy) *desc.MfaRolePolicy {
+	return &desc.MfaRolePolicy{
+		Role:     desc.UserRole(policy.Role),
+		RoleName: policy.RoleName,
+		Required: policy.Required,
+	}
+}
+
+// ToMfaRolePolicyDesc converts grpc.MfaRolePolicy -> model.MfaRolePolicy
+func ToMfaRolePolicyDesc(policy *desc.MfaRolePolicy) *model.MfaRolePolicy {
+	return &model.MfaRolePolicy{
+		Role:     model.UserRole(policy.GetRole()),
+		RoleName: policy.GetRoleName(),
+		Required: policy.GetRequired(),
+	}
+}
+
+// FromWebAuthnCredentialDesc converts model.WebAuthnCredential -> grpc.WebAuthnCredential
+func FromWebAuthnCredentialDesc(credential *model.WebAuthnCredential) *desc.WebAuthnCredential {
+	descCredential := &desc.WebAuthnCredential{
+		CredentialId: credential.CredentialID,
+		Name:         credential.Name,
+		Transports:   credential.Transports,
+		SignCount:    credential.SignCount,
+		CreatedAt:    timestamppb.New(credential.CreatedAt),
+	}
+
+	if credential.LastUsedAt != nil {
+		descCredential.LastUsedAt = timestamppb.New(*credential.LastUsedAt)
+	}
+
+	return descCredential
+}
+
+// ToWebAuthnRegistrationDesc converts grpc.FinishWebAuthnRegistrationRequest -> model.WebAuthnRegistration
+func ToWebAuthnRegistrationDesc(req *desc.FinishWebAuthnRegistrationRequest) *model.WebAuthnRegistration {
+	return &model.WebAuthnRegistration{
+		Name:              req.GetName(),
+		ClientDataJSON:    req.GetClientDataJson(),
+		AttestationObject: req.GetAttestationObject(),
+		Transports:        req.GetTransports(),
+	}
+}
+
+// ToWebAuthnAssertionDesc converts grpc.FinishWebAuthnLoginRequest -> model.WebAuthnAssertion
+func ToWebAuthnAssertionDesc(req *desc.FinishWebAuthnLoginRequest) *model.WebAuthnAssertion {
+	return &model.WebAuthnAssertion{
+		CredentialID:      req.GetCredentialId(),
+		ClientDataJSON:    req.GetClientDataJson(),
+		AuthenticatorData: req.GetAuthenticatorData(),
+		Signature:         req.GetSignature(),
+		UserHandle:        req.GetUserHandle(),
+	}
+}
+
+// FromApiKeyDesc converts model.ApiKey -> grpc.ApiKey
+func FromApiKeyDesc(key *model.ApiKey) *desc.ApiKey {
+	descKey := &desc.ApiKey{
+		Id:        key.ID,
+		Name:      key.Name,
+		Hint:      key.Hint,
+		Scopes:    key.Scopes,
+		CreatedAt: timestamppb.New(key.CreatedAt),
+	}
+
+	if key.ExpiresAt != nil {
+		descKey.ExpiresAt = timestamppb.New(*key.ExpiresAt)
+	}
+	if key.LastUsedAt != nil {
+		descKey.LastUsedAt = timestamppb.New(*key.LastUsedAt)
+	}
+
+	return descKey
+}
+
+// ToCreateApiKeyDesc converts grpc.CreateApiKeyRequest -> model.CreateApiKey
+func ToCreateApiKeyDesc(req *desc.CreateApiKeyRequest) *model.CreateApiKey {
+	create := &model.CreateApiKey{
+		Name:   req.GetName(),
+		Scopes: req.GetScopes(),
+	}
+
+	if req.GetExpiresAt() != nil {
+		expiresAt := req.GetExpiresAt().AsTime()
+		create.ExpiresAt = &expiresAt
+	}
+
+	return create
+}
+
+// FromRoleDesc converts model.Role -> grpc.Role
+func FromRoleDesc(role *model.Role) *desc.Role {
+	return &desc.Role{
+		Id:      int32(role.ID),
+		Name:    role.Name,
+		BuiltIn: role.BuiltIn,
+	}
+}
+
+// FromPermissionDesc converts model.Permission -> grpc.Permission
+func FromPermissionDesc(permission *model.Permission) *desc.Permission {
+	return &desc.Permission{
+		Name:        permission.Name,
+		Description: permission.Description,
+	}
+}
+
+// FromOrganizationDesc converts model.Organization -> grpc.Organization
+func FromOrganizationDesc(organization *model.Organization) *desc.Organization {
+	return &desc.Organization{
+		Id:        organization.ID,
+		Name:      organization.Name,
+		CreatedAt: timestamppb.New(organization.CreatedAt),
+	}
+}
+
+// FromGroupDesc converts model.Group -> grpc.Group
+func FromGroupDesc(group *model.Group) *desc.Group {
+	roles := make([]*desc.Role, 0, len(group.Roles))
+	for i := range group.Roles {
+		roles = append(roles, FromRoleDesc(&group.Roles[i]))
+	}
+
+	return &desc.Group{
+		Id:        group.ID,
+		Name:      group.Name,
+		Roles:     roles,
+		CreatedAt: timestamppb.New(group.CreatedAt),
+	}
+}
+
+// groupMemberRequest is implemented by grpc.AddGroupMemberRequest and grpc.RemoveGroupMemberRequest
+type groupMemberRequest interface {
+	GetUsername() string
+	GetMemberGroupName() string
+}
+
+// ToGroupMemberDesc converts grpc group member request -> model.GroupMember
+func ToGroupMemberDesc(req groupMemberRequest) *model.GroupMember {
+	return &model.GroupMember{
+		Username:  req.GetUsername(),
+		GroupName: req.GetMemberGroupName(),
+	}
+}
+
+// FromPolicyResultDesc converts model.PolicyResult -> grpc.DryRunPolicyResponse
+func FromPolicyResultDesc(result *model.PolicyResult) *desc.DryRunPolicyResponse {
+	rules := make([]*desc.PolicyRuleResult, 0, len(result.Rules))
+	for _, rule := range result.Rules {
+		rules = append(rules, &desc.PolicyRuleResult{
+			Name:    rule.Name,
+			Effect:  rule.Effect,
+			Matched: rule.Matched,
+			Error:   rule.Error,
+		})
+	}
+
+	return &desc.DryRunPolicyResponse{
+		Effect: result.Effect,
+		Rules:  rules,
+	}
+}
+
+// ToPolicyDryRunDesc converts grpc.DryRunPolicyRequest -> model.PolicyDryRun
+func ToPolicyDryRunDesc(req *desc.DryRunPolicyRequest) *model.PolicyDryRun {
+	return &model.PolicyDryRun{
+		Method:            req.GetMethod(),
+		Username:          req.GetUsername(),
+		PrincipalUsername: req.GetPrincipalUsername(),
+		Source:            req.GetPolicy(),
+	}
+}
+
+// ToRoleGrantDesc converts grpc.AssignRoleRequest -> model.RoleGrant
+func ToRoleGrantDesc(req *desc.AssignRoleRequest) *model.RoleGrant {
+	grant := &model.RoleGrant{
+		Reason: req.GetReason(),
+	}
+
+	if req.GetValidFrom() != nil {
+		validFrom := req.GetValidFrom().AsTime()
+		grant.ValidFrom = &validFrom
+	}
+	if req.GetValidUntil() != nil {
+		validUntil := req.GetValidUntil().AsTime()
+		grant.ValidUntil = &validUntil
+	}
+
+	return grant
+}
+
+// FromPasswordPolicyDesc converts model.PasswordPolicy -> grpc.PasswordPolicy
+func FromPasswordPolicyDesc(policy *model.PasswordPolicy) *desc.PasswordPolicy {
+	return &desc.PasswordPolicy{
+		MinLength:        int32(policy.MinLength),
+		MaxLength:        int32(policy.MaxLength),
+		RequireLowercase: policy.RequireLowercase,
+		RequireUppercase: policy.RequireUppercase,
+		RequireDigit:     policy.RequireDigit,
+		RequireSymbol:    policy.RequireSymbol,
+		DisallowUsername: policy.DisallowUsername,
+		DisallowEmail:    policy.DisallowEmail,
+		HistoryDepth:     int32(policy.HistoryDepth),
+	}
+}
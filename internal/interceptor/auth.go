@@ -0,0 +1,101 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/tenant"
+)
+
+const (
+	authorizationHeader = "authorization"
+	bearerPrefix        = "bearer "
+)
+
+// Authenticator определяет вызывающего по токену сессии или API-ключу
+type Authenticator interface {
+	Authenticate(ctx context.Context, token string) (*auth.Principal, error)
+}
+
+// Authorizer решает, может ли вызывающий из контекста выполнить метод с запросом req.
+// Для потоковых методов req равен nil
+type Authorizer interface {
+	Authorize(ctx context.Context, fullMethod string, req interface{}) error
+}
+
+// Auth возвращает интерцептор, который проверяет токен из заголовка
+// authorization: Bearer <token>, сохраняет вызывающего в контексте и проверяет права.
+// Запрос без заголовка выполняется анонимно, если это разрешает authorizer
+func Auth(authenticator Authenticator, authorizer Authorizer) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := authenticate(ctx, authenticator)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = authorizer.Authorize(ctx, info.FullMethod, req); err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamAuth то же, что Auth, для потоковых методов
+func StreamAuth(authenticator Authenticator, authorizer Authorizer) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := authenticate(ss.Context(), authenticator)
+		if err != nil {
+			return err
+		}
+
+		if err = authorizer.Authorize(ctx, info.FullMethod, nil); err != nil {
+			return err
+		}
+
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func authenticate(ctx context.Context, authenticator Authenticator) (context.Context, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ctx, nil
+	}
+
+	values := md.Get(authorizationHeader)
+	if len(values) == 0 {
+		return ctx, nil
+	}
+
+	if len(values[0]) <= len(bearerPrefix) || !strings.EqualFold(values[0][:len(bearerPrefix)], bearerPrefix) {
+		return nil, errInvalidAuthorizationHeader
+	}
+
+	principal, err := authenticator.Authenticate(ctx, strings.TrimSpace(values[0][len(bearerPrefix):]))
+	if err != nil {
+		return nil, err
+	}
+
+	// Заголовок x-organization задаёт клиент, поэтому организация запроса
+	// должна совпадать с организацией, которой выдан токен
+	if organizationID, ok := tenant.FromContext(ctx); !ok || organizationID != principal.OrganizationID {
+		return nil, errOrganizationMismatch
+	}
+
+	return auth.NewContext(ctx, principal), nil
+}
+
+// contextStream подменяет контекст потока дополненным контекстом
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
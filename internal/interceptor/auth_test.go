@@ -0,0 +1,70 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/tenant"
+)
+
+// memAuthenticator выдаёт вызывающего по токену
+type memAuthenticator map[string]*auth.Principal
+
+func (a memAuthenticator) Authenticate(_ context.Context, token string) (*auth.Principal, error) {
+	if principal, ok := a[token]; ok {
+		return principal, nil
+	}
+	return nil, errInvalidAuthorizationHeader
+}
+
+type allowAll struct{}
+
+func (allowAll) Authorize(context.Context, string, interface{}) error {
+	return nil
+}
+
+func TestAuthRejectsTokenOfOtherOrganization(t *testing.T) {
+	const otherOrganizationID = model.DefaultOrganizationID + 1
+
+	intercept := Auth(memAuthenticator{
+		"alice": {OrganizationID: model.DefaultOrganizationID, Username: "alice"},
+	}, allowAll{})
+	info := &grpc.UnaryServerInfo{FullMethod: deleteMethod}
+
+	tests := []struct {
+		name           string
+		organizationID int64
+		want           error
+	}{
+		{name: "same organization", organizationID: model.DefaultOrganizationID},
+		{name: "other organization", organizationID: otherOrganizationID, want: errOrganizationMismatch},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(authorizationHeader, "Bearer alice"))
+			ctx = tenant.NewContext(ctx, tt.organizationID)
+
+			called := false
+			handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+				called = true
+				if auth.FromContext(ctx) == nil {
+					t.Fatal("principal not in context")
+				}
+				return nil, nil
+			}
+
+			if _, err := intercept(ctx, nil, info, handler); err != tt.want {
+				t.Fatalf("Auth() err = %v, want %v", err, tt.want)
+			}
+			if called != (tt.want == nil) {
+				t.Fatalf("handler called = %v", called)
+			}
+		})
+	}
+}
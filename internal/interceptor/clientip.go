@@ -0,0 +1,53 @@
+package interceptor
+
+import (
+	"context"
+	"net"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/Slintox/user-service/internal/clientip"
+)
+
+const forwardedForHeader = "x-forwarded-for"
+
+// ClientIP возвращает интерцептор, который определяет адрес клиента.
+// Заголовку X-Forwarded-For можно доверять, только если сервис стоит за прокси,
+// который его перезаписывает, иначе клиент подставит любой адрес
+func ClientIP(trustForwardedFor bool) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if ip := resolveClientIP(ctx, trustForwardedFor); ip != "" {
+			ctx = clientip.NewContext(ctx, ip)
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+func resolveClientIP(ctx context.Context, trustForwardedFor bool) string {
+	if trustForwardedFor {
+		if md, ok := metadata.FromIncomingContext(ctx); ok {
+			if values := md.Get(forwardedForHeader); len(values) > 0 {
+				first, _, _ := strings.Cut(values[0], ",")
+				if ip := net.ParseIP(strings.TrimSpace(first)); ip != nil {
+					return ip.String()
+				}
+			}
+		}
+	}
+
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+
+	return host
+}
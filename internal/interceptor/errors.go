@@ -0,0 +1,16 @@
+package interceptor
+
+import (
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errIdempotencyKeyTooLong       = status.Error(codes.InvalidArgument, "Слишком длинный ключ идемпотентности")
+	errIdempotencyKeyReused        = status.Error(codes.FailedPrecondition, "Ключ идемпотентности уже использован для другого запроса")
+	errIdempotentRequestInProgress = status.Error(codes.Aborted, "Запрос с этим ключом идемпотентности ещё выполняется")
+	errIdempotencyCallerUnknown    = status.Error(codes.InvalidArgument, "Ключ идемпотентности анонимного запроса принимается, только если известен адрес клиента")
+	errUnknownMethod               = status.Error(codes.Internal, "Неизвестный метод")
+	errInvalidAuthorizationHeader  = status.Error(codes.Unauthenticated, "Заголовок authorization должен иметь вид Bearer <token>")
+	errOrganizationMismatch        = status.Error(codes.Unauthenticated, "Токен выдан другой организации")
+)
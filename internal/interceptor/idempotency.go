@@ -0,0 +1,182 @@
+package interceptor
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"log"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/reflect/protoreflect"
+	"google.golang.org/protobuf/reflect/protoregistry"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/clientip"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/repository/idempotency"
+)
+
+// IdempotencyKeyHeader заголовок метаданных, в котором клиент передаёт ключ идемпотентности
+const IdempotencyKeyHeader = "idempotency-key"
+
+const maxIdempotencyKeyLength = 255
+
+// Владелец ключа анонимного запроса. Двоеточие не допускается в именах пользователей,
+// поэтому такой владелец не совпадёт ни с одним пользователем
+const anonymousOwnerPrefix = "anonymous:"
+
+// Idempotency возвращает интерцептор, который сохраняет ответы изменяющих методов
+// по ключу идемпотентности и возвращает их при повторе запроса с тем же ключом.
+// Ключи разных вызывающих не пересекаются: чужой ответ по совпавшему ключу не вернётся.
+// Ключи анонимных запросов разделяются по адресу клиента.
+func Idempotency(repo idempotency.Repository, ttl time.Duration, methods ...string) grpc.UnaryServerInterceptor {
+	mutating := make(map[string]struct{}, len(methods))
+	for _, method := range methods {
+		mutating[method] = struct{}{}
+	}
+
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		if _, ok := mutating[info.FullMethod]; !ok {
+			return handler(ctx, req)
+		}
+
+		key := idempotencyKeyFromContext(ctx)
+		if key == "" {
+			return handler(ctx, req)
+		}
+		if len(key) > maxIdempotencyKeyLength {
+			return nil, errIdempotencyKeyTooLong
+		}
+
+		owner := idempotencyOwner(ctx)
+		if owner == "" {
+			return nil, errIdempotencyCallerUnknown
+		}
+
+		requestHash, err := hashRequest(req)
+		if err != nil {
+			return nil, err
+		}
+
+		reservation := &model.IdempotencyRecord{
+			Key:         key,
+			Method:      info.FullMethod,
+			Username:    owner,
+			RequestHash: requestHash,
+		}
+
+		record, reserved, err := repo.Reserve(ctx, reservation, ttl)
+		if err != nil {
+			return nil, err
+		}
+
+		if !reserved {
+			return replay(info.FullMethod, record, requestHash)
+		}
+
+		resp, err := handler(ctx, req)
+		if err != nil {
+			// Ошибки не сохраняются, чтобы клиент мог повторить запрос с тем же ключом
+			if releaseErr := repo.Release(ctx, reservation); releaseErr != nil {
+				log.Printf("interceptor.Idempotency: failed to release key: %s", releaseErr.Error())
+			}
+			return nil, err
+		}
+
+		respBytes, err := proto.Marshal(resp.(proto.Message))
+		if err != nil {
+			return nil, err
+		}
+
+		if err = repo.Complete(ctx, reservation, respBytes); err != nil {
+			log.Printf("interceptor.Idempotency: failed to store response: %s", err.Error())
+		}
+
+		return resp, nil
+	}
+}
+
+func idempotencyKeyFromContext(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	values := md.Get(IdempotencyKeyHeader)
+	if len(values) == 0 {
+		return ""
+	}
+
+	return strings.TrimSpace(values[0])
+}
+
+// idempotencyOwner возвращает вызывающего, которому принадлежит ключ, а для анонимного
+// запроса - адрес клиента. Пустая строка, если не известно ни то, ни другое
+func idempotencyOwner(ctx context.Context) string {
+	if principal := auth.FromContext(ctx); principal != nil {
+		return principal.Username
+	}
+
+	if ip := clientip.FromContext(ctx); ip != "" {
+		return anonymousOwnerPrefix + ip
+	}
+
+	return ""
+}
+
+func hashRequest(req interface{}) (string, error) {
+	reqBytes, err := proto.MarshalOptions{Deterministic: true}.Marshal(req.(proto.Message))
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(reqBytes)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+func replay(fullMethod string, record *model.IdempotencyRecord, requestHash string) (interface{}, error) {
+	if record.RequestHash != requestHash {
+		return nil, errIdempotencyKeyReused
+	}
+
+	if record.Response == nil {
+		return nil, errIdempotentRequestInProgress
+	}
+
+	resp, err := newResponse(fullMethod)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = proto.Unmarshal(record.Response, resp); err != nil {
+		return nil, err
+	}
+
+	return resp, nil
+}
+
+// newResponse создаёт пустое сообщение ответа для метода вида "/package.Service/Method"
+func newResponse(fullMethod string) (proto.Message, error) {
+	name := protoreflect.FullName(strings.ReplaceAll(strings.TrimPrefix(fullMethod, "/"), "/", "."))
+
+	d, err := protoregistry.GlobalFiles.FindDescriptorByName(name)
+	if err != nil {
+		return nil, err
+	}
+
+	method, ok := d.(protoreflect.MethodDescriptor)
+	if !ok {
+		return nil, errUnknownMethod
+	}
+
+	msgType, err := protoregistry.GlobalTypes.FindMessageByName(method.Output().FullName())
+	if err != nil {
+		return nil, err
+	}
+
+	return msgType.New().Interface(), nil
+}
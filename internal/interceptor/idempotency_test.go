@@ -0,0 +1,209 @@
+package interceptor
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/clientip"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/repository/idempotency"
+	desc "github.com/Slintox/user-service/pkg/user_v1"
+)
+
+const deleteMethod = "/user_v1.UserV1/Delete"
+
+// memIdempotencyRepo хранит записи в памяти по тому же ключу, что и таблица
+type memIdempotencyRepo struct {
+	idempotency.Repository
+	records map[string]*model.IdempotencyRecord
+}
+
+func recordID(record *model.IdempotencyRecord) string {
+	return record.Username + " " + record.Method + " " + record.Key
+}
+
+func (r *memIdempotencyRepo) Reserve(_ context.Context, record *model.IdempotencyRecord, _ time.Duration) (*model.IdempotencyRecord, bool, error) {
+	if existing, ok := r.records[recordID(record)]; ok {
+		return existing, false, nil
+	}
+
+	stored := *record
+	r.records[recordID(record)] = &stored
+
+	return record, true, nil
+}
+
+func (r *memIdempotencyRepo) Complete(_ context.Context, record *model.IdempotencyRecord, response []byte) error {
+	r.records[recordID(record)].Response = response
+	return nil
+}
+
+func (r *memIdempotencyRepo) Release(_ context.Context, record *model.IdempotencyRecord) error {
+	delete(r.records, recordID(record))
+	return nil
+}
+
+func TestIdempotencyKeysArePerCaller(t *testing.T) {
+	repo := &memIdempotencyRepo{records: make(map[string]*model.IdempotencyRecord)}
+	intercept := Idempotency(repo, time.Hour, deleteMethod)
+	info := &grpc.UnaryServerInfo{FullMethod: deleteMethod}
+	req := &desc.DeleteRequest{Username: "carol"}
+
+	call := func(username string) (*desc.DeleteResponse, int) {
+		calls := 0
+		handler := func(ctx context.Context, _ interface{}) (interface{}, error) {
+			calls++
+			return &desc.DeleteResponse{User: &desc.User{Username: auth.FromContext(ctx).Username}}, nil
+		}
+
+		ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(IdempotencyKeyHeader, "same-key"))
+		ctx = auth.NewContext(ctx, &auth.Principal{Username: username})
+
+		resp, err := intercept(ctx, req, info, handler)
+		if err != nil {
+			t.Fatalf("%s: %v", username, err)
+		}
+
+		return resp.(*desc.DeleteResponse), calls
+	}
+
+	if _, calls := call("alice"); calls != 1 {
+		t.Fatalf("alice: handler called %d times, want 1", calls)
+	}
+
+	// Тот же ключ другого вызывающего - новый запрос, а не ответ alice
+	resp, calls := call("bob")
+	if calls != 1 {
+		t.Fatalf("bob: handler called %d times, want 1", calls)
+	}
+	if resp.GetUser().GetUsername() != "bob" {
+		t.Fatalf("bob got response of %q", resp.GetUser().GetUsername())
+	}
+
+	// Повтор alice возвращает её сохранённый ответ
+	resp, calls = call("alice")
+	if calls != 0 {
+		t.Fatalf("alice replay: handler called %d times, want 0", calls)
+	}
+	if resp.GetUser().GetUsername() != "alice" {
+		t.Fatalf("alice replay got response of %q", resp.GetUser().GetUsername())
+	}
+}
+
+// idempotentCall вызывает интерцептор с ключом key от имени ctx и считает вызовы обработчика
+type idempotentCall struct {
+	intercept grpc.UnaryServerInterceptor
+	calls     int
+}
+
+func newIdempotentCall() (*idempotentCall, *memIdempotencyRepo) {
+	repo := &memIdempotencyRepo{records: make(map[string]*model.IdempotencyRecord)}
+	return &idempotentCall{intercept: Idempotency(repo, time.Hour, deleteMethod)}, repo
+}
+
+func (c *idempotentCall) do(ctx context.Context, key string, req *desc.DeleteRequest) (*desc.DeleteResponse, error) {
+	ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(IdempotencyKeyHeader, key))
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		c.calls++
+		return &desc.DeleteResponse{User: &desc.User{Username: req.(*desc.DeleteRequest).GetUsername()}}, nil
+	}
+
+	resp, err := c.intercept(ctx, req, &grpc.UnaryServerInfo{FullMethod: deleteMethod}, handler)
+	if err != nil {
+		return nil, err
+	}
+
+	return resp.(*desc.DeleteResponse), nil
+}
+
+func TestIdempotencyReplaysStoredResponse(t *testing.T) {
+	call, _ := newIdempotentCall()
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Username: "alice"})
+
+	first, err := call.do(ctx, "key", &desc.DeleteRequest{Username: "carol"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	replayed, err := call.do(ctx, "key", &desc.DeleteRequest{Username: "carol"})
+	if err != nil {
+		t.Fatalf("replay: %v", err)
+	}
+	if call.calls != 1 {
+		t.Fatalf("handler called %d times, want 1", call.calls)
+	}
+	if !proto.Equal(first, replayed) {
+		t.Fatalf("replayed %v, want %v", replayed, first)
+	}
+}
+
+func TestIdempotencyKeyReusedForOtherRequest(t *testing.T) {
+	call, _ := newIdempotentCall()
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Username: "alice"})
+
+	if _, err := call.do(ctx, "key", &desc.DeleteRequest{Username: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := call.do(ctx, "key", &desc.DeleteRequest{Username: "dave"}); err != errIdempotencyKeyReused {
+		t.Fatalf("err = %v, want %v", err, errIdempotencyKeyReused)
+	}
+	if call.calls != 1 {
+		t.Fatalf("handler called %d times, want 1", call.calls)
+	}
+}
+
+func TestIdempotentRequestInProgress(t *testing.T) {
+	call, repo := newIdempotentCall()
+	ctx := auth.NewContext(context.Background(), &auth.Principal{Username: "alice"})
+	req := &desc.DeleteRequest{Username: "carol"}
+
+	// Исходный запрос зарезервировал ключ, но ещё не сохранил ответ
+	requestHash, err := hashRequest(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err = repo.Reserve(ctx, &model.IdempotencyRecord{
+		Key:         "key",
+		Method:      deleteMethod,
+		Username:    "alice",
+		RequestHash: requestHash,
+	}, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = call.do(ctx, "key", req); err != errIdempotentRequestInProgress {
+		t.Fatalf("err = %v, want %v", err, errIdempotentRequestInProgress)
+	}
+	if call.calls != 0 {
+		t.Fatalf("handler called %d times, want 0", call.calls)
+	}
+}
+
+// Анонимные запросы с одним ключом с разных адресов не получают ответы друг друга
+func TestIdempotencyKeysOfAnonymousCallersArePerAddress(t *testing.T) {
+	call, _ := newIdempotentCall()
+	ctx := context.Background()
+
+	if _, err := call.do(clientip.NewContext(ctx, "192.0.2.1"), "key", &desc.DeleteRequest{Username: "carol"}); err != nil {
+		t.Fatal(err)
+	}
+
+	resp, err := call.do(clientip.NewContext(ctx, "192.0.2.2"), "key", &desc.DeleteRequest{Username: "dave"})
+	if err != nil {
+		t.Fatalf("other address: %v", err)
+	}
+	if call.calls != 2 || resp.GetUser().GetUsername() != "dave" {
+		t.Fatalf("handler called %d times, response %v", call.calls, resp)
+	}
+
+	if _, err = call.do(ctx, "key", &desc.DeleteRequest{Username: "carol"}); err != errIdempotencyCallerUnknown {
+		t.Fatalf("unknown address: err = %v, want %v", err, errIdempotencyCallerUnknown)
+	}
+}
@@ -0,0 +1,66 @@
+package interceptor
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/metadata"
+
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/tenant"
+)
+
+const organizationHeader = "x-organization"
+
+// OrganizationResolver определяет организацию по имени
+type OrganizationResolver interface {
+	ResolveOrganization(ctx context.Context, name string) (int64, error)
+}
+
+// Tenant возвращает интерцептор, который сохраняет в контексте организацию
+// из заголовка x-organization, без заголовка - организацию по умолчанию.
+// Стоит перед Auth: токен проверяется в пределах этой организации,
+// а Auth отклоняет токен, выданный другой организации
+func Tenant(resolver OrganizationResolver) grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		ctx, err := resolveTenant(ctx, resolver)
+		if err != nil {
+			return nil, err
+		}
+
+		return handler(ctx, req)
+	}
+}
+
+// StreamTenant то же, что Tenant, для потоковых методов
+func StreamTenant(resolver OrganizationResolver) grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, _ *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx, err := resolveTenant(ss.Context(), resolver)
+		if err != nil {
+			return err
+		}
+
+		return handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+	}
+}
+
+func resolveTenant(ctx context.Context, resolver OrganizationResolver) (context.Context, error) {
+	var name string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(organizationHeader); len(values) > 0 {
+			name = strings.TrimSpace(values[0])
+		}
+	}
+
+	if name == "" {
+		return tenant.NewContext(ctx, model.DefaultOrganizationID), nil
+	}
+
+	organizationID, err := resolver.ResolveOrganization(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	return tenant.NewContext(ctx, organizationID), nil
+}
@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+const namespace = "user_service"
+
+var (
+	// BreachedPasswordHits считает пароли, отклонённые как найденные в утечках
+	BreachedPasswordHits = promauto.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "breached_password_hits_total",
+		Help:      "Number of passwords rejected because they were found in the breached passwords corpus.",
+	})
+)
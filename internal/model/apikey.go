@@ -0,0 +1,31 @@
+package model
+
+import "time"
+
+// Области действия API-ключа. ApiKeyScopeAll даёт ключу все права владельца
+const (
+	ApiKeyScopeRead  = "read"
+	ApiKeyScopeWrite = "write"
+	ApiKeyScopeAll   = "all"
+)
+
+// ApiKey описывает персональный ключ для доступа скриптов без входа
+type ApiKey struct {
+	ID             int64
+	OrganizationID int64
+	Username       string
+	Name           string
+	Key            string // Заполняется только при создании, в базе хранится хеш
+	Hint           string // Начало ключа, по которому его можно узнать в списке
+	Scopes         []string
+	CreatedAt      time.Time
+	ExpiresAt      *time.Time
+	LastUsedAt     *time.Time
+}
+
+// CreateApiKey описывает параметры нового API-ключа
+type CreateApiKey struct {
+	Name      string
+	Scopes    []string
+	ExpiresAt *time.Time
+}
@@ -0,0 +1,56 @@
+package model
+
+import "time"
+
+// Типы событий
+const (
+	EventUserLocked   = "user.locked"
+	EventUserUnlocked = "user.unlocked"
+	EventIPBlocked    = "ip.blocked"
+
+	EventPasswordReset = "user.password_reset"
+	EventEmailVerified = "user.email_verified"
+
+	EventEmailChanged         = "user.email_changed"
+	EventEmailChangeCancelled = "user.email_change_cancelled"
+
+	EventMfaEnabled          = "user.mfa_enabled"
+	EventMfaDisabled         = "user.mfa_disabled"
+	EventMfaRecoveryCodeUsed = "user.mfa_recovery_code_used"
+
+	EventWebAuthnRegistered     = "user.webauthn_registered"
+	EventWebAuthnCloneSuspected = "user.webauthn_clone_suspected"
+
+	EventApiKeyCreated = "user.api_key_created"
+	EventApiKeyRevoked = "user.api_key_revoked"
+
+	EventRoleCreated = "role.created"
+	EventRoleRenamed = "role.renamed"
+	EventRoleDeleted = "role.deleted"
+
+	EventRoleAssigned   = "user.role_assigned"
+	EventRoleUnassigned = "user.role_unassigned"
+	EventRoleExpired    = "user.role_expired"
+
+	EventPermissionGranted = "role.permission_granted"
+	EventPermissionRevoked = "role.permission_revoked"
+
+	EventOrganizationCreated = "organization.created"
+
+	EventGroupCreated        = "group.created"
+	EventGroupRenamed        = "group.renamed"
+	EventGroupDeleted        = "group.deleted"
+	EventGroupMemberAdded    = "group.member_added"
+	EventGroupMemberRemoved  = "group.member_removed"
+	EventGroupRoleAssigned   = "group.role_assigned"
+	EventGroupRoleUnassigned = "group.role_unassigned"
+)
+
+// Event описывает событие, сохраняемое для аудита и внешних потребителей
+type Event struct {
+	ID        int64
+	Type      string
+	Subject   string // Имя пользователя или другой объект события
+	Payload   map[string]interface{}
+	CreatedAt time.Time
+}
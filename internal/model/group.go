@@ -0,0 +1,33 @@
+package model
+
+import "time"
+
+// Group описывает группу пользователей. Группа может входить в другие группы,
+// её участники наследуют роли всех групп, в которые она входит прямо или косвенно
+type Group struct {
+	ID   int64
+	Name string
+	// Роли, назначенные самой группе
+	Roles     []Role
+	CreatedAt time.Time
+}
+
+// GroupMembers описывает участников группы
+type GroupMembers struct {
+	Usernames  []string
+	GroupNames []string
+}
+
+// GroupMembership описывает вхождение пользователя в группу
+type GroupMembership struct {
+	GroupName string
+	// Пользователь добавлен в группу сам, а не через вложенную группу
+	Direct bool
+}
+
+// GroupMember описывает участника группы: пользователя или вложенную группу.
+// Заполняется ровно одно из полей
+type GroupMember struct {
+	Username  string
+	GroupName string
+}
@@ -0,0 +1,14 @@
+package model
+
+import "time"
+
+// IdempotencyRecord описывает сохранённый результат запроса с ключом идемпотентности
+type IdempotencyRecord struct {
+	Key         string
+	Method      string
+	Username    string // вызывающий; для анонимного запроса anonymous:<IP-адрес клиента>
+	RequestHash string
+	Response    []byte // nil, пока исходный запрос не завершён
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
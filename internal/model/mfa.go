@@ -0,0 +1,34 @@
+package model
+
+import "time"
+
+// Mfa описывает второй фактор пользователя (TOTP)
+type Mfa struct {
+	Username     string
+	Secret       string // base32
+	CreatedAt    time.Time
+	ConfirmedAt  *time.Time // nil, пока подключение не подтверждено первым кодом
+	LastUsedStep int64
+}
+
+// MfaEnrollment описывает начатое подключение второго фактора
+type MfaEnrollment struct {
+	Secret string
+	URI    string // otpauth:// для QR-кода
+}
+
+// MfaRolePolicy описывает, обязателен ли второй фактор для роли
+type MfaRolePolicy struct {
+	Role     UserRole
+	RoleName string // Если указано, используется вместо Role
+	Required bool
+}
+
+// Credentials описывает данные для входа. MfaCode или RecoveryCode
+// нужны, если у пользователя подключён второй фактор
+type Credentials struct {
+	Username     string
+	Password     string
+	MfaCode      string
+	RecoveryCode string
+}
@@ -0,0 +1,16 @@
+package model
+
+import "time"
+
+// DefaultOrganizationID организация запросов без заголовка организации.
+// Ей принадлежат данные, созданные до разделения по организациям, и только
+// её пользователи управляют организациями и общим справочником ролей
+const DefaultOrganizationID int64 = 1
+
+// Organization описывает организацию (арендатора), в пределах которой
+// уникальны имена и адреса пользователей
+type Organization struct {
+	ID        int64
+	Name      string
+	CreatedAt time.Time
+}
@@ -0,0 +1,14 @@
+package model
+
+// PasswordPolicy описывает требования к паролю
+type PasswordPolicy struct {
+	MinLength        int // В символах
+	MaxLength        int // В байтах
+	RequireLowercase bool
+	RequireUppercase bool
+	RequireDigit     bool
+	RequireSymbol    bool
+	DisallowUsername bool // Пароль не должен содержать имя пользователя
+	DisallowEmail    bool // Пароль не должен содержать email или его локальную часть
+	HistoryDepth     int  // Сколько предыдущих паролей нельзя использовать повторно
+}
@@ -0,0 +1,42 @@
+package model
+
+// Разрешения, которые создают миграции. Проверки прав используют только эти константы
+const (
+	// Пользователи
+	PermissionReadUsers             = "users.read"
+	PermissionUpdateUsers           = "users.update"
+	PermissionDeleteUsers           = "users.delete"
+	PermissionUnlockUsers           = "users.unlock"
+	PermissionChangePassword        = "users.change_password"
+	PermissionSetPassword           = "users.set_password"
+	PermissionResendVerification    = "users.resend_verification"
+	PermissionReadPasswordHashStats = "password_hash_stats.read"
+
+	// Второй фактор, ключи WebAuthn и API-ключи
+	PermissionManageMfa       = "mfa.manage"
+	PermissionReadMfaPolicy   = "mfa_policy.read"
+	PermissionUpdateMfaPolicy = "mfa_policy.update"
+	PermissionManageWebAuthn  = "webauthn.manage"
+	PermissionReadWebAuthn    = "webauthn.read"
+	PermissionManageApiKeys   = "api_keys.manage"
+	PermissionReadApiKeys     = "api_keys.read"
+
+	// Роли, разрешения и группы
+	PermissionManageRoles       = "roles.manage"
+	PermissionReadRoles         = "roles.read"
+	PermissionAssignRoles       = "roles.assign"
+	PermissionManagePermissions = "permissions.manage"
+	PermissionReadPermissions   = "permissions.read"
+	PermissionManageGroups      = "groups.manage"
+	PermissionReadGroups        = "groups.read"
+
+	// Организации и политики
+	PermissionManageOrganizations = "organizations.manage"
+	PermissionDryRunPolicies      = "policies.dry_run"
+)
+
+// Permission описывает разрешение, которое выдаётся ролям
+type Permission struct {
+	Name        string
+	Description string
+}
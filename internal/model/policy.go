@@ -0,0 +1,38 @@
+package model
+
+// Действие правила политики доступа
+const (
+	PolicyEffectAllow = "allow"
+	PolicyEffectDeny  = "deny"
+)
+
+// PolicyResult описывает проверку запроса правилами политик доступа
+type PolicyResult struct {
+	// PolicyEffectDeny, если сработало хотя бы одно запрещающее правило,
+	// PolicyEffectAllow, если сработали только разрешающие, иначе пусто
+	Effect string
+	// Правила, которые относятся к методу запроса
+	Rules []PolicyRuleResult
+}
+
+// PolicyRuleResult описывает проверку одного правила
+type PolicyRuleResult struct {
+	Name    string
+	Effect  string
+	Matched bool
+	// Ошибка вычисления условия. Запрещающее правило с ошибкой
+	// считается сработавшим, разрешающее - нет
+	Error string
+}
+
+// PolicyDryRun описывает пробную проверку запроса политиками доступа
+type PolicyDryRun struct {
+	// Короткое имя метода UserV1, например Update
+	Method string
+	// Пользователь, к которому относится запрос. Пусто - запрос без пользователя
+	Username string
+	// От чьего имени выполняется запрос. Пусто - от имени вызывающего
+	PrincipalUsername string
+	// Текст черновика политики. Пусто - проверяются загруженные политики
+	Source string
+}
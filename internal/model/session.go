@@ -0,0 +1,23 @@
+package model
+
+import "time"
+
+// Session описывает сессию пользователя после входа
+type Session struct {
+	ID             int64
+	OrganizationID int64
+	Username       string
+	Token          string // Заполняется только при создании, в базе хранится хеш
+	CreatedAt      time.Time
+	ExpiresAt      time.Time
+
+	// Второй фактор обязателен для роли пользователя, но ещё не подключён.
+	// До подключения сессия позволяет только подключить его
+	MfaEnrollmentRequired bool
+}
+
+// PasswordResetToken описывает одноразовый токен сброса пароля
+type PasswordResetToken struct {
+	Username  string
+	ExpiresAt time.Time
+}
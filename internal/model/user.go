@@ -6,14 +6,70 @@ import (
 
 type UserRole int
 
+// Встроенные роли. Остальные роли создаются через API и различаются по имени
+const (
+	UserRoleUser  UserRole = 1
+	UserRoleAdmin UserRole = 2
+)
+
+// Role описывает роль пользователя
+type Role struct {
+	ID      UserRole
+	Name    string // Unique
+	BuiltIn bool   // Встроенную роль нельзя переименовать или удалить
+}
+
 // User описывает модель пользователя
 type User struct {
 	Username  string // Unique
 	Email     string
 	Password  string
-	Role      UserRole
+	Roles     []Role // Только id и имя
 	CreatedAt time.Time
 	UpdatedAt time.Time
+	Version   int64 // Увеличивается при каждом обновлении
+
+	EmailVerifiedAt *time.Time // nil, пока email не подтверждён
+}
+
+// RoleIDs возвращает id назначенных пользователю ролей
+func (u *User) RoleIDs() []UserRole {
+	ids := make([]UserRole, 0, len(u.Roles))
+	for _, role := range u.Roles {
+		ids = append(ids, role.ID)
+	}
+
+	return ids
+}
+
+// PrimaryRole возвращает одну роль для клиентов, которые ожидают единственную роль:
+// администратора, затем пользователя, затем первую назначенную. nil, если ролей нет
+func (u *User) PrimaryRole() *Role {
+	if len(u.Roles) == 0 {
+		return nil
+	}
+
+	primary := &u.Roles[0]
+	for i := range u.Roles {
+		switch u.Roles[i].ID {
+		case UserRoleAdmin:
+			return &u.Roles[i]
+		case UserRoleUser:
+			primary = &u.Roles[i]
+		}
+	}
+
+	return primary
+}
+
+// RoleGrant описывает назначение роли пользователю. Назначение действует
+// с ValidFrom до ValidUntil, пустые границы не ограничивают срок
+type RoleGrant struct {
+	Username   string
+	Role       Role
+	ValidFrom  *time.Time
+	ValidUntil *time.Time
+	Reason     string
 }
 
 // CreateUser описывает модель для создания нового пользователя
@@ -22,7 +78,8 @@ type CreateUser struct {
 	Email           string
 	Password        string
 	ConfirmPassword string
-	Role            UserRole
+	Role            UserRole // Начальная роль
+	RoleName        string   // Если указано, используется вместо Role
 }
 
 // UpdateUser описывает модель для обновления пользователя
@@ -30,5 +87,32 @@ type UpdateUser struct {
 	Username *string
 	Email    *string
 	Password *string
-	Role     *UserRole
+	Role     *UserRole // Заменяет все роли пользователя одной
+	RoleName *string   // Если указано, используется вместо Role
+}
+
+// ChangePassword описывает смену пароля самим пользователем
+type ChangePassword struct {
+	CurrentPassword string
+	NewPassword     string
+	ConfirmPassword string
+}
+
+// DeleteUser описывает параметры удаления пользователя
+type DeleteUser struct {
+	ExpectedVersion *int64 // Если указана, удаление выполняется только при совпадении версии
+	AllowMissing    bool   // Отсутствие пользователя не считается ошибкой
+}
+
+// EmailChange описывает запрос на смену email. Новый адрес применяется
+// после подтверждения, а прежний может отменить смену в течение льготного периода
+type EmailChange struct {
+	ID          int64
+	Username    string
+	OldEmail    string
+	NewEmail    string
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+	ConfirmedAt *time.Time
+	CancelledAt *time.Time
 }
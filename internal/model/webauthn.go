@@ -0,0 +1,47 @@
+package model
+
+import "time"
+
+// Церемонии WebAuthn, для которых выдаётся challenge
+const (
+	WebAuthnCeremonyRegistration = "registration"
+	WebAuthnCeremonyLogin        = "login"
+)
+
+// WebAuthnCredential описывает ключ доступа (passkey) или ключ безопасности пользователя
+type WebAuthnCredential struct {
+	Username     string
+	CredentialID []byte
+	Name         string
+	PublicKey    []byte // COSE_Key
+	SignCount    uint32
+	Transports   []string
+	AAGUID       []byte
+	CreatedAt    time.Time
+	LastUsedAt   *time.Time
+}
+
+// WebAuthnChallenge описывает выданный challenge. Username пустой
+// для входа без указания имени, когда пользователь определяется по ключу
+type WebAuthnChallenge struct {
+	Challenge []byte
+	Ceremony  string
+	Username  string
+}
+
+// WebAuthnRegistration описывает ответ аутентификатора при регистрации ключа
+type WebAuthnRegistration struct {
+	Name              string
+	ClientDataJSON    []byte
+	AttestationObject []byte
+	Transports        []string
+}
+
+// WebAuthnAssertion описывает ответ аутентификатора при входе
+type WebAuthnAssertion struct {
+	CredentialID      []byte
+	ClientDataJSON    []byte
+	AuthenticatorData []byte
+	Signature         []byte
+	UserHandle        []byte
+}
@@ -0,0 +1,9 @@
+package normalize
+
+import "strings"
+
+// Email приводит адрес электронной почты к канонической форме,
+// по которой выполняются поиск и проверка уникальности.
+func Email(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
@@ -0,0 +1,64 @@
+package normalize
+
+import (
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+// Username приводит имя пользователя к канонической форме (NFKC + case folding),
+// по которой выполняются поиск и проверка уникальности.
+// Отображаемая форма имени при этом хранится так, как её ввёл пользователь.
+func Username(username string) string {
+	username = norm.NFKC.String(strings.TrimSpace(username))
+	return norm.NFKC.String(cases.Fold().String(username))
+}
+
+// HasMixedScripts сообщает, содержит ли строка буквы из разных письменностей,
+// например латинскую "a" и кириллическую "а". Такие имена позволяют
+// зарегистрировать визуально неотличимую копию чужого имени.
+func HasMixedScripts(s string) bool {
+	var found *unicode.RangeTable
+
+	for _, r := range s {
+		if !unicode.IsLetter(r) {
+			continue
+		}
+
+		script := scriptOf(r)
+		if script == nil {
+			continue
+		}
+
+		if found == nil {
+			found = script
+			continue
+		}
+		if found != script {
+			return true
+		}
+	}
+
+	return false
+}
+
+// scriptOf возвращает письменность буквы. Японские слоговые азбуки
+// считаются одной письменностью с иероглифами, так как используются вместе.
+func scriptOf(r rune) *unicode.RangeTable {
+	if unicode.In(r, unicode.Hiragana, unicode.Katakana) {
+		return unicode.Han
+	}
+
+	for _, script := range unicode.Scripts {
+		if script == unicode.Common || script == unicode.Inherited {
+			continue
+		}
+		if unicode.Is(script, r) {
+			return script
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,63 @@
+package notifier
+
+import (
+	"context"
+	"log"
+	"sort"
+	"strings"
+)
+
+// Виды уведомлений
+const (
+	KindPasswordReset      = "password_reset"
+	KindEmailVerification  = "email_verification"
+	KindEmailChangeConfirm = "email_change_confirm"
+	KindEmailChangeNotice  = "email_change_notice"
+)
+
+// Notification описывает сообщение пользователю. Data содержит значения
+// для шаблона сообщения, например токен и срок его действия
+type Notification struct {
+	Kind     string
+	To       string // Адрес электронной почты
+	Username string
+	Data     map[string]string
+}
+
+// Notifier доставляет уведомления пользователям (почта, очередь и т.п.)
+type Notifier interface {
+	Notify(ctx context.Context, n *Notification) error
+}
+
+// Значения ключей с этим суффиксом (token, cancel_token) дают доступ к учётной записи
+const secretKeySuffix = "token"
+
+type logNotifier struct{}
+
+// NewLogNotifier возвращает Notifier, который только пишет уведомления в лог,
+// скрывая токены. Только для разработки, в продакшене используется NewSMTPNotifier
+func NewLogNotifier() Notifier {
+	return &logNotifier{}
+}
+
+func (n *logNotifier) Notify(_ context.Context, notification *Notification) error {
+	keys := make([]string, 0, len(notification.Data))
+	for key := range notification.Data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fields := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value := notification.Data[key]
+		if strings.HasSuffix(key, secretKeySuffix) {
+			value = "[redacted]"
+		}
+		fields = append(fields, key+"="+value)
+	}
+
+	log.Printf("notification %s to %s (%s): %s",
+		notification.Kind, notification.To, notification.Username, strings.Join(fields, " "))
+
+	return nil
+}
@@ -0,0 +1,62 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"log"
+	"strings"
+	"testing"
+
+	"github.com/Slintox/user-service/config"
+)
+
+func TestLogNotifierRedactsTokens(t *testing.T) {
+	var buf bytes.Buffer
+	out := log.Writer()
+	log.SetOutput(&buf)
+	defer log.SetOutput(out)
+
+	err := NewLogNotifier().Notify(context.Background(), &Notification{
+		Kind:     KindEmailChangeNotice,
+		To:       "old@example.com",
+		Username: "alice",
+		Data: map[string]string{
+			"new_email":    "new@example.com",
+			"cancel_token": "secret-cancel",
+			"token":        "secret-confirm",
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	logged := buf.String()
+	if strings.Contains(logged, "secret-") {
+		t.Fatalf("token leaked to log: %s", logged)
+	}
+	if !strings.Contains(logged, "new_email=new@example.com") {
+		t.Fatalf("non-secret data missing from log: %s", logged)
+	}
+}
+
+func TestSMTPNotifierCompose(t *testing.T) {
+	n := &smtpNotifier{cfg: &config.SMTPConfig{From: "no-reply@example.com"}}
+
+	for kind := range messages {
+		msg, err := n.compose(&Notification{
+			Kind: kind,
+			To:   "alice@example.com",
+			Data: map[string]string{"token": "abc", "cancel_token": "abc", "expires_in": "1h0m0s", "new_email": "new@example.com"},
+		})
+		if err != nil {
+			t.Fatalf("%s: %v", kind, err)
+		}
+		if !bytes.Contains(msg, []byte("To: alice@example.com\r\n")) || !bytes.Contains(msg, []byte("abc\r\n")) {
+			t.Fatalf("%s: unexpected message %q", kind, msg)
+		}
+	}
+
+	if _, err := n.compose(&Notification{Kind: "unknown"}); err == nil {
+		t.Fatal("unknown kind must be rejected")
+	}
+}
@@ -0,0 +1,147 @@
+package notifier
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"text/template"
+	"time"
+
+	"github.com/Slintox/user-service/config"
+)
+
+type message struct {
+	subject string
+	body    *template.Template
+}
+
+// Тексты писем по видам уведомлений. Поля шаблона - ключи Notification.Data
+var messages = map[string]message{
+	KindPasswordReset: {
+		subject: "Сброс пароля",
+		body: template.Must(template.New(KindPasswordReset).Parse(
+			"Код для сброса пароля: {{.token}}\n" +
+				"Код действует {{.expires_in}}. Если вы не запрашивали сброс, проигнорируйте это письмо.\n")),
+	},
+	KindEmailVerification: {
+		subject: "Подтверждение email",
+		body: template.Must(template.New(KindEmailVerification).Parse(
+			"Код для подтверждения email: {{.token}}\n" +
+				"Код действует {{.expires_in}}.\n")),
+	},
+	KindEmailChangeConfirm: {
+		subject: "Подтверждение нового email",
+		body: template.Must(template.New(KindEmailChangeConfirm).Parse(
+			"Код для подтверждения нового email: {{.token}}\n" +
+				"Код действует {{.expires_in}}.\n")),
+	},
+	KindEmailChangeNotice: {
+		subject: "Смена email",
+		body: template.Must(template.New(KindEmailChangeNotice).Parse(
+			"Для вашей учётной записи запрошена смена email на {{.new_email}}.\n" +
+				"Если это были не вы, отмените смену кодом: {{.cancel_token}}\n" +
+				"Код действует {{.expires_in}}.\n")),
+	},
+}
+
+type smtpNotifier struct {
+	cfg *config.SMTPConfig
+}
+
+// NewSMTPNotifier возвращает Notifier, который отправляет уведомления письмами
+// через SMTP-сервер. Если сервер поддерживает STARTTLS, соединение шифруется
+func NewSMTPNotifier(cfg *config.SMTPConfig) Notifier {
+	return &smtpNotifier{cfg: cfg}
+}
+
+func (n *smtpNotifier) Notify(ctx context.Context, notification *Notification) error {
+	msg, err := n.compose(notification)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, n.cfg.Timeout)
+	defer cancel()
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(n.cfg.Host, strconv.Itoa(n.cfg.Port)))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err = conn.SetDeadline(deadline); err != nil {
+			return err
+		}
+	}
+
+	client, err := smtp.NewClient(conn, n.cfg.Host)
+	if err != nil {
+		return err
+	}
+	defer client.Close()
+
+	if ok, _ := client.Extension("STARTTLS"); ok {
+		if err = client.StartTLS(&tls.Config{ServerName: n.cfg.Host}); err != nil {
+			return err
+		}
+	}
+
+	if n.cfg.Username != "" {
+		if err = client.Auth(smtp.PlainAuth("", n.cfg.Username, n.cfg.Password, n.cfg.Host)); err != nil {
+			return err
+		}
+	}
+
+	if err = client.Mail(n.cfg.From); err != nil {
+		return err
+	}
+	if err = client.Rcpt(notification.To); err != nil {
+		return err
+	}
+
+	w, err := client.Data()
+	if err != nil {
+		return err
+	}
+	if _, err = w.Write(msg); err != nil {
+		return err
+	}
+	if err = w.Close(); err != nil {
+		return err
+	}
+
+	return client.Quit()
+}
+
+// compose собирает письмо с заголовками
+func (n *smtpNotifier) compose(notification *Notification) ([]byte, error) {
+	m, ok := messages[notification.Kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown notification kind %q", notification.Kind)
+	}
+
+	var body bytes.Buffer
+	if err := m.body.Execute(&body, notification.Data); err != nil {
+		return nil, err
+	}
+
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %s\r\n", n.cfg.From)
+	fmt.Fprintf(&msg, "To: %s\r\n", notification.To)
+	fmt.Fprintf(&msg, "Subject: %s\r\n", mime.BEncoding.Encode("UTF-8", m.subject))
+	fmt.Fprintf(&msg, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=UTF-8\r\n")
+	msg.WriteString("Content-Transfer-Encoding: 8bit\r\n")
+	msg.WriteString("\r\n")
+	msg.Write(bytes.ReplaceAll(body.Bytes(), []byte("\n"), []byte("\r\n")))
+
+	return msg.Bytes(), nil
+}
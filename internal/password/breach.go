@@ -0,0 +1,243 @@
+package password
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// BloomMagic заголовок файла bloom-фильтра.
+//
+// Формат файла: BloomMagic (8 байт), k - число хеш-функций (uint32, big-endian),
+// m - размер фильтра в битах (uint64, big-endian), затем m/8 байт битового массива.
+// Позиции бит вычисляются двойным хешированием SHA-1 пароля:
+// h1, h2 - первые два uint64 (big-endian) дайджеста, i-я позиция равна (h1 + i*h2) mod m.
+const BloomMagic = "BPWBLOOM"
+
+// Длина префикса в имени файлов диапазонов HIBP (api.pwnedpasswords.com/range/XXXXX)
+const hibpPrefixLength = 5
+
+var errInvalidBloomFilter = errors.New("invalid bloom filter file")
+
+// BreachChecker проверяет пароль по базе утёкших паролей без сетевых запросов
+type BreachChecker interface {
+	IsBreached(password string) (bool, error)
+}
+
+// LoadBreachChecker загружает базу утёкших паролей. Поддерживаются:
+//   - каталог с файлами диапазонов HIBP (XXXXX или XXXXX.txt со строками SUFFIX:COUNT);
+//   - файл со строками HASH или HASH:COUNT, где HASH - полный SHA-1 в hex;
+//   - bloom-фильтр в формате, описанном у BloomMagic.
+//
+// Если путь пустой, проверка отключена.
+func LoadBreachChecker(path string) (BreachChecker, error) {
+	if path == "" {
+		return noopChecker{}, nil
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+
+	if info.IsDir() {
+		return &prefixDirChecker{dir: path}, nil
+	}
+
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := bufio.NewReader(f)
+	header, err := r.Peek(len(BloomMagic))
+	if err == nil && string(header) == BloomMagic {
+		return loadBloomFilter(r)
+	}
+
+	return loadHashList(r)
+}
+
+// Sum возвращает SHA-1 пароля в формате HIBP
+func Sum(password string) [sha1.Size]byte {
+	return sha1.Sum([]byte(password))
+}
+
+type noopChecker struct{}
+
+func (noopChecker) IsBreached(string) (bool, error) {
+	return false, nil
+}
+
+// hashList хранит отсортированные хеши в памяти и ищет бинарным поиском
+type hashList struct {
+	hashes [][sha1.Size]byte
+}
+
+func loadHashList(r io.Reader) (*hashList, error) {
+	list := &hashList{}
+
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		hashHex, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if hashHex == "" {
+			continue
+		}
+
+		var hash [sha1.Size]byte
+		if _, err := hex.Decode(hash[:], []byte(hashHex)); err != nil || len(hashHex) != 2*sha1.Size {
+			return nil, fmt.Errorf("invalid hash at line %d", line)
+		}
+		list.hashes = append(list.hashes, hash)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	sort.Slice(list.hashes, func(i, j int) bool {
+		return bytes.Compare(list.hashes[i][:], list.hashes[j][:]) < 0
+	})
+
+	return list, nil
+}
+
+func (l *hashList) IsBreached(password string) (bool, error) {
+	hash := Sum(password)
+	i := sort.Search(len(l.hashes), func(i int) bool {
+		return bytes.Compare(l.hashes[i][:], hash[:]) >= 0
+	})
+
+	return i < len(l.hashes) && l.hashes[i] == hash, nil
+}
+
+// prefixDirChecker читает с диска только файл нужного диапазона
+type prefixDirChecker struct {
+	dir string
+}
+
+func (c *prefixDirChecker) IsBreached(password string) (bool, error) {
+	hash := Sum(password)
+	hashHex := strings.ToUpper(hex.EncodeToString(hash[:]))
+	prefix, suffix := hashHex[:hibpPrefixLength], hashHex[hibpPrefixLength:]
+
+	f, err := c.openRange(prefix)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return false, nil
+		}
+		return false, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		lineSuffix, _, _ := strings.Cut(strings.TrimSpace(scanner.Text()), ":")
+		if strings.EqualFold(lineSuffix, suffix) {
+			return true, nil
+		}
+	}
+
+	return false, scanner.Err()
+}
+
+func (c *prefixDirChecker) openRange(prefix string) (*os.File, error) {
+	f, err := os.Open(filepath.Join(c.dir, prefix))
+	if errors.Is(err, os.ErrNotExist) {
+		return os.Open(filepath.Join(c.dir, prefix+".txt"))
+	}
+
+	return f, err
+}
+
+// BloomFilter допускает ложноположительные срабатывания с вероятностью,
+// заданной при построении, но не пропускает пароли из базы
+type BloomFilter struct {
+	k    uint32
+	m    uint64
+	bits []byte
+}
+
+// NewBloomFilter создаёт пустой фильтр из m бит с k хеш-функциями
+func NewBloomFilter(m uint64, k uint32) *BloomFilter {
+	m = (m + 7) / 8 * 8
+	return &BloomFilter{
+		k:    k,
+		m:    m,
+		bits: make([]byte, m/8),
+	}
+}
+
+func loadBloomFilter(r io.Reader) (*BloomFilter, error) {
+	header := make([]byte, len(BloomMagic)+4+8)
+	if _, err := io.ReadFull(r, header); err != nil {
+		return nil, err
+	}
+
+	k := binary.BigEndian.Uint32(header[len(BloomMagic):])
+	m := binary.BigEndian.Uint64(header[len(BloomMagic)+4:])
+	if k == 0 || m == 0 || m%8 != 0 {
+		return nil, errInvalidBloomFilter
+	}
+
+	filter := &BloomFilter{k: k, m: m, bits: make([]byte, m/8)}
+	if _, err := io.ReadFull(r, filter.bits); err != nil {
+		return nil, fmt.Errorf("%w: %s", errInvalidBloomFilter, err.Error())
+	}
+
+	return filter, nil
+}
+
+// AddHash добавляет в фильтр SHA-1 пароля
+func (f *BloomFilter) AddHash(hash [sha1.Size]byte) {
+	f.each(hash, func(bit uint64) bool {
+		f.bits[bit/8] |= 1 << (bit % 8)
+		return true
+	})
+}
+
+func (f *BloomFilter) IsBreached(password string) (bool, error) {
+	found := true
+	f.each(Sum(password), func(bit uint64) bool {
+		found = f.bits[bit/8]&(1<<(bit%8)) != 0
+		return found
+	})
+
+	return found, nil
+}
+
+// WriteTo сохраняет фильтр в формате, который читает LoadBreachChecker
+func (f *BloomFilter) WriteTo(w io.Writer) (int64, error) {
+	header := make([]byte, len(BloomMagic)+4+8)
+	copy(header, BloomMagic)
+	binary.BigEndian.PutUint32(header[len(BloomMagic):], f.k)
+	binary.BigEndian.PutUint64(header[len(BloomMagic)+4:], f.m)
+
+	n, err := w.Write(header)
+	if err != nil {
+		return int64(n), err
+	}
+
+	nBits, err := w.Write(f.bits)
+	return int64(n + nBits), err
+}
+
+func (f *BloomFilter) each(hash [sha1.Size]byte, fn func(bit uint64) bool) {
+	h1 := binary.BigEndian.Uint64(hash[0:8])
+	h2 := binary.BigEndian.Uint64(hash[8:16])
+
+	for i := uint64(0); i < uint64(f.k); i++ {
+		if !fn((h1 + i*h2) % f.m) {
+			return
+		}
+	}
+}
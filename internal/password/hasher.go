@@ -0,0 +1,271 @@
+package password
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+
+	"github.com/Slintox/user-service/config"
+)
+
+// Идентификаторы алгоритмов хеширования
+const (
+	AlgorithmBcrypt   = "bcrypt"
+	AlgorithmArgon2id = "argon2id"
+	AlgorithmUnknown  = "unknown"
+)
+
+const argon2idPrefix = "$argon2id$"
+
+var (
+	errUnknownAlgorithm = errors.New("unknown password hash algorithm")
+	errInvalidHash      = errors.New("invalid password hash")
+	errInvalidParams    = errors.New("invalid argon2id params")
+)
+
+// Hasher хеширует пароли для хранения и проверяет их
+type Hasher interface {
+	Hash(password string) (string, error)
+	// Verify сообщает, соответствует ли пароль хешу
+	Verify(hash, password string) (bool, error)
+	// NeedsRehash сообщает, что хеш получен другим алгоритмом
+	// или с параметрами, отличающимися от текущих
+	NeedsRehash(hash string) bool
+}
+
+// Algorithm определяет алгоритм, которым получен хеш
+func Algorithm(hash string) string {
+	switch {
+	case strings.HasPrefix(hash, argon2idPrefix):
+		return AlgorithmArgon2id
+	case strings.HasPrefix(hash, "$2a$"), strings.HasPrefix(hash, "$2b$"), strings.HasPrefix(hash, "$2y$"):
+		return AlgorithmBcrypt
+	default:
+		return AlgorithmUnknown
+	}
+}
+
+// NewHasher создаёт хешер, который хеширует текущим алгоритмом из конфигурации,
+// а проверяет хеши любого поддерживаемого алгоритма
+func NewHasher(cfg *config.PasswordHashConfig) (Hasher, error) {
+	argon2idParams := Argon2idParams{
+		Time:    cfg.Argon2Time,
+		Memory:  cfg.Argon2Memory,
+		Threads: cfg.Argon2Threads,
+		KeyLen:  cfg.Argon2KeyLen,
+		SaltLen: cfg.Argon2SaltLen,
+	}
+	if err := argon2idParams.validate(); err != nil {
+		return nil, err
+	}
+
+	hashers := map[string]Hasher{
+		AlgorithmBcrypt:   NewBcryptHasher(cfg.BcryptCost),
+		AlgorithmArgon2id: NewArgon2idHasher(argon2idParams),
+	}
+
+	current, ok := hashers[cfg.Algorithm]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", errUnknownAlgorithm, cfg.Algorithm)
+	}
+
+	return &multiHasher{
+		algorithm: cfg.Algorithm,
+		current:   current,
+		hashers:   hashers,
+	}, nil
+}
+
+type multiHasher struct {
+	algorithm string
+	current   Hasher
+	hashers   map[string]Hasher
+}
+
+func (h *multiHasher) Hash(password string) (string, error) {
+	return h.current.Hash(password)
+}
+
+func (h *multiHasher) Verify(hash, password string) (bool, error) {
+	hasher, ok := h.hashers[Algorithm(hash)]
+	if !ok {
+		return false, errUnknownAlgorithm
+	}
+
+	return hasher.Verify(hash, password)
+}
+
+func (h *multiHasher) NeedsRehash(hash string) bool {
+	if Algorithm(hash) != h.algorithm {
+		return true
+	}
+
+	return h.current.NeedsRehash(hash)
+}
+
+type bcryptHasher struct {
+	cost int
+}
+
+func NewBcryptHasher(cost int) Hasher {
+	return &bcryptHasher{
+		cost: cost,
+	}
+}
+
+func (h *bcryptHasher) Hash(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), h.cost)
+	if err != nil {
+		return "", err
+	}
+
+	return string(hash), nil
+}
+
+func (h *bcryptHasher) Verify(hash, password string) (bool, error) {
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return true, nil
+}
+
+func (h *bcryptHasher) NeedsRehash(hash string) bool {
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true
+	}
+
+	return cost != h.cost
+}
+
+// Argon2idParams параметры argon2id, Memory в КиБ
+type Argon2idParams struct {
+	Time    uint32
+	Memory  uint32
+	Threads uint8
+	KeyLen  uint32
+	SaltLen uint32
+}
+
+// validate проверяет параметры до вызова argon2: при Threads = 0 он паникует,
+// а нулевые Time или Memory дают хеш без стоимости подбора
+func (p Argon2idParams) validate() error {
+	switch {
+	case p.Time < 1:
+		return fmt.Errorf("%w: time must be at least 1", errInvalidParams)
+	case p.Threads < 1:
+		return fmt.Errorf("%w: threads must be at least 1", errInvalidParams)
+	case p.Memory < 8*uint32(p.Threads):
+		return fmt.Errorf("%w: memory must be at least 8 KiB per thread", errInvalidParams)
+	case p.KeyLen < 1:
+		return fmt.Errorf("%w: key length must be at least 1", errInvalidParams)
+	case p.SaltLen < 1:
+		return fmt.Errorf("%w: salt length must be at least 1", errInvalidParams)
+	}
+
+	return nil
+}
+
+type argon2idHasher struct {
+	params Argon2idParams
+}
+
+func NewArgon2idHasher(params Argon2idParams) Hasher {
+	return &argon2idHasher{
+		params: params,
+	}
+}
+
+// Hash возвращает хеш в формате PHC: $argon2id$v=19$m=65536,t=3,p=2$<salt>$<hash>
+func (h *argon2idHasher) Hash(password string) (string, error) {
+	salt := make([]byte, h.params.SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+
+	key := argon2.IDKey([]byte(password), salt, h.params.Time, h.params.Memory, h.params.Threads, h.params.KeyLen)
+
+	return fmt.Sprintf("%sv=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2idPrefix,
+		argon2.Version,
+		h.params.Memory,
+		h.params.Time,
+		h.params.Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func (h *argon2idHasher) Verify(hash, password string) (bool, error) {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return false, err
+	}
+
+	actual := argon2.IDKey([]byte(password), salt, params.Time, params.Memory, params.Threads, uint32(len(key)))
+
+	return subtle.ConstantTimeCompare(actual, key) == 1, nil
+}
+
+func (h *argon2idHasher) NeedsRehash(hash string) bool {
+	params, salt, key, err := decodeArgon2id(hash)
+	if err != nil {
+		return true
+	}
+
+	return params.Time != h.params.Time ||
+		params.Memory != h.params.Memory ||
+		params.Threads != h.params.Threads ||
+		uint32(len(key)) != h.params.KeyLen ||
+		uint32(len(salt)) != h.params.SaltLen
+}
+
+func decodeArgon2id(hash string) (Argon2idParams, []byte, []byte, error) {
+	var params Argon2idParams
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, hash
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 {
+		return params, nil, nil, errInvalidHash
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, errInvalidHash
+	}
+
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Memory, &params.Time, &params.Threads); err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil {
+		return params, nil, nil, errInvalidHash
+	}
+
+	params.KeyLen = uint32(len(key))
+	params.SaltLen = uint32(len(salt))
+
+	// Хеш из хранилища не должен уронить сервис при проверке пароля
+	if params.validate() != nil {
+		return params, nil, nil, errInvalidHash
+	}
+
+	return params, salt, key, nil
+}
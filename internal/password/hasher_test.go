@@ -0,0 +1,108 @@
+package password
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/Slintox/user-service/config"
+)
+
+func testHashConfig() *config.PasswordHashConfig {
+	return &config.PasswordHashConfig{
+		Algorithm:     AlgorithmArgon2id,
+		BcryptCost:    4,
+		Argon2Time:    1,
+		Argon2Memory:  64,
+		Argon2Threads: 1,
+		Argon2KeyLen:  16,
+		Argon2SaltLen: 8,
+	}
+}
+
+func TestNewHasherRejectsInvalidArgon2Params(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(cfg *config.PasswordHashConfig)
+	}{
+		{name: "zero threads", modify: func(cfg *config.PasswordHashConfig) { cfg.Argon2Threads = 0 }},
+		{name: "zero time", modify: func(cfg *config.PasswordHashConfig) { cfg.Argon2Time = 0 }},
+		{name: "zero memory", modify: func(cfg *config.PasswordHashConfig) { cfg.Argon2Memory = 0 }},
+		{name: "memory below threads", modify: func(cfg *config.PasswordHashConfig) { cfg.Argon2Threads = 16 }},
+		{name: "zero key length", modify: func(cfg *config.PasswordHashConfig) { cfg.Argon2KeyLen = 0 }},
+		{name: "zero salt length", modify: func(cfg *config.PasswordHashConfig) { cfg.Argon2SaltLen = 0 }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testHashConfig()
+			tt.modify(cfg)
+
+			if _, err := NewHasher(cfg); !errors.Is(err, errInvalidParams) {
+				t.Fatalf("err = %v, want errInvalidParams", err)
+			}
+		})
+	}
+}
+
+func TestArgon2idVerify(t *testing.T) {
+	hasher, err := NewHasher(testHashConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash, err := hasher.Hash("correct horse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if Algorithm(hash) != AlgorithmArgon2id {
+		t.Fatalf("algorithm of %q = %s", hash, Algorithm(hash))
+	}
+
+	if ok, err := hasher.Verify(hash, "correct horse"); err != nil || !ok {
+		t.Fatalf("Verify(correct) = %v, %v", ok, err)
+	}
+	if ok, err := hasher.Verify(hash, "wrong horse"); err != nil || ok {
+		t.Fatalf("Verify(wrong) = %v, %v", ok, err)
+	}
+	if hasher.NeedsRehash(hash) {
+		t.Fatal("fresh hash needs rehash")
+	}
+}
+
+func TestArgon2idRejectsInvalidStoredParams(t *testing.T) {
+	hasher, err := NewHasher(testHashConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, hash := range []string{
+		"$argon2id$v=19$m=64,t=1,p=0$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5aw",
+		"$argon2id$v=19$m=64,t=0,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5aw",
+		"$argon2id$v=19$m=0,t=1,p=1$c2FsdHNhbHQ$a2V5a2V5a2V5a2V5a2V5aw",
+		"$argon2id$v=19$m=64,t=1,p=1$$a2V5a2V5a2V5a2V5a2V5aw",
+	} {
+		if _, err := hasher.Verify(hash, "password"); !errors.Is(err, errInvalidHash) {
+			t.Fatalf("Verify(%q) err = %v, want errInvalidHash", hash, err)
+		}
+		if !hasher.NeedsRehash(hash) {
+			t.Fatalf("NeedsRehash(%q) = false", hash)
+		}
+	}
+}
+
+func TestAlgorithm(t *testing.T) {
+	tests := map[string]string{
+		"$argon2id$v=19$m=64,t=1,p=1$c2FsdA$a2V5": AlgorithmArgon2id,
+		"$2a$10$abcdefghijklmnopqrstuv":           AlgorithmBcrypt,
+		"$2b$10$abcdefghijklmnopqrstuv":           AlgorithmBcrypt,
+		"$2y$10$abcdefghijklmnopqrstuv":           AlgorithmBcrypt,
+		"$2x$10$abcdefghijklmnopqrstuv":           AlgorithmUnknown,
+		"plain":                                   AlgorithmUnknown,
+	}
+
+	for hash, want := range tests {
+		if got := Algorithm(hash); got != want {
+			t.Errorf("Algorithm(%q) = %s, want %s", hash, got, want)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package password
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	"github.com/Slintox/user-service/internal/validator"
+)
+
+// Совпадения с более короткими именами и адресами не проверяются,
+// иначе почти любой пароль будет отклонён
+const minIdentifierLength = 3
+
+// NewPolicy создаёт политику паролей из конфигурации
+func NewPolicy(cfg *config.PasswordPolicyConfig) *model.PasswordPolicy {
+	return &model.PasswordPolicy{
+		MinLength:        cfg.MinLength,
+		MaxLength:        cfg.MaxLength,
+		RequireLowercase: cfg.RequireLowercase,
+		RequireUppercase: cfg.RequireUppercase,
+		RequireDigit:     cfg.RequireDigit,
+		RequireSymbol:    cfg.RequireSymbol,
+		DisallowUsername: cfg.DisallowUsername,
+		DisallowEmail:    cfg.DisallowEmail,
+		HistoryDepth:     cfg.HistoryDepth,
+	}
+}
+
+// Rules возвращает правила проверки пароля пользователя с указанными username и email
+func Rules(policy *model.PasswordPolicy, username, email string) []validator.Rule[string] {
+	rules := []validator.Rule[string]{
+		minLength(policy.MinLength),
+		maxBytes(policy.MaxLength),
+	}
+
+	if policy.RequireLowercase {
+		rules = append(rules, requireClass(unicode.IsLower, "Пароль должен содержать строчную букву"))
+	}
+	if policy.RequireUppercase {
+		rules = append(rules, requireClass(unicode.IsUpper, "Пароль должен содержать заглавную букву"))
+	}
+	if policy.RequireDigit {
+		rules = append(rules, requireClass(unicode.IsDigit, "Пароль должен содержать цифру"))
+	}
+	if policy.RequireSymbol {
+		rules = append(rules, requireClass(isSymbol, "Пароль должен содержать специальный символ"))
+	}
+	if policy.DisallowUsername {
+		rules = append(rules, notContains([]string{username}, "Пароль не должен содержать имя пользователя"))
+	}
+	if policy.DisallowEmail {
+		localPart, _, _ := strings.Cut(email, "@")
+		rules = append(rules, notContains([]string{email, localPart}, "Пароль не должен содержать email"))
+	}
+
+	return rules
+}
+
+func minLength(min int) validator.Rule[string] {
+	return func(value string) string {
+		if utf8.RuneCountInString(value) < min {
+			return fmt.Sprintf("Пароль должен быть не короче %d символов", min)
+		}
+		return ""
+	}
+}
+
+func maxBytes(max int) validator.Rule[string] {
+	return func(value string) string {
+		if len(value) > max {
+			return fmt.Sprintf("Пароль должен быть не длиннее %d байт", max)
+		}
+		return ""
+	}
+}
+
+func requireClass(is func(rune) bool, description string) validator.Rule[string] {
+	return func(value string) string {
+		for _, r := range value {
+			if is(r) {
+				return ""
+			}
+		}
+		return description
+	}
+}
+
+func notContains(identifiers []string, description string) validator.Rule[string] {
+	return func(value string) string {
+		canonicalValue := normalize.Username(value)
+		for _, identifier := range identifiers {
+			canonical := normalize.Username(identifier)
+			if utf8.RuneCountInString(canonical) < minIdentifierLength {
+				continue
+			}
+			if strings.Contains(canonicalValue, canonical) {
+				return description
+			}
+		}
+		return ""
+	}
+}
+
+func isSymbol(r rune) bool {
+	return unicode.IsPunct(r) || unicode.IsSymbol(r)
+}
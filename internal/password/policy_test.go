@@ -0,0 +1,92 @@
+package password
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Slintox/user-service/internal/model"
+)
+
+func strictPolicy() *model.PasswordPolicy {
+	return &model.PasswordPolicy{
+		MinLength:        8,
+		MaxLength:        72,
+		RequireLowercase: true,
+		RequireUppercase: true,
+		RequireDigit:     true,
+		RequireSymbol:    true,
+		DisallowUsername: true,
+		DisallowEmail:    true,
+	}
+}
+
+// violations возвращает описания всех нарушенных правил
+func violations(policy *model.PasswordPolicy, password string) []string {
+	var descriptions []string
+	for _, rule := range Rules(policy, "Alice", "wonder.land@example.com") {
+		if description := rule(password); description != "" {
+			descriptions = append(descriptions, description)
+		}
+	}
+
+	return descriptions
+}
+
+func TestRules(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		want     []string
+	}{
+		{name: "valid", password: "Correct-h0rse"},
+		{name: "too short", password: "Aa1-", want: []string{"Пароль должен быть не короче 8 символов"}},
+		// Минимальная длина считается в символах, а не в байтах
+		{name: "too short in runes", password: "Парол-1", want: []string{"Пароль должен быть не короче 8 символов"}},
+		{name: "too long", password: "Aa1-" + strings.Repeat("a", 69), want: []string{"Пароль должен быть не длиннее 72 байт"}},
+		{name: "no lowercase", password: "CORRECT-H0RSE", want: []string{"Пароль должен содержать строчную букву"}},
+		{name: "no uppercase", password: "correct-h0rse", want: []string{"Пароль должен содержать заглавную букву"}},
+		{name: "no digit", password: "Correct-horse", want: []string{"Пароль должен содержать цифру"}},
+		{name: "no symbol", password: "Correcth0rse", want: []string{"Пароль должен содержать специальный символ"}},
+		{name: "contains username", password: "My-ALICE-1x", want: []string{"Пароль не должен содержать имя пользователя"}},
+		{name: "contains email local part", password: "Wonder.Land-1", want: []string{"Пароль не должен содержать email"}},
+		{
+			name:     "several violations",
+			password: "alice",
+			want: []string{
+				"Пароль должен быть не короче 8 символов",
+				"Пароль должен содержать заглавную букву",
+				"Пароль должен содержать цифру",
+				"Пароль должен содержать специальный символ",
+				"Пароль не должен содержать имя пользователя",
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := violations(strictPolicy(), tt.password); !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("violations(%q) = %q, want %q", tt.password, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRulesSkipDisabledChecks(t *testing.T) {
+	policy := &model.PasswordPolicy{MinLength: 4, MaxLength: 72}
+
+	if got := violations(policy, "alice"); got != nil {
+		t.Fatalf("violations = %q, want none", got)
+	}
+}
+
+func TestRulesIgnoreShortIdentifiers(t *testing.T) {
+	policy := strictPolicy()
+
+	// Имя короче трёх символов не проверяется, иначе почти любой пароль был бы отклонён
+	for _, rule := range Rules(policy, "Al", "al@example.com") {
+		if description := rule("Alpha-Centauri-1"); description != "" {
+			t.Fatalf("unexpected violation %q", description)
+		}
+	}
+}
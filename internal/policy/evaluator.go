@@ -0,0 +1,157 @@
+package policy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Slintox/user-service/config"
+)
+
+// Evaluator хранит правила из файлов политик и перечитывает файлы при изменении
+type Evaluator struct {
+	paths    []string
+	interval time.Duration
+
+	mu    sync.RWMutex
+	rules *Rules
+	// Время изменения и размер файлов при последнем чтении
+	versions []fileVersion
+}
+
+type fileVersion struct {
+	modTime time.Time
+	size    int64
+}
+
+// NewEvaluator загружает политики из файлов конфигурации.
+// Без файлов правил нет и запросы проверяются только по разрешениям
+func NewEvaluator(cfg *config.PolicyConfig) (*Evaluator, error) {
+	versions, err := stat(cfg.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := load(cfg.Paths)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Evaluator{
+		paths:    cfg.Paths,
+		interval: cfg.ReloadInterval,
+		rules:    rules,
+		versions: versions,
+	}, nil
+}
+
+// Rules возвращает действующие правила
+func (e *Evaluator) Rules() *Rules {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	return e.rules
+}
+
+// Watch периодически проверяет файлы политик и перечитывает изменённые.
+// Если новые политики не загрузились, продолжают действовать прежние
+func (e *Evaluator) Watch(ctx context.Context) {
+	if len(e.paths) == 0 || e.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			e.reload()
+		}
+	}
+}
+
+func (e *Evaluator) reload() {
+	versions, err := stat(e.paths)
+	if err != nil {
+		log.Printf("failed to check policies: %s", err.Error())
+		return
+	}
+
+	if !e.changed(versions) {
+		return
+	}
+
+	// Версии запоминаются и при ошибке, чтобы не повторять её до следующего изменения
+	e.mu.Lock()
+	e.versions = versions
+	e.mu.Unlock()
+
+	rules, err := load(e.paths)
+	if err != nil {
+		log.Printf("failed to reload policies: %s", err.Error())
+		return
+	}
+
+	e.mu.Lock()
+	e.rules = rules
+	e.mu.Unlock()
+
+	log.Printf("reloaded policies: %d rules", rules.Len())
+}
+
+func (e *Evaluator) changed(versions []fileVersion) bool {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+
+	for i := range versions {
+		if versions[i] != e.versions[i] {
+			return true
+		}
+	}
+
+	return false
+}
+
+func stat(paths []string) ([]fileVersion, error) {
+	versions := make([]fileVersion, 0, len(paths))
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			return nil, err
+		}
+
+		versions = append(versions, fileVersion{
+			modTime: info.ModTime(),
+			size:    info.Size(),
+		})
+	}
+
+	return versions, nil
+}
+
+func load(paths []string) (*Rules, error) {
+	rules := &Rules{}
+	for _, path := range paths {
+		src, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		fileRules, err := Parse(path, src)
+		if err != nil {
+			return nil, err
+		}
+
+		if err = rules.merge(fileRules); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	return rules, nil
+}
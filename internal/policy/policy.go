@@ -0,0 +1,266 @@
+package policy
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/google/cel-go/cel"
+	"gopkg.in/yaml.v3"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+)
+
+// Input описывает проверяемый запрос
+type Input struct {
+	Principal *auth.Principal
+	// Короткое имя метода UserV1, например Update
+	Method string
+	// Пользователь, к которому относится запрос, или nil
+	Target *model.User
+}
+
+// Rules набор скомпилированных правил одной или нескольких политик
+type Rules struct {
+	rules []*rule
+}
+
+type rule struct {
+	name   string
+	effect string
+	// Пусто - правило относится ко всем методам
+	methods map[string]bool
+	program cel.Program
+}
+
+// Файл политики в YAML:
+//
+//	rules:
+//	  - name: support-edits-new-users
+//	    effect: allow
+//	    methods: [Get, Update]
+//	    condition: >
+//	      "support" in principal.roles &&
+//	      target != null && now - target.created_at < duration("720h")
+//
+// Условие - выражение CEL, которое возвращает bool. Доступные переменные:
+//   - principal: username, email, organization_id, roles (имена), permissions, api_key, scopes;
+//   - method: короткое имя метода;
+//   - target: username, email, roles (имена), email_verified, created_at, updated_at
+//     или null, если запрос не относится к пользователю;
+//   - now: текущее время.
+type file struct {
+	Rules []struct {
+		Name      string   `yaml:"name"`
+		Effect    string   `yaml:"effect"`
+		Methods   []string `yaml:"methods"`
+		Condition string   `yaml:"condition"`
+	} `yaml:"rules"`
+}
+
+// Parse компилирует правила политики. name - имя файла для сообщений об ошибках
+func Parse(name string, src []byte) (*Rules, error) {
+	var f file
+	decoder := yaml.NewDecoder(bytes.NewReader(src))
+	decoder.KnownFields(true)
+	if err := decoder.Decode(&f); err != nil {
+		return nil, fmt.Errorf("%s: %w", name, err)
+	}
+
+	env, err := newEnv()
+	if err != nil {
+		return nil, err
+	}
+
+	rules := &Rules{
+		rules: make([]*rule, 0, len(f.Rules)),
+	}
+	for i, r := range f.Rules {
+		if r.Name == "" {
+			return nil, fmt.Errorf("%s: rule #%d: name is required", name, i+1)
+		}
+		if r.Effect != model.PolicyEffectAllow && r.Effect != model.PolicyEffectDeny {
+			return nil, fmt.Errorf("%s: rule %s: effect must be %q or %q", name, r.Name, model.PolicyEffectAllow, model.PolicyEffectDeny)
+		}
+
+		ast, issues := env.Compile(r.Condition)
+		if issues != nil && issues.Err() != nil {
+			return nil, fmt.Errorf("%s: rule %s: %w", name, r.Name, issues.Err())
+		}
+		if ast.OutputType() != cel.BoolType && ast.OutputType() != cel.DynType {
+			return nil, fmt.Errorf("%s: rule %s: condition must return bool, got %s", name, r.Name, ast.OutputType())
+		}
+
+		program, err := env.Program(ast)
+		if err != nil {
+			return nil, fmt.Errorf("%s: rule %s: %w", name, r.Name, err)
+		}
+
+		compiled := &rule{
+			name:    r.Name,
+			effect:  r.Effect,
+			methods: make(map[string]bool, len(r.Methods)),
+			program: program,
+		}
+		for _, method := range r.Methods {
+			compiled.methods[method] = true
+		}
+
+		if err = rules.add(compiled); err != nil {
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+	}
+
+	return rules, nil
+}
+
+func newEnv() (*cel.Env, error) {
+	return cel.NewEnv(
+		cel.Variable("principal", cel.MapType(cel.StringType, cel.DynType)),
+		cel.Variable("method", cel.StringType),
+		cel.Variable("target", cel.DynType),
+		cel.Variable("now", cel.TimestampType),
+	)
+}
+
+// merge добавляет правила другой политики. Имена правил должны быть уникальны
+func (r *Rules) merge(other *Rules) error {
+	for _, rule := range other.rules {
+		if err := r.add(rule); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (r *Rules) add(rule *rule) error {
+	for _, existing := range r.rules {
+		if existing.name == rule.name {
+			return fmt.Errorf("rule %s is defined more than once", rule.name)
+		}
+	}
+
+	r.rules = append(r.rules, rule)
+
+	return nil
+}
+
+// Len возвращает число правил
+func (r *Rules) Len() int {
+	return len(r.rules)
+}
+
+// Applies сообщает, что к методу относится хотя бы одно правило
+func (r *Rules) Applies(method string) bool {
+	for _, rule := range r.rules {
+		if rule.applies(method) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Evaluate проверяет запрос всеми правилами, которые относятся к его методу.
+// Запрещающее правило действует сильнее разрешающего
+func (r *Rules) Evaluate(input *Input) *model.PolicyResult {
+	vars := map[string]interface{}{
+		"principal": principalVars(input.Principal),
+		"method":    input.Method,
+		"target":    targetVars(input.Target),
+		"now":       time.Now(),
+	}
+
+	result := &model.PolicyResult{}
+	for _, rule := range r.rules {
+		if !rule.applies(input.Method) {
+			continue
+		}
+
+		ruleResult := model.PolicyRuleResult{
+			Name:   rule.name,
+			Effect: rule.effect,
+		}
+
+		matched, err := rule.eval(vars)
+		if err != nil {
+			ruleResult.Error = err.Error()
+			// Ошибка не должна открывать доступ, который правило запрещает
+			matched = rule.effect == model.PolicyEffectDeny
+		}
+		ruleResult.Matched = matched
+
+		if matched && result.Effect != model.PolicyEffectDeny {
+			result.Effect = rule.effect
+		}
+		result.Rules = append(result.Rules, ruleResult)
+	}
+
+	return result
+}
+
+func (r *rule) applies(method string) bool {
+	return len(r.methods) == 0 || r.methods[method]
+}
+
+func (r *rule) eval(vars map[string]interface{}) (bool, error) {
+	out, _, err := r.program.Eval(vars)
+	if err != nil {
+		return false, err
+	}
+
+	matched, ok := out.Value().(bool)
+	if !ok {
+		return false, errors.New("condition did not return bool")
+	}
+
+	return matched, nil
+}
+
+func principalVars(principal *auth.Principal) map[string]interface{} {
+	if principal == nil {
+		return map[string]interface{}{}
+	}
+
+	permissions := make([]string, 0, len(principal.Permissions))
+	for permission, granted := range principal.Permissions {
+		if granted {
+			permissions = append(permissions, permission)
+		}
+	}
+	sort.Strings(permissions)
+
+	return map[string]interface{}{
+		"username":        principal.Username,
+		"email":           principal.Email,
+		"organization_id": principal.OrganizationID,
+		"roles":           principal.RoleNames,
+		"permissions":     permissions,
+		"api_key":         principal.ApiKey,
+		"scopes":          principal.Scopes,
+	}
+}
+
+func targetVars(user *model.User) interface{} {
+	if user == nil {
+		return nil
+	}
+
+	roles := make([]string, 0, len(user.Roles))
+	for _, role := range user.Roles {
+		roles = append(roles, role.Name)
+	}
+
+	return map[string]interface{}{
+		"username":       user.Username,
+		"email":          user.Email,
+		"roles":          roles,
+		"email_verified": user.EmailVerifiedAt != nil,
+		"created_at":     user.CreatedAt,
+		"updated_at":     user.UpdatedAt,
+	}
+}
@@ -0,0 +1,149 @@
+package policy
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+)
+
+const testPolicy = `
+rules:
+  - name: support-access
+    effect: allow
+    methods: [Get, Update]
+    condition: '"support" in principal.roles'
+  - name: protect-admin
+    effect: deny
+    methods: [Update]
+    condition: target != null && "admin" in target.roles
+  - name: everyone-lists
+    effect: allow
+    condition: method == "List"
+`
+
+func mustParse(t *testing.T, src string) *Rules {
+	t.Helper()
+
+	rules, err := Parse("test.yaml", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return rules
+}
+
+func TestEvaluateDenyOverridesAllow(t *testing.T) {
+	rules := mustParse(t, testPolicy)
+	support := &auth.Principal{Username: "bob", RoleNames: []string{"support"}}
+	admin := &model.User{Username: "root", Roles: []model.Role{{Name: "admin"}}}
+	user := &model.User{Username: "alice"}
+
+	tests := []struct {
+		name    string
+		input   *Input
+		effect  string
+		matched []string
+	}{
+		{
+			name:    "allow",
+			input:   &Input{Principal: support, Method: "Update", Target: user},
+			effect:  model.PolicyEffectAllow,
+			matched: []string{"support-access"},
+		},
+		{
+			name:    "deny wins",
+			input:   &Input{Principal: support, Method: "Update", Target: admin},
+			effect:  model.PolicyEffectDeny,
+			matched: []string{"support-access", "protect-admin"},
+		},
+		{
+			// Запрещающее правило относится только к Update
+			name:    "other method",
+			input:   &Input{Principal: support, Method: "Get", Target: admin},
+			effect:  model.PolicyEffectAllow,
+			matched: []string{"support-access"},
+		},
+		{
+			name:   "no rule matched",
+			input:  &Input{Principal: &auth.Principal{Username: "alice"}, Method: "Get", Target: user},
+			effect: "",
+		},
+		{
+			name:    "rule for all methods",
+			input:   &Input{Method: "List"},
+			effect:  model.PolicyEffectAllow,
+			matched: []string{"everyone-lists"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := rules.Evaluate(tt.input)
+			if result.Effect != tt.effect {
+				t.Fatalf("effect = %q, want %q", result.Effect, tt.effect)
+			}
+
+			var matched []string
+			for _, rule := range result.Rules {
+				if rule.Error != "" {
+					t.Fatalf("rule %s: %s", rule.Name, rule.Error)
+				}
+				if rule.Matched {
+					matched = append(matched, rule.Name)
+				}
+			}
+			if !reflect.DeepEqual(matched, tt.matched) {
+				t.Fatalf("matched = %v, want %v", matched, tt.matched)
+			}
+		})
+	}
+}
+
+func TestEvaluateErrorIsDeny(t *testing.T) {
+	// Обращение к полю target без проверки на null завершается ошибкой
+	rules := mustParse(t, `
+rules:
+  - name: allow-own
+    effect: allow
+    condition: target.username == principal.username
+  - name: deny-admins
+    effect: deny
+    condition: '"admin" in target.roles'
+`)
+
+	result := rules.Evaluate(&Input{Principal: &auth.Principal{Username: "alice"}, Method: "Get"})
+	if result.Effect != model.PolicyEffectDeny {
+		t.Fatalf("effect = %q, want %q", result.Effect, model.PolicyEffectDeny)
+	}
+
+	for _, rule := range result.Rules {
+		if rule.Error == "" {
+			t.Fatalf("rule %s: expected evaluation error", rule.Name)
+		}
+		// Ошибка разрешающего правила не даёт доступа, ошибка запрещающего - запрещает
+		if want := rule.Effect == model.PolicyEffectDeny; rule.Matched != want {
+			t.Fatalf("rule %s: matched = %v, want %v", rule.Name, rule.Matched, want)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := map[string]string{
+		"no name":        "rules: [{effect: allow, condition: 'true'}]",
+		"unknown effect": "rules: [{name: a, effect: audit, condition: 'true'}]",
+		"not bool":       "rules: [{name: a, effect: allow, condition: 'method'}]",
+		"syntax":         "rules: [{name: a, effect: allow, condition: 'method =='}]",
+		"unknown field":  "rules: [{name: a, effect: allow, condition: 'true', when: x}]",
+		"duplicate name": "rules: [{name: a, effect: allow, condition: 'true'}, {name: a, effect: deny, condition: 'false'}]",
+	}
+
+	for name, src := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := Parse("test.yaml", []byte(src)); err == nil {
+				t.Fatal("expected parse error")
+			}
+		})
+	}
+}
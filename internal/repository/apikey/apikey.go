@@ -0,0 +1,242 @@
+package apikey
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const tableName = "api_key"
+
+var columns = []string{"id", "organization_id", "username", "name", "hint", "scopes", "created_at", "expires_at", "last_used_at"}
+
+type Repository interface {
+	Create(ctx context.Context, key *model.ApiKey, keyHash string) (*model.ApiKey, error)
+	// List возвращает неотозванные ключи пользователя, в том числе истёкшие
+	List(ctx context.Context, username string) ([]*model.ApiKey, error)
+	// CountActive возвращает число неотозванных и неистёкших ключей пользователя
+	CountActive(ctx context.Context, username string) (int, error)
+	Revoke(ctx context.Context, username string, id int64) error
+	// RevokeAll отзывает все неотозванные ключи пользователя
+	RevokeAll(ctx context.Context, username string) (int64, error)
+	// Use находит действующий ключ по хешу и отмечает время его использования
+	Use(ctx context.Context, keyHash string) (*model.ApiKey, error)
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Create(ctx context.Context, key *model.ApiKey, keyHash string) (*model.ApiKey, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Insert(tableName).
+		Columns("organization_id", "username", "name", "hint", "key_hash", "scopes", "expires_at").
+		Values(orgID, key.Username, key.Name, key.Hint, keyHash, key.Scopes, key.ExpiresAt).
+		Suffix("returning " + strings.Join(columns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("apikey.Create: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return scanApiKey(r.pool.QueryRow(ctx, query, v...))
+}
+
+func (r *repository) List(ctx context.Context, username string) ([]*model.ApiKey, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select(columns...).
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "revoked_at": nil}).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("apikey.List: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []*model.ApiKey
+	for rows.Next() {
+		key, err := scanApiKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+
+	return keys, rows.Err()
+}
+
+func (r *repository) CountActive(ctx context.Context, username string) (int, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query, v, err := sq.Select("count(*)").
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "revoked_at": nil}).
+		Where("(expires_at is null or expires_at > now())").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("apikey.CountActive: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var count int
+	if err = r.pool.QueryRow(ctx, query, v...).Scan(&count); err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (r *repository) Revoke(ctx context.Context, username string, id int64) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("revoked_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "id": id, "username": username, "revoked_at": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("apikey.Revoke: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) RevokeAll(ctx context.Context, username string) (int64, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("revoked_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "revoked_at": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("apikey.RevokeAll: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return 0, err
+	}
+
+	return pg.RowsAffected(), nil
+}
+
+func (r *repository) Use(ctx context.Context, keyHash string) (*model.ApiKey, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("last_used_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "key_hash": keyHash, "revoked_at": nil}).
+		Where("(expires_at is null or expires_at > now())").
+		Suffix("returning " + strings.Join(columns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("apikey.Use: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	key, err := scanApiKey(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
+
+func scanApiKey(row pgx.Row) (*model.ApiKey, error) {
+	var key model.ApiKey
+	err := row.Scan(
+		&key.ID,
+		&key.OrganizationID,
+		&key.Username,
+		&key.Name,
+		&key.Hint,
+		&key.Scopes,
+		&key.CreatedAt,
+		&key.ExpiresAt,
+		&key.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+
+	return &key, nil
+}
@@ -0,0 +1,194 @@
+package emailchange
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const tableName = "email_change"
+
+var columns = []string{"id", "username", "old_email", "new_email", "created_at", "expires_at", "confirmed_at", "cancelled_at"}
+
+type Repository interface {
+	// Create сохраняет запрос на смену email и отменяет прежние
+	// неподтверждённые запросы пользователя
+	Create(ctx context.Context, username, oldEmail, newEmail string, ttl time.Duration) (*model.EmailChange, error)
+	Get(ctx context.Context, id int64) (*model.EmailChange, error)
+	// Confirm отмечает запрос подтверждённым. Возвращает ErrRecordNotFound,
+	// если запрос уже подтверждён, отменён или просрочен
+	Confirm(ctx context.Context, id int64) error
+	// Cancel отменяет запрос, ещё не подтверждённый или подтверждённый не раньше чем grace назад.
+	// Возвращает ErrRecordNotFound, если отменить запрос уже нельзя
+	Cancel(ctx context.Context, id int64, grace time.Duration) error
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Create(ctx context.Context, username, oldEmail, newEmail string, ttl time.Duration) (*model.EmailChange, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	cancelQuery, cancelValues, err := sq.Update(tableName).
+		Set("cancelled_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "confirmed_at": nil, "cancelled_at": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	insertQuery, insertValues, err := sq.Insert(tableName).
+		Columns("organization_id", "username", "old_email", "new_email", "expires_at").
+		Values(orgID, username, oldEmail, newEmail, sq.Expr("now() + ?::interval", ttl)).
+		Suffix("returning " + strings.Join(columns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("emailchange.Create: query: '%s' values: '%+v'\n", cancelQuery, cancelValues)
+		log.Printf("emailchange.Create: query: '%s' values: '%+v'\n", insertQuery, insertValues)
+	}
+
+	var change *model.EmailChange
+	err = r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, cancelQuery, cancelValues...); err != nil {
+			return err
+		}
+
+		var err error
+		change, err = scanEmailChange(tx.QueryRow(ctx, insertQuery, insertValues...))
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return change, nil
+}
+
+func (r *repository) Get(ctx context.Context, id int64) (*model.EmailChange, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select(columns...).
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("emailchange.Get: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	change, err := scanEmailChange(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return change, nil
+}
+
+func (r *repository) Confirm(ctx context.Context, id int64) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("confirmed_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "id": id, "confirmed_at": nil, "cancelled_at": nil}).
+		Where("expires_at > now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("emailchange.Confirm: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, query, v)
+}
+
+func (r *repository) Cancel(ctx context.Context, id int64, grace time.Duration) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("cancelled_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "id": id, "cancelled_at": nil}).
+		Where(sq.Or{
+			sq.Eq{"confirmed_at": nil},
+			sq.Expr("confirmed_at > now() - ?::interval", grace),
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("emailchange.Cancel: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, query, v)
+}
+
+func (r *repository) execOne(ctx context.Context, query string, v []interface{}) error {
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func scanEmailChange(row pgx.Row) (*model.EmailChange, error) {
+	var change model.EmailChange
+	err := row.Scan(&change.ID, &change.Username, &change.OldEmail, &change.NewEmail,
+		&change.CreatedAt, &change.ExpiresAt, &change.ConfirmedAt, &change.CancelledAt)
+	if err != nil {
+		return nil, err
+	}
+
+	return &change, nil
+}
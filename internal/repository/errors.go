@@ -2,8 +2,36 @@ package repository
 
 import "errors"
 
+// Коды ошибок Postgres, которые репозитории переводят в свои ошибки
+const (
+	UniqueViolation     = "23505"
+	ForeignKeyViolation = "23503"
+)
+
 var (
 	// ErrRecordNotFound ошибка возвращаемая из уровня repository
 	// для обработки на уровне usecase.
 	ErrRecordNotFound = errors.New("Запись не найдена")
+
+	// ErrVersionMismatch возвращается, если версия записи
+	// не совпадает с ожидаемой при условном изменении.
+	ErrVersionMismatch = errors.New("Версия записи не совпадает")
+
+	// ErrAlreadyExists возвращается при нарушении уникальности.
+	ErrAlreadyExists = errors.New("Запись уже существует")
+
+	// ErrUsernameTaken возвращается, если имя пользователя уже занято.
+	ErrUsernameTaken = errors.New("Имя пользователя уже занято")
+
+	// ErrEmailTaken возвращается, если адрес уже принадлежит другому пользователю.
+	ErrEmailTaken = errors.New("Адрес уже используется")
+
+	// ErrInUse возвращается, если на запись ссылаются другие записи.
+	ErrInUse = errors.New("Запись используется")
+
+	// ErrCycle возвращается, если связь замкнула бы цикл.
+	ErrCycle = errors.New("Связь образует цикл")
+
+	// ErrNoTenant возвращается, если в контексте запроса нет организации.
+	ErrNoTenant = errors.New("Организация запроса не определена")
 )
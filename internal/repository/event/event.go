@@ -0,0 +1,57 @@
+package event
+
+import (
+	"context"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const tableName = "user_event"
+
+type Repository interface {
+	Add(ctx context.Context, event *model.Event) error
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Add(ctx context.Context, event *model.Event) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	payload := event.Payload
+	if payload == nil {
+		payload = map[string]interface{}{}
+	}
+
+	query, v, err := sq.Insert(tableName).
+		Columns("organization_id", "type", "subject", "payload").
+		Values(orgID, event.Type, event.Subject, payload).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("event.Add: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+	return err
+}
@@ -0,0 +1,570 @@
+package group
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const (
+	tableName           = "user_group"
+	memberUserTableName = "group_member_user"
+	memberGroupTable    = "group_member_group"
+	roleTableName       = "group_role_assignment"
+
+	// Класс рекомендательной блокировки изменений вложенности групп
+	nestingLockClass = 4049
+)
+
+// Столбец ролей, назначенных самой группе, в порядке id
+const groupRolesColumn = `array(select user_role.%s from group_role_assignment
+	join user_role on user_role.id = group_role_assignment.role
+	where group_role_assignment.organization_id = user_group.organization_id
+		and group_role_assignment.group_id = user_group.id
+	order by user_role.id)`
+
+var columns = []string{
+	"id", "name",
+	fmt.Sprintf(groupRolesColumn, "id"),
+	fmt.Sprintf(groupRolesColumn, "name"),
+	"created_at",
+}
+
+// Repository хранит группы, их участников и роли в пределах организации из контекста
+type Repository interface {
+	// Create возвращает ErrAlreadyExists, если группа с таким именем уже есть
+	Create(ctx context.Context, name string) (*model.Group, error)
+	GetByName(ctx context.Context, name string) (*model.Group, error)
+	List(ctx context.Context) ([]*model.Group, error)
+	// Rename возвращает ErrAlreadyExists, если имя занято другой группой
+	Rename(ctx context.Context, id int64, newName string) error
+	// Delete удаляет группу вместе с её участниками и ролями
+	Delete(ctx context.Context, id int64) error
+
+	// AddUser возвращает ErrAlreadyExists, если пользователь уже в группе
+	AddUser(ctx context.Context, id int64, username string) error
+	// RemoveUser возвращает ErrRecordNotFound, если пользователя нет в группе
+	RemoveUser(ctx context.Context, id int64, username string) error
+	// AddGroup делает группу memberID участником группы id. Возвращает ErrCycle,
+	// если группа id уже входит в memberID, и ErrAlreadyExists при повторном добавлении
+	AddGroup(ctx context.Context, id, memberID int64) error
+	// RemoveGroup возвращает ErrRecordNotFound, если группа memberID не входит в id напрямую
+	RemoveGroup(ctx context.Context, id, memberID int64) error
+	// ListMembers возвращает прямых участников группы или, если effective,
+	// всех пользователей и группы, входящие в неё через вложенные группы
+	ListMembers(ctx context.Context, id int64, effective bool) (*model.GroupMembers, error)
+	// ListUserGroups возвращает все группы, в которые пользователь входит прямо или косвенно
+	ListUserGroups(ctx context.Context, username string) ([]*model.GroupMembership, error)
+
+	// AssignRole возвращает ErrAlreadyExists, если роль уже назначена группе
+	AssignRole(ctx context.Context, id int64, role model.UserRole) error
+	// UnassignRole возвращает ErrRecordNotFound, если роль не была назначена группе
+	UnassignRole(ctx context.Context, id int64, role model.UserRole) error
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Create(ctx context.Context, name string) (*model.Group, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Insert(tableName).
+		Columns("organization_id", "name").
+		Values(orgID, name).
+		Suffix("returning " + strings.Join(columns, ", ")).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.Create: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	group, err := scanGroup(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	return group, nil
+}
+
+func (r *repository) GetByName(ctx context.Context, name string) (*model.Group, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select(columns...).
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "name": name}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.GetByName: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	group, err := scanGroup(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return group, nil
+}
+
+func (r *repository) List(ctx context.Context) ([]*model.Group, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select(columns...).
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		OrderBy("name").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.List: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var groups []*model.Group
+	for rows.Next() {
+		group, err := scanGroup(rows)
+		if err != nil {
+			return nil, err
+		}
+		groups = append(groups, group)
+	}
+
+	return groups, rows.Err()
+}
+
+func (r *repository) Rename(ctx context.Context, id int64, newName string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("name", newName).
+		Where(sq.Eq{"organization_id": orgID, "id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.Rename: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, query, v)
+}
+
+func (r *repository) Delete(ctx context.Context, id int64) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Delete(tableName).
+		Where(sq.Eq{"organization_id": orgID, "id": id}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.Delete: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, query, v)
+}
+
+func (r *repository) AddUser(ctx context.Context, id int64, username string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Insert(memberUserTableName).
+		Columns("organization_id", "group_id", "username").
+		Values(orgID, id, username).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.AddUser: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	if _, err = r.pool.Exec(ctx, query, v...); err != nil {
+		return mapError(err)
+	}
+
+	return nil
+}
+
+func (r *repository) RemoveUser(ctx context.Context, id int64, username string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Delete(memberUserTableName).
+		Where(sq.Eq{"organization_id": orgID, "group_id": id, "username": username}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.RemoveUser: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, query, v)
+}
+
+func (r *repository) AddGroup(ctx context.Context, id, memberID int64) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	// Цикл возникнет, если группа id уже вложена в memberID или совпадает с ней
+	nested, nestedV := nestedGroups(orgID, memberID)
+	cycleQuery, cycleV, err := sq.Select().
+		Column(sq.Expr("exists(select 1 from nested where group_id = ?)", id)).
+		Prefix(nested, nestedV...).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	insertQuery, insertV, err := sq.Insert(memberGroupTable).
+		Columns("organization_id", "group_id", "member_group_id").
+		Values(orgID, id, memberID).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.AddGroup: query: '%s' values: '%+v'\n", cycleQuery, cycleV)
+		log.Printf("group.AddGroup: query: '%s' values: '%+v'\n", insertQuery, insertV)
+	}
+
+	return r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// Одновременные добавления могли бы вместе замкнуть цикл, поэтому
+		// изменения вложенности в организации выполняются по очереди
+		if _, err := tx.Exec(ctx, "select pg_advisory_xact_lock($1, $2::int)", nestingLockClass, orgID); err != nil {
+			return err
+		}
+
+		var cycle bool
+		if err := tx.QueryRow(ctx, cycleQuery, cycleV...).Scan(&cycle); err != nil {
+			return err
+		}
+		if cycle {
+			return repo.ErrCycle
+		}
+
+		if _, err := tx.Exec(ctx, insertQuery, insertV...); err != nil {
+			return mapError(err)
+		}
+
+		return nil
+	})
+}
+
+func (r *repository) RemoveGroup(ctx context.Context, id, memberID int64) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Delete(memberGroupTable).
+		Where(sq.Eq{"organization_id": orgID, "group_id": id, "member_group_id": memberID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.RemoveGroup: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, query, v)
+}
+
+func (r *repository) ListMembers(ctx context.Context, id int64, effective bool) (*model.GroupMembers, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	usersBuilder := sq.Select("distinct username").
+		From(memberUserTableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		OrderBy("username").
+		PlaceholderFormat(sq.Dollar)
+	groupsBuilder := sq.Select("user_group.name").
+		From(tableName).
+		Where(sq.Eq{"user_group.organization_id": orgID}).
+		OrderBy("user_group.name").
+		PlaceholderFormat(sq.Dollar)
+
+	if effective {
+		nested, nestedV := nestedGroups(orgID, id)
+		usersBuilder = usersBuilder.Prefix(nested, nestedV...).
+			Where("group_id in (select group_id from nested)")
+		groupsBuilder = groupsBuilder.Prefix(nested, nestedV...).
+			Where("user_group.id in (select group_id from nested)").
+			Where(sq.NotEq{"user_group.id": id})
+	} else {
+		usersBuilder = usersBuilder.Where(sq.Eq{"group_id": id})
+		groupsBuilder = groupsBuilder.
+			Join(memberGroupTable + " on group_member_group.organization_id = user_group.organization_id" +
+				" and group_member_group.member_group_id = user_group.id").
+			Where(sq.Eq{"group_member_group.group_id": id})
+	}
+
+	var members model.GroupMembers
+	if members.Usernames, err = r.listNames(ctx, "group.ListMembers", usersBuilder); err != nil {
+		return nil, err
+	}
+	if members.GroupNames, err = r.listNames(ctx, "group.ListMembers", groupsBuilder); err != nil {
+		return nil, err
+	}
+
+	return &members, nil
+}
+
+func (r *repository) ListUserGroups(ctx context.Context, username string) ([]*model.GroupMembership, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Группы обходятся вверх по вложенности. union отбрасывает повторы,
+	// поэтому обход завершается и при цикле
+	query, v, err := sq.Select("user_group.name", "bool_or(member_of.direct)").
+		Prefix(`with recursive member_of(group_id, direct) as (
+			select group_id, true from group_member_user
+			where organization_id = ? and username = ?
+			union
+			select group_member_group.group_id, false from group_member_group
+			join member_of on member_of.group_id = group_member_group.member_group_id
+			where group_member_group.organization_id = ?
+		)`, orgID, username, orgID).
+		From("member_of").
+		Join(tableName+" on user_group.id = member_of.group_id").
+		Where(sq.Eq{"user_group.organization_id": orgID}).
+		GroupBy("user_group.id", "user_group.name").
+		OrderBy("user_group.name").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.ListUserGroups: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var memberships []*model.GroupMembership
+	for rows.Next() {
+		var membership model.GroupMembership
+		if err = rows.Scan(&membership.GroupName, &membership.Direct); err != nil {
+			return nil, err
+		}
+		memberships = append(memberships, &membership)
+	}
+
+	return memberships, rows.Err()
+}
+
+func (r *repository) AssignRole(ctx context.Context, id int64, role model.UserRole) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Insert(roleTableName).
+		Columns("organization_id", "group_id", "role").
+		Values(orgID, id, role).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.AssignRole: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	if _, err = r.pool.Exec(ctx, query, v...); err != nil {
+		return mapError(err)
+	}
+
+	return nil
+}
+
+func (r *repository) UnassignRole(ctx context.Context, id int64, role model.UserRole) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Delete(roleTableName).
+		Where(sq.Eq{"organization_id": orgID, "group_id": id, "role": role}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("group.UnassignRole: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, query, v)
+}
+
+// nestedGroups возвращает CTE nested(group_id) из группы id и всех групп,
+// вложенных в неё прямо или косвенно. union отбрасывает повторы,
+// поэтому обход завершается и при цикле
+func nestedGroups(orgID, id int64) (string, []interface{}) {
+	return `with recursive nested(group_id) as (
+		select ?::bigint
+		union
+		select group_member_group.member_group_id from group_member_group
+		join nested on nested.group_id = group_member_group.group_id
+		where group_member_group.organization_id = ?
+	)`, []interface{}{id, orgID}
+}
+
+func (r *repository) listNames(ctx context.Context, caller string, builder sq.SelectBuilder) ([]string, error) {
+	query, v, err := builder.ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("%s: query: '%s' values: '%+v'\n", caller, query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	names := []string{}
+	for rows.Next() {
+		var name string
+		if err = rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+
+	return names, rows.Err()
+}
+
+func (r *repository) execOne(ctx context.Context, query string, v []interface{}) error {
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// mapError переводит нарушения ограничений в ошибки репозитория
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case repo.UniqueViolation:
+			return repo.ErrAlreadyExists
+		case repo.ForeignKeyViolation:
+			return repo.ErrInUse
+		}
+	}
+
+	return err
+}
+
+func scanGroup(row pgx.Row) (*model.Group, error) {
+	var group model.Group
+	var roleIDs []int32
+	var roleNames []string
+	if err := row.Scan(&group.ID, &group.Name, &roleIDs, &roleNames, &group.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	group.Roles = make([]model.Role, 0, len(roleIDs))
+	for i := range roleIDs {
+		group.Roles = append(group.Roles, model.Role{ID: model.UserRole(roleIDs[i]), Name: roleNames[i]})
+	}
+
+	return &group, nil
+}
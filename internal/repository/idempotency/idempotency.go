@@ -0,0 +1,193 @@
+package idempotency
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const tableName = "idempotency"
+
+type Repository interface {
+	// Reserve занимает ключ под новый запрос. Если ключ уже занят,
+	// возвращается существующая запись и false. Ключи разных пользователей не пересекаются
+	Reserve(ctx context.Context, record *model.IdempotencyRecord, ttl time.Duration) (*model.IdempotencyRecord, bool, error)
+	Complete(ctx context.Context, record *model.IdempotencyRecord, response []byte) error
+	Release(ctx context.Context, record *model.IdempotencyRecord) error
+	DeleteExpired(ctx context.Context) (int64, error)
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Reserve(ctx context.Context, record *model.IdempotencyRecord, ttl time.Duration) (*model.IdempotencyRecord, bool, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	// Просроченная запись не должна мешать повторному использованию ключа
+	deleteQuery, v, err := sq.Delete(tableName).
+		Where(recordKey(orgID, record)).
+		Where("expires_at < now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if _, err = r.pool.Exec(ctx, deleteQuery, v...); err != nil {
+		return nil, false, err
+	}
+
+	query, v, err := sq.Insert(tableName).
+		Columns("organization_id", "username", "key", "method", "request_hash", "expires_at").
+		Values(orgID, record.Username, record.Key, record.Method, record.RequestHash, sq.Expr("now() + ?::interval", ttl)).
+		Suffix("on conflict (organization_id, username, key, method) do nothing").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, false, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("idempotency.Reserve: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if pg.RowsAffected() == 1 {
+		return record, true, nil
+	}
+
+	existing, err := r.get(ctx, orgID, record)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return existing, false, nil
+}
+
+func (r *repository) Complete(ctx context.Context, record *model.IdempotencyRecord, response []byte) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("response", response).
+		Where(recordKey(orgID, record)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("idempotency.Complete: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) Release(ctx context.Context, record *model.IdempotencyRecord) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Delete(tableName).
+		Where(recordKey(orgID, record)).
+		Where(sq.Eq{"response": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("idempotency.Release: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+	return err
+}
+
+func (r *repository) DeleteExpired(ctx context.Context) (int64, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query, v, err := sq.Delete(tableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		Where("expires_at < now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return 0, err
+	}
+
+	return pg.RowsAffected(), nil
+}
+
+func (r *repository) get(ctx context.Context, orgID int64, key *model.IdempotencyRecord) (*model.IdempotencyRecord, error) {
+	query, v, err := sq.Select("key", "method", "username", "request_hash", "response", "created_at", "expires_at").
+		From(tableName).
+		Where(recordKey(orgID, key)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	var record model.IdempotencyRecord
+	err = r.pool.QueryRow(ctx, query, v...).
+		Scan(&record.Key, &record.Method, &record.Username, &record.RequestHash, &record.Response, &record.CreatedAt, &record.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &record, nil
+}
+
+// recordKey условие на первичный ключ записи
+func recordKey(orgID int64, record *model.IdempotencyRecord) sq.Eq {
+	return sq.Eq{"organization_id": orgID, "username": record.Username, "key": record.Key, "method": record.Method}
+}
@@ -0,0 +1,352 @@
+package mfa
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const (
+	tableName             = "user_mfa"
+	recoveryCodeTableName = "mfa_recovery_code"
+	policyTableName       = "mfa_role_policy"
+)
+
+type Repository interface {
+	Get(ctx context.Context, username string) (*model.Mfa, error)
+	// SetSecret начинает подключение заново с новым секретом.
+	// Подтверждённый второй фактор не перезаписывается, возвращается ErrRecordNotFound
+	SetSecret(ctx context.Context, username, secret string) error
+	// Confirm подтверждает подключение, принимая шаг step,
+	// и заменяет коды восстановления указанными хешами
+	Confirm(ctx context.Context, username string, step int64, recoveryCodeHashes []string) error
+	// UseStep принимает код шага step. Возвращает ErrRecordNotFound,
+	// если код этого или более позднего шага уже использовался
+	UseStep(ctx context.Context, username string, step int64) error
+	// UseRecoveryCode отмечает код восстановления использованным.
+	// Возвращает ErrRecordNotFound, если такого неиспользованного кода нет
+	UseRecoveryCode(ctx context.Context, username, codeHash string) error
+	// Delete отключает второй фактор и удаляет коды восстановления
+	Delete(ctx context.Context, username string) error
+
+	// IsRequired сообщает, обязателен ли второй фактор хотя бы для одной из ролей
+	IsRequired(ctx context.Context, roles ...model.UserRole) (bool, error)
+	GetPolicies(ctx context.Context) ([]*model.MfaRolePolicy, error)
+	SetPolicy(ctx context.Context, policy *model.MfaRolePolicy) error
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Get(ctx context.Context, username string) (*model.Mfa, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select("username", "secret", "created_at", "confirmed_at", "last_used_step").
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "username": username}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.Get: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var mfa model.Mfa
+	err = r.pool.QueryRow(ctx, query, v...).
+		Scan(&mfa.Username, &mfa.Secret, &mfa.CreatedAt, &mfa.ConfirmedAt, &mfa.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &mfa, nil
+}
+
+func (r *repository) SetSecret(ctx context.Context, username, secret string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Insert(tableName).
+		Columns("organization_id", "username", "secret").
+		Values(orgID, username, secret).
+		Suffix(`on conflict (organization_id, username) do update set
+			secret = excluded.secret,
+			created_at = now(),
+			last_used_step = 0
+			where user_mfa.confirmed_at is null`).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.SetSecret: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, r.pool, query, v)
+}
+
+func (r *repository) Confirm(ctx context.Context, username string, step int64, recoveryCodeHashes []string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	confirmQuery, confirmValues, err := sq.Update(tableName).
+		Set("confirmed_at", sq.Expr("now()")).
+		Set("last_used_step", step).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "confirmed_at": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.Confirm: query: '%s' values: '%+v'\n", confirmQuery, confirmValues)
+	}
+
+	return r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if err := r.execOne(ctx, tx, confirmQuery, confirmValues); err != nil {
+			return err
+		}
+
+		return r.replaceRecoveryCodes(ctx, tx, orgID, username, recoveryCodeHashes)
+	})
+}
+
+func (r *repository) replaceRecoveryCodes(ctx context.Context, tx pgx.Tx, orgID int64, username string, hashes []string) error {
+	deleteQuery, v, err := sq.Delete(recoveryCodeTableName).
+		Where(sq.Eq{"organization_id": orgID, "username": username}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.replaceRecoveryCodes: query: '%s' values: '%+v'\n", deleteQuery, v)
+	}
+
+	if _, err = tx.Exec(ctx, deleteQuery, v...); err != nil {
+		return err
+	}
+
+	if len(hashes) == 0 {
+		return nil
+	}
+
+	insert := sq.Insert(recoveryCodeTableName).
+		Columns("organization_id", "username", "code_hash").
+		PlaceholderFormat(sq.Dollar)
+	for _, hash := range hashes {
+		insert = insert.Values(orgID, username, hash)
+	}
+
+	insertQuery, v, err := insert.ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.replaceRecoveryCodes: query: '%s' values: '%+v'\n", insertQuery, v)
+	}
+
+	_, err = tx.Exec(ctx, insertQuery, v...)
+	return err
+}
+
+func (r *repository) UseStep(ctx context.Context, username string, step int64) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("last_used_step", step).
+		Where(sq.Eq{"organization_id": orgID, "username": username}).
+		Where(sq.Lt{"last_used_step": step}).
+		Where(sq.NotEq{"confirmed_at": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.UseStep: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, r.pool, query, v)
+}
+
+func (r *repository) UseRecoveryCode(ctx context.Context, username, codeHash string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(recoveryCodeTableName).
+		Set("used_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "code_hash": codeHash, "used_at": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.UseRecoveryCode: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	return r.execOne(ctx, r.pool, query, v)
+}
+
+func (r *repository) Delete(ctx context.Context, username string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		for _, table := range []string{recoveryCodeTableName, tableName} {
+			query, v, err := sq.Delete(table).
+				Where(sq.Eq{"organization_id": orgID, "username": username}).
+				PlaceholderFormat(sq.Dollar).
+				ToSql()
+			if err != nil {
+				return err
+			}
+
+			if config.PostgresDev {
+				log.Printf("mfa.Delete: query: '%s' values: '%+v'\n", query, v)
+			}
+
+			if _, err = tx.Exec(ctx, query, v...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *repository) IsRequired(ctx context.Context, roles ...model.UserRole) (bool, error) {
+	query, v, err := sq.Select("coalesce(bool_or(required), false)").
+		From(policyTableName).
+		Where(sq.Eq{"role": roles}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.IsRequired: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var required bool
+	if err = r.pool.QueryRow(ctx, query, v...).Scan(&required); err != nil {
+		return false, err
+	}
+
+	return required, nil
+}
+
+func (r *repository) GetPolicies(ctx context.Context) ([]*model.MfaRolePolicy, error) {
+	// Роли без записи о политике показываются с необязательным вторым фактором
+	query, v, err := sq.Select("user_role.id", "user_role.name", "coalesce(mfa_role_policy.required, false)").
+		From("user_role").
+		LeftJoin(policyTableName + " on mfa_role_policy.role = user_role.id").
+		OrderBy("user_role.id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.GetPolicies: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var policies []*model.MfaRolePolicy
+	for rows.Next() {
+		var policy model.MfaRolePolicy
+		if err = rows.Scan(&policy.Role, &policy.RoleName, &policy.Required); err != nil {
+			return nil, err
+		}
+		policies = append(policies, &policy)
+	}
+
+	return policies, rows.Err()
+}
+
+func (r *repository) SetPolicy(ctx context.Context, policy *model.MfaRolePolicy) error {
+	query, v, err := sq.Insert(policyTableName).
+		Columns("role", "required").
+		Values(policy.Role, policy.Required).
+		Suffix("on conflict (role) do update set required = excluded.required").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("mfa.SetPolicy: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+	return err
+}
+
+// execer общий интерфейс пула и транзакции
+type execer interface {
+	Exec(ctx context.Context, sql string, arguments ...interface{}) (pgconn.CommandTag, error)
+}
+
+func (r *repository) execOne(ctx context.Context, db execer, query string, v []interface{}) error {
+	pg, err := db.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
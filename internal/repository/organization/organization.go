@@ -0,0 +1,132 @@
+package organization
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const tableName = "organization"
+
+var columns = []string{"id", "name", "created_at"}
+
+// Repository хранит организации. Запросы не ограничены организацией из контекста:
+// по ним организация запроса и определяется
+type Repository interface {
+	// Create возвращает ErrAlreadyExists, если организация с таким именем уже есть
+	Create(ctx context.Context, name string) (*model.Organization, error)
+	GetByName(ctx context.Context, name string) (*model.Organization, error)
+	List(ctx context.Context) ([]*model.Organization, error)
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Create(ctx context.Context, name string) (*model.Organization, error) {
+	query, v, err := sq.Insert(tableName).
+		Columns("name").
+		Values(name).
+		Suffix("returning id, name, created_at").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("organization.Create: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	organization, err := scanOrganization(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == repo.UniqueViolation {
+			return nil, repo.ErrAlreadyExists
+		}
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+func (r *repository) GetByName(ctx context.Context, name string) (*model.Organization, error) {
+	query, v, err := sq.Select(columns...).
+		From(tableName).
+		Where(sq.Eq{"name": name}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("organization.GetByName: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	organization, err := scanOrganization(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+func (r *repository) List(ctx context.Context) ([]*model.Organization, error) {
+	query, v, err := sq.Select(columns...).
+		From(tableName).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("organization.List: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var organizations []*model.Organization
+	for rows.Next() {
+		organization, err := scanOrganization(rows)
+		if err != nil {
+			return nil, err
+		}
+		organizations = append(organizations, organization)
+	}
+
+	return organizations, rows.Err()
+}
+
+func scanOrganization(row pgx.Row) (*model.Organization, error) {
+	var organization model.Organization
+	if err := row.Scan(&organization.ID, &organization.Name, &organization.CreatedAt); err != nil {
+		return nil, err
+	}
+
+	return &organization, nil
+}
@@ -0,0 +1,176 @@
+package permission
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const (
+	tableName     = "permission"
+	roleTableName = "role_permission"
+)
+
+type Repository interface {
+	Get(ctx context.Context, name string) (*model.Permission, error)
+	List(ctx context.Context) ([]*model.Permission, error)
+	// ListByRoles возвращает имена разрешений, выданных хотя бы одной из ролей
+	ListByRoles(ctx context.Context, roles ...model.UserRole) ([]string, error)
+	Grant(ctx context.Context, role model.UserRole, permission string) error
+	// Revoke возвращает ErrRecordNotFound, если у роли не было разрешения
+	Revoke(ctx context.Context, role model.UserRole, permission string) error
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Get(ctx context.Context, name string) (*model.Permission, error) {
+	query, v, err := sq.Select("name", "description").
+		From(tableName).
+		Where(sq.Eq{"name": name}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("permission.Get: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var permission model.Permission
+	err = r.pool.QueryRow(ctx, query, v...).Scan(&permission.Name, &permission.Description)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &permission, nil
+}
+
+func (r *repository) List(ctx context.Context) ([]*model.Permission, error) {
+	query, v, err := sq.Select("name", "description").
+		From(tableName).
+		OrderBy("name").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("permission.List: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []*model.Permission
+	for rows.Next() {
+		var permission model.Permission
+		if err = rows.Scan(&permission.Name, &permission.Description); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, &permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (r *repository) ListByRoles(ctx context.Context, roles ...model.UserRole) ([]string, error) {
+	query, v, err := sq.Select("permission").
+		Distinct().
+		From(roleTableName).
+		Where(sq.Eq{"role": roles}).
+		OrderBy("permission").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("permission.ListByRoles: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var permissions []string
+	for rows.Next() {
+		var permission string
+		if err = rows.Scan(&permission); err != nil {
+			return nil, err
+		}
+		permissions = append(permissions, permission)
+	}
+
+	return permissions, rows.Err()
+}
+
+func (r *repository) Grant(ctx context.Context, role model.UserRole, permission string) error {
+	query, v, err := sq.Insert(roleTableName).
+		Columns("role", "permission").
+		Values(role, permission).
+		Suffix("on conflict do nothing").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("permission.Grant: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+	return err
+}
+
+func (r *repository) Revoke(ctx context.Context, role model.UserRole, permission string) error {
+	query, v, err := sq.Delete(roleTableName).
+		Where(sq.Eq{"role": role, "permission": permission}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("permission.Revoke: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
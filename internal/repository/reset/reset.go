@@ -0,0 +1,148 @@
+package reset
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const tableName = "password_reset_token"
+
+type Repository interface {
+	Create(ctx context.Context, username, tokenHash string, ttl time.Duration) error
+	// Get возвращает неиспользованный и не просроченный токен
+	Get(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error)
+	// Consume помечает токен использованным. Возвращает ErrRecordNotFound,
+	// если токен уже использован или просрочен
+	Consume(ctx context.Context, tokenHash string) error
+	// InvalidateAll помечает использованными все токены пользователя
+	InvalidateAll(ctx context.Context, username string) error
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Create(ctx context.Context, username, tokenHash string, ttl time.Duration) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Insert(tableName).
+		Columns("organization_id", "username", "token_hash", "expires_at").
+		Values(orgID, username, tokenHash, sq.Expr("now() + ?::interval", ttl)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("reset.Create: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+	return err
+}
+
+func (r *repository) Get(ctx context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select("username", "expires_at").
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "token_hash": tokenHash, "used_at": nil}).
+		Where("expires_at > now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("reset.Get: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var resetToken model.PasswordResetToken
+	if err = r.pool.QueryRow(ctx, query, v...).Scan(&resetToken.Username, &resetToken.ExpiresAt); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &resetToken, nil
+}
+
+func (r *repository) Consume(ctx context.Context, tokenHash string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("used_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "token_hash": tokenHash, "used_at": nil}).
+		Where("expires_at > now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("reset.Consume: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) InvalidateAll(ctx context.Context, username string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("used_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "used_at": nil}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("reset.InvalidateAll: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+	return err
+}
@@ -0,0 +1,326 @@
+package role
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const (
+	tableName           = "user_role"
+	assignmentTableName = "user_role_assignment"
+)
+
+var columns = []string{"id", "name", "built_in"}
+
+// Repository хранит роли и их назначения. Роли общие для всех организаций,
+// назначения ограничены организацией из контекста
+type Repository interface {
+	// Create возвращает ErrAlreadyExists, если роль с таким именем уже есть
+	Create(ctx context.Context, name string) (*model.Role, error)
+	Get(ctx context.Context, id model.UserRole) (*model.Role, error)
+	GetByName(ctx context.Context, name string) (*model.Role, error)
+	List(ctx context.Context) ([]*model.Role, error)
+	// Rename возвращает ErrAlreadyExists, если имя занято другой ролью
+	Rename(ctx context.Context, name, newName string) error
+	// Delete возвращает ErrInUse, если роль назначена пользователям
+	Delete(ctx context.Context, name string) error
+
+	// Assign возвращает ErrAlreadyExists, если роль уже назначена пользователю.
+	// Истёкшее назначение заменяется новым
+	Assign(ctx context.Context, grant *model.RoleGrant) error
+	// Unassign возвращает ErrRecordNotFound, если роль не была назначена
+	Unassign(ctx context.Context, username string, role model.UserRole) error
+	// DeleteExpired удаляет истёкшие назначения и возвращает их
+	DeleteExpired(ctx context.Context) ([]*model.RoleGrant, error)
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Create(ctx context.Context, name string) (*model.Role, error) {
+	query, v, err := sq.Insert(tableName).
+		Columns("name").
+		Values(name).
+		Suffix("returning id, name, built_in").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("role.Create: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	role, err := scanRole(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		return nil, mapError(err)
+	}
+
+	return role, nil
+}
+
+func (r *repository) Get(ctx context.Context, id model.UserRole) (*model.Role, error) {
+	return r.getBy(ctx, "role.Get", sq.Eq{"id": id})
+}
+
+func (r *repository) GetByName(ctx context.Context, name string) (*model.Role, error) {
+	return r.getBy(ctx, "role.GetByName", sq.Eq{"name": name})
+}
+
+func (r *repository) getBy(ctx context.Context, caller string, where sq.Eq) (*model.Role, error) {
+	query, v, err := sq.Select(columns...).
+		From(tableName).
+		Where(where).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("%s: query: '%s' values: '%+v'\n", caller, query, v)
+	}
+
+	role, err := scanRole(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (r *repository) List(ctx context.Context) ([]*model.Role, error) {
+	query, v, err := sq.Select(columns...).
+		From(tableName).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("role.List: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []*model.Role
+	for rows.Next() {
+		role, err := scanRole(rows)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	return roles, rows.Err()
+}
+
+func (r *repository) Rename(ctx context.Context, name, newName string) error {
+	query, v, err := sq.Update(tableName).
+		Set("name", newName).
+		Where(sq.Eq{"name": name}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("role.Rename: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) Delete(ctx context.Context, name string) error {
+	query, v, err := sq.Delete(tableName).
+		Where(sq.Eq{"name": name}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("role.Delete: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) Assign(ctx context.Context, grant *model.RoleGrant) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Insert(assignmentTableName).
+		Columns("organization_id", "username", "role", "valid_from", "valid_until", "reason").
+		Values(orgID, grant.Username, grant.Role.ID, grant.ValidFrom, grant.ValidUntil, grant.Reason).
+		Suffix(`on conflict (organization_id, username, role) do update set
+			valid_from = excluded.valid_from,
+			valid_until = excluded.valid_until,
+			reason = excluded.reason,
+			created_at = now()
+			where user_role_assignment.valid_until <= now()`).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("role.Assign: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return mapError(err)
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrAlreadyExists
+	}
+
+	return nil
+}
+
+func (r *repository) Unassign(ctx context.Context, username string, role model.UserRole) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Delete(assignmentTableName).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "role": role}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("role.Unassign: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) DeleteExpired(ctx context.Context) ([]*model.RoleGrant, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Delete(assignmentTableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		Where("valid_until <= now()").
+		Suffix(`returning username, role,
+			(select user_role.name from user_role where user_role.id = user_role_assignment.role),
+			valid_from, valid_until, reason`).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("role.DeleteExpired: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var grants []*model.RoleGrant
+	for rows.Next() {
+		var grant model.RoleGrant
+		err = rows.Scan(&grant.Username, &grant.Role.ID, &grant.Role.Name, &grant.ValidFrom, &grant.ValidUntil, &grant.Reason)
+		if err != nil {
+			return nil, err
+		}
+		grants = append(grants, &grant)
+	}
+
+	return grants, rows.Err()
+}
+
+// mapError переводит нарушения ограничений в ошибки репозитория
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		switch pgErr.Code {
+		case repo.UniqueViolation:
+			return repo.ErrAlreadyExists
+		case repo.ForeignKeyViolation:
+			return repo.ErrInUse
+		}
+	}
+
+	return err
+}
+
+func scanRole(row pgx.Row) (*model.Role, error) {
+	var role model.Role
+	if err := row.Scan(&role.ID, &role.Name, &role.BuiltIn); err != nil {
+		return nil, err
+	}
+
+	return &role, nil
+}
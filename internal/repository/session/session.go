@@ -0,0 +1,187 @@
+package session
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const tableName = "session"
+
+type Repository interface {
+	// Create выдаёт сессию. mfaEnrollmentRequired ограничивает её подключением второго фактора
+	Create(ctx context.Context, username, tokenHash string, mfaEnrollmentRequired bool, ttl time.Duration) (*model.Session, error)
+	// Get возвращает неотозванную и неистёкшую сессию по хешу токена
+	Get(ctx context.Context, tokenHash string) (*model.Session, error)
+	// CompleteMfaEnrollment снимает ограничение с действующих сессий пользователя,
+	// подключившего второй фактор
+	CompleteMfaEnrollment(ctx context.Context, username string) error
+	// RevokeAll отзывает все действующие сессии пользователя
+	RevokeAll(ctx context.Context, username string) (int64, error)
+	// RevokeAllExcept отзывает все действующие сессии пользователя, кроме сессии id
+	RevokeAllExcept(ctx context.Context, username string, id int64) (int64, error)
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Create(ctx context.Context, username, tokenHash string, mfaEnrollmentRequired bool, ttl time.Duration) (*model.Session, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Insert(tableName).
+		Columns("organization_id", "username", "token_hash", "mfa_enrollment_required", "expires_at").
+		Values(orgID, username, tokenHash, mfaEnrollmentRequired, sq.Expr("now() + ?::interval", ttl)).
+		Suffix("returning id, organization_id, username, created_at, expires_at, mfa_enrollment_required").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("session.Create: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var session model.Session
+	err = r.pool.QueryRow(ctx, query, v...).
+		Scan(&session.ID, &session.OrganizationID, &session.Username, &session.CreatedAt, &session.ExpiresAt, &session.MfaEnrollmentRequired)
+	if err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (r *repository) Get(ctx context.Context, tokenHash string) (*model.Session, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select("id", "organization_id", "username", "created_at", "expires_at", "mfa_enrollment_required").
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "token_hash": tokenHash, "revoked_at": nil}).
+		Where("expires_at > now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("session.Get: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var session model.Session
+	err = r.pool.QueryRow(ctx, query, v...).
+		Scan(&session.ID, &session.OrganizationID, &session.Username, &session.CreatedAt, &session.ExpiresAt, &session.MfaEnrollmentRequired)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (r *repository) RevokeAll(ctx context.Context, username string) (int64, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("revoked_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "revoked_at": nil}).
+		Where("expires_at > now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("session.RevokeAll: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return 0, err
+	}
+
+	return pg.RowsAffected(), nil
+}
+
+func (r *repository) RevokeAllExcept(ctx context.Context, username string, id int64) (int64, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("revoked_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "revoked_at": nil}).
+		Where(sq.NotEq{"id": id}).
+		Where("expires_at > now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("session.RevokeAllExcept: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return 0, err
+	}
+
+	return pg.RowsAffected(), nil
+}
+
+func (r *repository) CompleteMfaEnrollment(ctx context.Context, username string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("mfa_enrollment_required", false).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "revoked_at": nil, "mfa_enrollment_required": true}).
+		Where("expires_at > now()").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("session.CompleteMfaEnrollment: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+
+	return err
+}
@@ -0,0 +1,38 @@
+package repository
+
+import (
+	"context"
+	"log"
+	"strconv"
+
+	"github.com/jackc/pgx/v4"
+
+	"github.com/Slintox/user-service/internal/tenant"
+)
+
+// TenantID возвращает id организации, которой ограничиваются запросы репозиториев
+func TenantID(ctx context.Context) (int64, error) {
+	organizationID, ok := tenant.FromContext(ctx)
+	if !ok {
+		return 0, ErrNoTenant
+	}
+
+	return organizationID, nil
+}
+
+// SetTenant выставляет организацию запроса в настройку сеанса app.organization_id,
+// по которой политики row level security ограничивают видимые строки.
+// Вызывается при выдаче соединения из пула, без организации строки не видны
+func SetTenant(ctx context.Context, conn *pgx.Conn) bool {
+	var setting string
+	if organizationID, ok := tenant.FromContext(ctx); ok {
+		setting = strconv.FormatInt(organizationID, 10)
+	}
+
+	if _, err := conn.Exec(ctx, "select set_config('app.organization_id', $1, false)", setting); err != nil {
+		log.Printf("repository.SetTenant: %s", err.Error())
+		return false
+	}
+
+	return true
+}
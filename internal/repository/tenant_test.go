@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/pkg/database/postgres"
+)
+
+// testDSNEnv задаёт базу с применёнными миграциями и роль сервиса для интеграционных тестов
+const testDSNEnv = "PG_TEST_DSN"
+
+func TestRowLevelSecurityHidesRowsWithoutTenant(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s не задан", testDSNEnv)
+	}
+
+	ctx := context.Background()
+	pool, err := postgres.Connect(ctx, &config.PostgresConfig{DSN: dsn}, SetTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer pool.Close()
+
+	// Суперпользователь и роль с bypassrls видят все строки, проверка на них бессмысленна
+	var superuser, bypassRLS bool
+	if err = pool.QueryRow(ctx, "select rolsuper, rolbypassrls from pg_roles where rolname = current_user").Scan(&superuser, &bypassRLS); err != nil {
+		t.Fatal(err)
+	}
+	if superuser || bypassRLS {
+		t.Fatalf("роль сервиса обходит row level security: superuser = %v, bypassrls = %v", superuser, bypassRLS)
+	}
+
+	tenantCtx := tenant.NewContext(ctx, model.DefaultOrganizationID)
+	const subject = "rls-test"
+
+	if _, err = pool.Exec(tenantCtx, "insert into login_throttle (organization_id, subject) values ($1, $2)", model.DefaultOrganizationID, subject); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		if _, err := pool.Exec(tenantCtx, "delete from login_throttle where subject = $1", subject); err != nil {
+			t.Error(err)
+		}
+	}()
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		want int
+	}{
+		{name: "without tenant", ctx: ctx},
+		{name: "other tenant", ctx: tenant.NewContext(ctx, model.DefaultOrganizationID+1)},
+		{name: "with tenant", ctx: tenantCtx, want: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var count int
+			if err := pool.QueryRow(tt.ctx, "select count(*) from login_throttle where subject = $1", subject).Scan(&count); err != nil {
+				t.Fatal(err)
+			}
+			if count != tt.want {
+				t.Fatalf("count = %d, want %d", count, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,280 @@
+package throttle
+
+import (
+	"context"
+	"errors"
+	"log"
+	"sort"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const tableName = "login_throttle"
+
+// Repository хранит неудачные попытки входа по субъектам (пользователь, IP-адрес).
+// Тот же счётчик с окном используется для ограничения частоты других действий,
+// субъекты которых отличаются префиксом.
+// Состояние хранится в Postgres, чтобы блокировки действовали на всех репликах.
+// Счётчики ведутся отдельно для каждой организации
+type Repository interface {
+	// Reserve атомарно проверяет блокировки субъектов и заранее учитывает попытку
+	// как неудачную для каждого из них, выставляя блокировку, которую дала бы неудача.
+	// Если хотя бы один субъект заблокирован, попытка не учитывается и возвращается
+	// наибольшее оставшееся время блокировки. Иначе возвращаются учтённые попытки
+	// в порядке limits
+	Reserve(ctx context.Context, limits ...Limit) ([]Reservation, time.Duration, error)
+	// Release снимает со счётчиков попытку, учтённую Reserve, если она не оказалась неудачной,
+	// и возвращает время последней неудачи и блокировку, которые были до учёта.
+	// Если после Reserve субъект успел получить другую неудачу, её блокировка остаётся
+	Release(ctx context.Context, reservations ...Reservation) error
+	// Reset снимает блокировку и сбрасывает счётчик. Возвращает false, если записи не было
+	Reset(ctx context.Context, subject string) (bool, error)
+}
+
+// Limit описывает ограничение попыток одного субъекта
+type Limit struct {
+	Subject string
+	// Счётчик начинается заново, если последняя неудача была раньше Window
+	Window time.Duration
+	// Delay возвращает блокировку после failures неудач подряд, 0 - без блокировки
+	Delay func(failures int) time.Duration
+}
+
+// Reservation попытка, заранее учтённая Reserve, и состояние субъекта до неё
+type Reservation struct {
+	Subject string
+	// Счётчик неудач после учёта попытки
+	Failures int
+	// Время учёта, по нему Release узнаёт, что других неудач после него не было
+	ReservedAt time.Time
+	// Время последней неудачи и блокировка до учёта
+	PrevLastFailureAt time.Time
+	PrevBlockedUntil  *time.Time
+}
+
+// errBlocked откатывает транзакцию Reserve, если попытка не учитывается
+var errBlocked = errors.New("subject is blocked")
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) Reserve(ctx context.Context, limits ...Limit) ([]Reservation, time.Duration, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	// Строки блокируются в одном порядке, чтобы параллельные попытки не ждали друг друга по кругу
+	subjects := make([]string, 0, len(limits))
+	for _, limit := range limits {
+		subjects = append(subjects, limit.Subject)
+	}
+	sort.Strings(subjects)
+
+	insert := sq.Insert(tableName).
+		Columns("organization_id", "subject", "failures", "last_failure_at").
+		Suffix("on conflict (organization_id, subject) do nothing").
+		PlaceholderFormat(sq.Dollar)
+	for _, subject := range subjects {
+		insert = insert.Values(orgID, subject, 0, sq.Expr("now()"))
+	}
+
+	insertQuery, insertValues, err := insert.ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	selectQuery, selectValues, err := sq.Select(
+		"subject",
+		"failures",
+		"extract(epoch from now() - last_failure_at)::float8",
+		"coalesce(extract(epoch from blocked_until - now()), 0)::float8",
+		"last_failure_at",
+		"blocked_until",
+		"now()::timestamp",
+	).
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "subject": subjects}).
+		OrderBy("subject").
+		Suffix("for update").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, 0, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("throttle.Reserve: query: '%s' values: '%+v'\n", insertQuery, insertValues)
+		log.Printf("throttle.Reserve: query: '%s' values: '%+v'\n", selectQuery, selectValues)
+	}
+
+	type state struct {
+		failures      int
+		sinceLast     time.Duration
+		lastFailureAt time.Time
+		blockedUntil  *time.Time
+		now           time.Time
+	}
+
+	reservations := make([]Reservation, len(limits))
+	var blockedFor time.Duration
+
+	err = r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, insertQuery, insertValues...); err != nil {
+			return err
+		}
+
+		rows, err := tx.Query(ctx, selectQuery, selectValues...)
+		if err != nil {
+			return err
+		}
+
+		states := make(map[string]state, len(subjects))
+		for rows.Next() {
+			var subject string
+			var current state
+			var sinceLast, blocked float64
+			if err = rows.Scan(&subject, &current.failures, &sinceLast, &blocked, &current.lastFailureAt, &current.blockedUntil, &current.now); err != nil {
+				rows.Close()
+				return err
+			}
+			current.sinceLast = time.Duration(sinceLast * float64(time.Second))
+			states[subject] = current
+
+			if remaining := time.Duration(blocked * float64(time.Second)); remaining > blockedFor {
+				blockedFor = remaining
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		if blockedFor > 0 {
+			return errBlocked
+		}
+
+		for i, limit := range limits {
+			current := states[limit.Subject]
+
+			failures := current.failures + 1
+			if current.sinceLast > limit.Window {
+				failures = 1
+			}
+			reservations[i] = Reservation{
+				Subject:           limit.Subject,
+				Failures:          failures,
+				ReservedAt:        current.now,
+				PrevLastFailureAt: current.lastFailureAt,
+				PrevBlockedUntil:  current.blockedUntil,
+			}
+
+			update := sq.Update(tableName).
+				Set("failures", failures).
+				Set("last_failure_at", sq.Expr("now()")).
+				Where(sq.Eq{"organization_id": orgID, "subject": limit.Subject}).
+				PlaceholderFormat(sq.Dollar)
+			if delay := limit.Delay(failures); delay > 0 {
+				update = update.Set("blocked_until", sq.Expr("now() + ?::interval", delay))
+			}
+
+			query, v, err := update.ToSql()
+			if err != nil {
+				return err
+			}
+
+			if config.PostgresDev {
+				log.Printf("throttle.Reserve: query: '%s' values: '%+v'\n", query, v)
+			}
+
+			if _, err = tx.Exec(ctx, query, v...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		if errors.Is(err, errBlocked) {
+			return nil, blockedFor, nil
+		}
+		return nil, 0, err
+	}
+
+	return reservations, 0, nil
+}
+
+func (r *repository) Release(ctx context.Context, reservations ...Reservation) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	return r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		for _, reservation := range reservations {
+			// Прежнее состояние возвращается, только если последней неудачей осталась эта попытка.
+			// В set все выражения видят строку до обновления
+			query, v, err := sq.Update(tableName).
+				Set("failures", sq.Expr("greatest(failures - 1, 0)")).
+				Set("last_failure_at", sq.Expr("case when last_failure_at = ? then ? else last_failure_at end",
+					reservation.ReservedAt, reservation.PrevLastFailureAt)).
+				Set("blocked_until", sq.Expr("case when last_failure_at = ? then ?::timestamp else blocked_until end",
+					reservation.ReservedAt, reservation.PrevBlockedUntil)).
+				Where(sq.Eq{"organization_id": orgID, "subject": reservation.Subject}).
+				PlaceholderFormat(sq.Dollar).
+				ToSql()
+			if err != nil {
+				return err
+			}
+
+			if config.PostgresDev {
+				log.Printf("throttle.Release: query: '%s' values: '%+v'\n", query, v)
+			}
+
+			if _, err = tx.Exec(ctx, query, v...); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+}
+
+func (r *repository) Reset(ctx context.Context, subject string) (bool, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	query, v, err := sq.Delete(tableName).
+		Where(sq.Eq{"organization_id": orgID, "subject": subject}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return false, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("throttle.Reset: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return false, err
+	}
+
+	return pg.RowsAffected() > 0, nil
+}
@@ -0,0 +1,117 @@
+package user
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/repository/group"
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/pkg/database/postgres"
+)
+
+// testDSNEnv задаёт базу с применёнными миграциями и роль сервиса для интеграционных тестов
+const testDSNEnv = "PG_TEST_DSN"
+
+func TestGroupCycleYieldsInheritedRoles(t *testing.T) {
+	dsn := os.Getenv(testDSNEnv)
+	if dsn == "" {
+		t.Skipf("%s не задан", testDSNEnv)
+	}
+
+	// Запрос, зациклившийся на вложенности групп, прервётся по таймауту
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+
+	pool, err := postgres.Connect(ctx, &config.PostgresConfig{DSN: dsn}, repo.SetTenant)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(pool.Close)
+
+	ctx = tenant.NewContext(ctx, model.DefaultOrganizationID)
+	users := NewRepository(pool, 0)
+	groups := group.NewRepository(pool)
+
+	suffix := time.Now().UnixNano()
+	username := fmt.Sprintf("cycle-user-%d", suffix)
+
+	if err = users.Add(ctx, &model.CreateUser{
+		Username: username,
+		Email:    username + "@example.com",
+		Password: "hash",
+		Role:     model.UserRoleUser,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		if _, err := users.Delete(ctx, username, nil); err != nil {
+			t.Error(err)
+		}
+	})
+
+	createGroup := func(name string) *model.Group {
+		g, err := groups.Create(ctx, fmt.Sprintf("%s-%d", name, suffix))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() {
+			if err := groups.Delete(ctx, g.ID); err != nil {
+				t.Error(err)
+			}
+		})
+		return g
+	}
+	a, b := createGroup("cycle-a"), createGroup("cycle-b")
+
+	if err = groups.AddUser(ctx, a.ID, username); err != nil {
+		t.Fatal(err)
+	}
+	// A входит в B через репозиторий, обратное ребро AddGroup отклонит,
+	// поэтому цикл замыкается прямой вставкой
+	if err = groups.AddGroup(ctx, b.ID, a.ID); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = pool.Exec(ctx, "insert into group_member_group (organization_id, group_id, member_group_id) values ($1, $2, $3)",
+		model.DefaultOrganizationID, a.ID, b.ID); err != nil {
+		t.Fatal(err)
+	}
+	if err = groups.AssignRole(ctx, b.ID, model.UserRoleAdmin); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := users.Get(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(user.RoleIDs()), fmt.Sprint([]model.UserRole{model.UserRoleUser, model.UserRoleAdmin}); got != want {
+		t.Fatalf("roles = %s, want %s", got, want)
+	}
+
+	memberships, err := groups.ListUserGroups(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []model.GroupMembership{{GroupName: a.Name, Direct: true}, {GroupName: b.Name}}
+	if len(memberships) != len(want) {
+		t.Fatalf("len(memberships) = %d, want %d", len(memberships), len(want))
+	}
+	for i, membership := range memberships {
+		if *membership != want[i] {
+			t.Fatalf("memberships[%d] = %+v, want %+v", i, *membership, want[i])
+		}
+	}
+
+	members, err := groups.ListMembers(ctx, a.ID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, want := fmt.Sprint(members.Usernames, members.GroupNames), fmt.Sprint([]string{username}, []string{b.Name}); got != want {
+		t.Fatalf("members = %s, want %s", got, want)
+	}
+}
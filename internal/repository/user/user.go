@@ -3,41 +3,116 @@ package user
 import (
 	"context"
 	"errors"
+	"fmt"
 	"log"
+	"strings"
 
 	sq "github.com/Masterminds/squirrel"
 	"github.com/Slintox/user-service/config"
 	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
 	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/jackc/pgconn"
 	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-const tableName = `"user"`
+const (
+	tableName           = `"user"`
+	historyTableName    = "password_history"
+	assignmentTableName = "user_role_assignment"
 
+	// Ограничения уникальности, по которым нарушение относится к имени или адресу
+	usernamePkey         = "user_pkey"
+	usernameCanonicalIdx = "user_username_canonical_idx"
+	emailCanonicalIdx    = "user_email_canonical_idx"
+)
+
+// Столбец действующих ролей пользователя в порядке id: назначенных самому пользователю,
+// кроме не начавших действовать и истёкших, и унаследованных от групп.
+// Группы обходятся вверх по вложенности, union отбрасывает повторы,
+// поэтому обход завершается и при цикле
+const userRolesColumn = `array(select user_role.%s from user_role
+	where user_role.id in (
+		select user_role_assignment.role from user_role_assignment
+		where user_role_assignment.organization_id = "user".organization_id
+			and user_role_assignment.username = "user".username
+			and (user_role_assignment.valid_from is null or user_role_assignment.valid_from <= now())
+			and (user_role_assignment.valid_until is null or user_role_assignment.valid_until > now())
+		union
+		select group_role_assignment.role from group_role_assignment
+		where group_role_assignment.organization_id = "user".organization_id
+			and group_role_assignment.group_id in (
+				with recursive member_of(group_id) as (
+					select group_member_user.group_id from group_member_user
+					where group_member_user.organization_id = "user".organization_id
+						and group_member_user.username = "user".username
+					union
+					select group_member_group.group_id from group_member_group
+					join member_of on member_of.group_id = group_member_group.member_group_id
+					where group_member_group.organization_id = "user".organization_id
+				)
+				select group_id from member_of
+			)
+	)
+	order by user_role.id)`
+
+var userColumns = []string{
+	"username", "email", "password",
+	fmt.Sprintf(userRolesColumn, "id"),
+	fmt.Sprintf(userRolesColumn, "name"),
+	"created_at", "updated_at", "version", "email_verified_at",
+}
+
+// Repository хранит пользователей. Все запросы ограничены организацией из контекста,
+// имена и адреса уникальны в её пределах
 type Repository interface {
 	Add(ctx context.Context, user *model.CreateUser) error
 	Get(ctx context.Context, username string) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
 	Update(ctx context.Context, username string, updateData *model.UpdateUser) error
-	Delete(ctx context.Context, username string) error
+	Delete(ctx context.Context, username string, expectedVersion *int64) (*model.User, error)
 	IsUsernameAvailable(ctx context.Context, username string) (bool, error)
+	IsEmailAvailable(ctx context.Context, email string) (bool, error)
+	// GetPasswordHistory возвращает хеши предыдущих паролей, начиная с последнего
+	GetPasswordHistory(ctx context.Context, username string, limit int) ([]string, error)
+	// UpdatePasswordHash заменяет хеш пароля тем же паролем, посчитанным заново.
+	// Замена не выполняется, если хеш успел измениться
+	UpdatePasswordHash(ctx context.Context, username, oldHash, newHash string) error
+	// CountByPasswordAlgorithm возвращает число пользователей по алгоритмам хеширования пароля
+	CountByPasswordAlgorithm(ctx context.Context) (map[string]int64, error)
+	// MarkEmailVerified отмечает email подтверждённым. Возвращает ErrRecordNotFound,
+	// если у пользователя уже другой адрес или он подтверждён
+	MarkEmailVerified(ctx context.Context, username, email string) error
+	// CanonicalizeUsernames пересчитывает канонические формы имён через normalize.Username
+	// и возвращает число исправленных строк. Завершается ErrUsernameTaken, если имена
+	// совпадают после нормализации
+	CanonicalizeUsernames(ctx context.Context) (int64, error)
 }
 
 type repository struct {
 	pool *pgxpool.Pool
+	// Сколько предыдущих хешей пароля хранить для каждого пользователя
+	passwordHistoryDepth int
 }
 
-func NewRepository(pool *pgxpool.Pool) Repository {
+func NewRepository(pool *pgxpool.Pool, passwordHistoryDepth int) Repository {
 	return &repository{
-		pool: pool,
+		pool:                 pool,
+		passwordHistoryDepth: passwordHistoryDepth,
 	}
 }
 
 func (r *repository) Add(ctx context.Context, user *model.CreateUser) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
 	var roleId int
 
 	row := r.pool.QueryRow(ctx, "select id from user_role where id = $1", user.Role)
-	if err := row.Scan(&roleId); err != nil {
+	if err = row.Scan(&roleId); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return repo.ErrRecordNotFound
 		}
@@ -45,8 +120,8 @@ func (r *repository) Add(ctx context.Context, user *model.CreateUser) error {
 	}
 
 	builder := sq.Insert(tableName).
-		Columns("username", "email", "password", "role").
-		Values(user.Username, user.Email, user.Password, user.Role).
+		Columns("organization_id", "username", "username_canonical", "email", "email_canonical", "password").
+		Values(orgID, user.Username, normalize.Username(user.Username), user.Email, normalize.Email(user.Email), user.Password).
 		PlaceholderFormat(sq.Dollar)
 
 	query, v, err := builder.ToSql()
@@ -58,18 +133,47 @@ func (r *repository) Add(ctx context.Context, user *model.CreateUser) error {
 		log.Printf("user.Update: query: '%s' values: '%+v'\n", query, v)
 	}
 
-	_, err = r.pool.Exec(ctx, query, v...)
+	assignQuery, assignV, err := sq.Insert(assignmentTableName).
+		Columns("organization_id", "username", "role").
+		Values(orgID, user.Username, user.Role).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	if config.PostgresDev {
+		log.Printf("user.Add: query: '%s' values: '%+v'\n", assignQuery, assignV)
+	}
+
+	return r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		if _, err := tx.Exec(ctx, query, v...); err != nil {
+			return mapError(err)
+		}
+
+		_, err := tx.Exec(ctx, assignQuery, assignV...)
+		return err
+	})
 }
 
 func (r *repository) Get(ctx context.Context, username string) (*model.User, error) {
-	builder := sq.Select("username", "email", "password", "role", "created_at", "updated_at").
+	return r.getBy(ctx, "user.Get", sq.Eq{"username_canonical": normalize.Username(username)})
+}
+
+func (r *repository) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	return r.getBy(ctx, "user.GetByEmail", sq.Eq{"email_canonical": normalize.Email(email)})
+}
+
+func (r *repository) getBy(ctx context.Context, caller string, where sq.Eq) (*model.User, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	builder := sq.Select(userColumns...).
 		From(tableName).
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"organization_id": orgID}).
+		Where(where).
 		Limit(1).
 		PlaceholderFormat(sq.Dollar)
 
@@ -79,44 +183,46 @@ func (r *repository) Get(ctx context.Context, username string) (*model.User, err
 	}
 
 	if config.PostgresDev {
-		log.Printf("user.Get: query: '%s' values: '%+v'\n", query, v)
+		log.Printf("%s: query: '%s' values: '%+v'\n", caller, query, v)
 	}
 
-	rows := r.pool.QueryRow(ctx, query, v...)
+	user, err := scanUser(r.pool.QueryRow(ctx, query, v...))
 	if err != nil {
-		return nil, err
-	}
-
-	var user model.User
-	if err = rows.Scan(&user.Username, &user.Email, &user.Password, &user.Role, &user.CreatedAt, &user.UpdatedAt); err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return nil, repo.ErrRecordNotFound
 		}
 		return nil, err
 	}
 
-	return &user, nil
+	return user, nil
 }
 
 func (r *repository) Update(ctx context.Context, username string, updateData *model.UpdateUser) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
 	updateQuery := sq.Update(tableName).
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"organization_id": orgID, "username_canonical": normalize.Username(username)}).
 		PlaceholderFormat(sq.Dollar)
 
 	if updateData.Username != nil {
-		updateQuery = updateQuery.Set("username", updateData.Username)
+		updateQuery = updateQuery.Set("username", updateData.Username).
+			Set("username_canonical", normalize.Username(*updateData.Username))
 	}
 	if updateData.Password != nil {
 		updateQuery = updateQuery.Set("password", updateData.Password)
 	}
 	if updateData.Email != nil {
-		updateQuery = updateQuery.Set("email", updateData.Email)
+		canonical := normalize.Email(*updateData.Email)
+		// Подтверждение сохраняется, только если адрес не изменился по существу
+		updateQuery = updateQuery.Set("email", updateData.Email).
+			Set("email_canonical", canonical).
+			Set("email_verified_at", sq.Expr("case when email_canonical = ? then email_verified_at end", canonical))
 	}
-	if updateData.Role != nil {
-		updateQuery = updateQuery.Set("role", updateData.Role)
-	}
-
-	updateQuery = updateQuery.Set("updated_at", "now()")
+	updateQuery = updateQuery.Set("updated_at", "now()").
+		Set("version", sq.Expr("version + 1"))
 
 	query, v, err := updateQuery.ToSql()
 	if err != nil {
@@ -127,44 +233,194 @@ func (r *repository) Update(ctx context.Context, username string, updateData *mo
 		log.Printf("user.Update: query: '%s' values: '%+v'\n", query, v)
 	}
 
-	pg, err := r.pool.Exec(ctx, query, v...)
+	return r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		// Прежний хеш пароля сохраняется в историю до его замены
+		if updateData.Password != nil && r.passwordHistoryDepth > 0 {
+			if err := r.pushPasswordHistory(ctx, tx, orgID, username); err != nil {
+				return err
+			}
+		}
+
+		if updateData.Role != nil {
+			if err := r.replaceRoles(ctx, tx, orgID, username, *updateData.Role); err != nil {
+				return err
+			}
+		}
+
+		pg, err := tx.Exec(ctx, query, v...)
+		if err != nil {
+			return mapError(err)
+		}
+
+		if pg.RowsAffected() == 0 {
+			return repo.ErrRecordNotFound
+		}
+
+		return nil
+	})
+}
+
+// replaceRoles заменяет все роли пользователя одной ролью
+func (r *repository) replaceRoles(ctx context.Context, tx pgx.Tx, orgID int64, username string, role model.UserRole) error {
+	owner := ownerQuery(orgID, username)
+
+	deleteQuery, v, err := sq.Delete(assignmentTableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		Where(sq.Expr("username = (?)", owner)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
 	if err != nil {
 		return err
 	}
 
-	if pg.RowsAffected() == 0 {
-		return repo.ErrRecordNotFound
+	if config.PostgresDev {
+		log.Printf("user.replaceRoles: query: '%s' values: '%+v'\n", deleteQuery, v)
 	}
 
-	return nil
+	if _, err = tx.Exec(ctx, deleteQuery, v...); err != nil {
+		return err
+	}
+
+	insertQuery, v, err := sq.Insert(assignmentTableName).
+		Columns("organization_id", "username", "role").
+		Select(sq.Select("organization_id", "username").
+			Column("?::int", role).
+			From(tableName).
+			Where(sq.Eq{"organization_id": orgID, "username_canonical": normalize.Username(username)})).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("user.replaceRoles: query: '%s' values: '%+v'\n", insertQuery, v)
+	}
+
+	_, err = tx.Exec(ctx, insertQuery, v...)
+	return err
 }
 
-func (r *repository) Delete(ctx context.Context, username string) error {
+// pushPasswordHistory сохраняет текущий хеш пароля в историю
+// и удаляет записи сверх passwordHistoryDepth
+func (r *repository) pushPasswordHistory(ctx context.Context, tx pgx.Tx, orgID int64, username string) error {
+	insertQuery, v, err := sq.Insert(historyTableName).
+		Columns("organization_id", "username", "password_hash").
+		Select(sq.Select("organization_id", "username", "password").
+			From(tableName).
+			Where(sq.Eq{"organization_id": orgID, "username_canonical": normalize.Username(username)})).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("user.pushPasswordHistory: query: '%s' values: '%+v'\n", insertQuery, v)
+	}
+
+	if _, err = tx.Exec(ctx, insertQuery, v...); err != nil {
+		return err
+	}
+
+	owner := ownerQuery(orgID, username)
+	recent := sq.Select("id").
+		From(historyTableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		Where(sq.Expr("username = (?)", owner)).
+		OrderBy("id desc").
+		Limit(uint64(r.passwordHistoryDepth))
+
+	pruneQuery, v, err := sq.Delete(historyTableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		Where(sq.Expr("username = (?)", owner)).
+		Where(sq.Expr("id not in (?)", recent)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("user.pushPasswordHistory: query: '%s' values: '%+v'\n", pruneQuery, v)
+	}
+
+	_, err = tx.Exec(ctx, pruneQuery, v...)
+	return err
+}
+
+// ownerQuery выбирает точное имя пользователя организации по любому написанию
+func ownerQuery(orgID int64, username string) sq.SelectBuilder {
+	return sq.Select("username").
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID, "username_canonical": normalize.Username(username)})
+}
+
+func (r *repository) Delete(ctx context.Context, username string, expectedVersion *int64) (*model.User, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
 	builder := sq.Delete(tableName).
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"organization_id": orgID, "username_canonical": normalize.Username(username)}).
+		Suffix("returning " + strings.Join(userColumns, ", ")).
 		PlaceholderFormat(sq.Dollar)
 
+	if expectedVersion != nil {
+		builder = builder.Where(sq.Eq{"version": *expectedVersion})
+	}
+
 	query, v, err := builder.ToSql()
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	if config.PostgresDev {
 		log.Printf("user.Delete: query: '%s' values: '%+v'\n", query, v)
 	}
 
-	_, err = r.pool.Exec(ctx, query, v...)
+	user, err := scanUser(r.pool.QueryRow(ctx, query, v...))
 	if err != nil {
-		return err
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return nil, err
+		}
+
+		// Условное удаление могло не сработать из-за несовпадения версии
+		if expectedVersion != nil {
+			isAvailable, err := r.IsUsernameAvailable(ctx, username)
+			if err != nil {
+				return nil, err
+			}
+			if !isAvailable {
+				return nil, repo.ErrVersionMismatch
+			}
+		}
+
+		return nil, repo.ErrRecordNotFound
 	}
 
-	return nil
+	return user, nil
 }
 
 func (r *repository) IsUsernameAvailable(ctx context.Context, username string) (bool, error) {
+	return r.isAvailable(ctx, "user.IsUsernameAvailable", sq.Eq{"username_canonical": normalize.Username(username)})
+}
+
+func (r *repository) IsEmailAvailable(ctx context.Context, email string) (bool, error) {
+	return r.isAvailable(ctx, "user.IsEmailAvailable", sq.Eq{"email_canonical": normalize.Email(email)})
+}
+
+func (r *repository) isAvailable(ctx context.Context, caller string, where sq.Eq) (bool, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return false, err
+	}
+
 	builder := sq.Select("count(*)").
 		From(tableName).
-		Where(sq.Eq{"username": username}).
+		Where(sq.Eq{"organization_id": orgID}).
+		Where(where).
 		PlaceholderFormat(sq.Dollar)
 
 	query, v, err := builder.ToSql()
@@ -173,15 +429,279 @@ func (r *repository) IsUsernameAvailable(ctx context.Context, username string) (
 	}
 
 	if config.PostgresDev {
-		log.Printf("user.IsUsernameAvailable: query: '%s' values: '%+v'\n", query, v)
+		log.Printf("%s: query: '%s' values: '%+v'\n", caller, query, v)
 	}
 
 	var count int
 	row := r.pool.QueryRow(ctx, query, v...)
 	if err = row.Scan(&count); err != nil {
-		log.Printf("user.IsUnameAvl: %s", err.Error())
+		log.Printf("%s: %s", caller, err.Error())
 		return false, err
 	}
 
 	return count == 0, nil
 }
+
+func (r *repository) GetPasswordHistory(ctx context.Context, username string, limit int) ([]string, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select("password_hash").
+		From(historyTableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		Where(sq.Expr("username = (?)", ownerQuery(orgID, username))).
+		OrderBy("id desc").
+		Limit(uint64(limit)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("user.GetPasswordHistory: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []string
+	for rows.Next() {
+		var hash string
+		if err = rows.Scan(&hash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, hash)
+	}
+
+	return hashes, rows.Err()
+}
+
+func scanUser(row pgx.Row) (*model.User, error) {
+	var user model.User
+	var roleIDs []int32
+	var roleNames []string
+	err := row.Scan(&user.Username, &user.Email, &user.Password, &roleIDs, &roleNames, &user.CreatedAt, &user.UpdatedAt, &user.Version, &user.EmailVerifiedAt)
+	if err != nil {
+		return nil, err
+	}
+
+	user.Roles = make([]model.Role, 0, len(roleIDs))
+	for i := range roleIDs {
+		user.Roles = append(user.Roles, model.Role{ID: model.UserRole(roleIDs[i]), Name: roleNames[i]})
+	}
+
+	return &user, nil
+}
+
+func (r *repository) UpdatePasswordHash(ctx context.Context, username, oldHash, newHash string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("password", newHash).
+		Where(sq.Eq{"organization_id": orgID, "username_canonical": normalize.Username(username), "password": oldHash}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("user.UpdatePasswordHash: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) CountByPasswordAlgorithm(ctx context.Context) (map[string]int64, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	algorithm := `case
+		when password like '$argon2id$%' then 'argon2id'
+		when password ~ '^\$2[aby]\$' then 'bcrypt'
+		else 'unknown'
+	end`
+
+	query, v, err := sq.Select(algorithm+" as algorithm", "count(*)").
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		GroupBy("algorithm").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("user.CountByPasswordAlgorithm: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var name string
+		var count int64
+		if err = rows.Scan(&name, &count); err != nil {
+			return nil, err
+		}
+		counts[name] = count
+	}
+
+	return counts, rows.Err()
+}
+
+func (r *repository) MarkEmailVerified(ctx context.Context, username, email string) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(tableName).
+		Set("email_verified_at", sq.Expr("now()")).
+		Set("updated_at", sq.Expr("now()")).
+		Set("version", sq.Expr("version + 1")).
+		Where(sq.Eq{
+			"organization_id":    orgID,
+			"username_canonical": normalize.Username(username),
+			"email_canonical":    normalize.Email(email),
+			"email_verified_at":  nil,
+		}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("user.MarkEmailVerified: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (r *repository) CanonicalizeUsernames(ctx context.Context) (int64, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	query, v, err := sq.Select("username", "username_canonical").
+		From(tableName).
+		Where(sq.Eq{"organization_id": orgID}).
+		Suffix("for update").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return 0, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("user.CanonicalizeUsernames: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var updated int64
+	err = r.pool.BeginFunc(ctx, func(tx pgx.Tx) error {
+		rows, err := tx.Query(ctx, query, v...)
+		if err != nil {
+			return err
+		}
+
+		canonical := make(map[string]string)
+		for rows.Next() {
+			var username, current string
+			if err = rows.Scan(&username, &current); err != nil {
+				rows.Close()
+				return err
+			}
+			if expected := normalize.Username(username); expected != current {
+				canonical[username] = expected
+			}
+		}
+		rows.Close()
+		if err = rows.Err(); err != nil {
+			return err
+		}
+
+		set := func(username, value string) error {
+			_, err := tx.Exec(ctx,
+				`update "user" set username_canonical = $1 where organization_id = $2 and username = $3`,
+				value, orgID, username)
+			return mapError(err)
+		}
+
+		// Уникальный индекс проверяется после каждой строки, поэтому обмен формами
+		// между двумя пользователями сначала проходит через временные значения.
+		// Каноническая форма не начинается с пробела и не совпадёт с временной
+		for username := range canonical {
+			if err = set(username, " "+username); err != nil {
+				return err
+			}
+		}
+		for username, value := range canonical {
+			if err = set(username, value); err != nil {
+				return err
+			}
+		}
+
+		updated = int64(len(canonical))
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return updated, nil
+}
+
+// mapError переводит нарушение уникальности в ErrUsernameTaken или ErrEmailTaken
+// по имени ограничения. Так параллельная регистрация того же имени или адреса
+// получает ту же ошибку, что и последовательная
+func mapError(err error) error {
+	var pgErr *pgconn.PgError
+	if !errors.As(err, &pgErr) || pgErr.Code != repo.UniqueViolation {
+		return err
+	}
+
+	switch pgErr.ConstraintName {
+	case usernamePkey, usernameCanonicalIdx:
+		return repo.ErrUsernameTaken
+	case emailCanonicalIdx:
+		return repo.ErrEmailTaken
+	}
+
+	return repo.ErrAlreadyExists
+}
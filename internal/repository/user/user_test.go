@@ -0,0 +1,37 @@
+package user
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgconn"
+
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+func TestMapError(t *testing.T) {
+	other := errors.New("connection reset")
+	foreignKey := &pgconn.PgError{Code: repo.ForeignKeyViolation}
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{name: "username", err: &pgconn.PgError{Code: repo.UniqueViolation, ConstraintName: usernameCanonicalIdx}, want: repo.ErrUsernameTaken},
+		{name: "username primary key", err: &pgconn.PgError{Code: repo.UniqueViolation, ConstraintName: usernamePkey}, want: repo.ErrUsernameTaken},
+		{name: "email", err: &pgconn.PgError{Code: repo.UniqueViolation, ConstraintName: emailCanonicalIdx}, want: repo.ErrEmailTaken},
+		{name: "other constraint", err: &pgconn.PgError{Code: repo.UniqueViolation, ConstraintName: "user_role_assignment_pkey"}, want: repo.ErrAlreadyExists},
+		{name: "other code", err: foreignKey, want: foreignKey},
+		{name: "not postgres", err: other, want: other},
+		{name: "nil", err: nil, want: nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := mapError(tt.err); got != tt.want {
+				t.Fatalf("mapError() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
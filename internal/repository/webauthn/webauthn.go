@@ -0,0 +1,328 @@
+package webauthn
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	sq "github.com/Masterminds/squirrel"
+	"github.com/jackc/pgconn"
+	"github.com/jackc/pgx/v4"
+	"github.com/jackc/pgx/v4/pgxpool"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+const (
+	userTableName       = "webauthn_user"
+	credentialTableName = "webauthn_credential"
+	challengeTableName  = "webauthn_challenge"
+)
+
+var credentialColumns = []string{
+	"username", "credential_id", "name", "public_key", "sign_count", "transports", "aaguid", "created_at", "last_used_at",
+}
+
+type Repository interface {
+	// EnsureUserHandle сохраняет handle, если у пользователя его ещё нет,
+	// и возвращает действующий handle пользователя
+	EnsureUserHandle(ctx context.Context, username string, handle []byte) ([]byte, error)
+
+	AddChallenge(ctx context.Context, challenge *model.WebAuthnChallenge, ttl time.Duration) error
+	// ConsumeChallenge удаляет и возвращает действующий challenge церемонии.
+	// Каждый challenge принимается только один раз
+	ConsumeChallenge(ctx context.Context, challenge []byte, ceremony string) (*model.WebAuthnChallenge, error)
+
+	// AddCredential возвращает ErrAlreadyExists, если ключ уже зарегистрирован
+	AddCredential(ctx context.Context, credential *model.WebAuthnCredential) error
+	GetCredential(ctx context.Context, credentialID []byte) (*model.WebAuthnCredential, error)
+	ListCredentials(ctx context.Context, username string) ([]*model.WebAuthnCredential, error)
+	// UpdateSignCount сохраняет счётчик подписей и время использования ключа
+	UpdateSignCount(ctx context.Context, credentialID []byte, signCount uint32) error
+	DeleteCredential(ctx context.Context, username string, credentialID []byte) error
+}
+
+type repository struct {
+	pool *pgxpool.Pool
+}
+
+func NewRepository(pool *pgxpool.Pool) Repository {
+	return &repository{
+		pool: pool,
+	}
+}
+
+func (r *repository) EnsureUserHandle(ctx context.Context, username string, handle []byte) ([]byte, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Пустое обновление нужно, чтобы returning вернул существующую строку
+	query, v, err := sq.Insert(userTableName).
+		Columns("organization_id", "username", "user_handle").
+		Values(orgID, username, handle).
+		Suffix("on conflict (organization_id, username) do update set username = excluded.username returning user_handle").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("webauthn.EnsureUserHandle: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var userHandle []byte
+	if err = r.pool.QueryRow(ctx, query, v...).Scan(&userHandle); err != nil {
+		return nil, err
+	}
+
+	return userHandle, nil
+}
+
+func (r *repository) AddChallenge(ctx context.Context, challenge *model.WebAuthnChallenge, ttl time.Duration) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	var username interface{}
+	if challenge.Username != "" {
+		username = challenge.Username
+	}
+
+	query, v, err := sq.Insert(challengeTableName).
+		Columns("organization_id", "challenge", "ceremony", "username", "expires_at").
+		Values(orgID, challenge.Challenge, challenge.Ceremony, username, sq.Expr("now() + ?::interval", ttl)).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("webauthn.AddChallenge: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+	return err
+}
+
+func (r *repository) ConsumeChallenge(ctx context.Context, challenge []byte, ceremony string) (*model.WebAuthnChallenge, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Delete(challengeTableName).
+		Where(sq.Eq{"organization_id": orgID, "challenge": challenge, "ceremony": ceremony}).
+		Where("expires_at > now()").
+		Suffix("returning challenge, ceremony, coalesce(username, '')").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("webauthn.ConsumeChallenge: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	var result model.WebAuthnChallenge
+	err = r.pool.QueryRow(ctx, query, v...).Scan(&result.Challenge, &result.Ceremony, &result.Username)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return &result, nil
+}
+
+func (r *repository) AddCredential(ctx context.Context, credential *model.WebAuthnCredential) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Insert(credentialTableName).
+		Columns("organization_id", "username", "credential_id", "name", "public_key", "sign_count", "transports", "aaguid").
+		Values(
+			orgID,
+			credential.Username,
+			credential.CredentialID,
+			credential.Name,
+			credential.PublicKey,
+			int64(credential.SignCount),
+			credential.Transports,
+			credential.AAGUID,
+		).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("webauthn.AddCredential: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	if _, err = r.pool.Exec(ctx, query, v...); err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == repo.UniqueViolation {
+			return repo.ErrAlreadyExists
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (r *repository) GetCredential(ctx context.Context, credentialID []byte) (*model.WebAuthnCredential, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select(credentialColumns...).
+		From(credentialTableName).
+		Where(sq.Eq{"organization_id": orgID, "credential_id": credentialID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("webauthn.GetCredential: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	credential, err := scanCredential(r.pool.QueryRow(ctx, query, v...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil, repo.ErrRecordNotFound
+		}
+		return nil, err
+	}
+
+	return credential, nil
+}
+
+func (r *repository) ListCredentials(ctx context.Context, username string) ([]*model.WebAuthnCredential, error) {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	query, v, err := sq.Select(credentialColumns...).
+		From(credentialTableName).
+		Where(sq.Eq{"organization_id": orgID, "username": username}).
+		OrderBy("id").
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return nil, err
+	}
+
+	if config.PostgresDev {
+		log.Printf("webauthn.ListCredentials: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	rows, err := r.pool.Query(ctx, query, v...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var credentials []*model.WebAuthnCredential
+	for rows.Next() {
+		credential, err := scanCredential(rows)
+		if err != nil {
+			return nil, err
+		}
+		credentials = append(credentials, credential)
+	}
+
+	return credentials, rows.Err()
+}
+
+func (r *repository) UpdateSignCount(ctx context.Context, credentialID []byte, signCount uint32) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Update(credentialTableName).
+		Set("sign_count", int64(signCount)).
+		Set("last_used_at", sq.Expr("now()")).
+		Where(sq.Eq{"organization_id": orgID, "credential_id": credentialID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("webauthn.UpdateSignCount: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	_, err = r.pool.Exec(ctx, query, v...)
+	return err
+}
+
+func (r *repository) DeleteCredential(ctx context.Context, username string, credentialID []byte) error {
+	orgID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	query, v, err := sq.Delete(credentialTableName).
+		Where(sq.Eq{"organization_id": orgID, "username": username, "credential_id": credentialID}).
+		PlaceholderFormat(sq.Dollar).
+		ToSql()
+	if err != nil {
+		return err
+	}
+
+	if config.PostgresDev {
+		log.Printf("webauthn.DeleteCredential: query: '%s' values: '%+v'\n", query, v)
+	}
+
+	pg, err := r.pool.Exec(ctx, query, v...)
+	if err != nil {
+		return err
+	}
+
+	if pg.RowsAffected() == 0 {
+		return repo.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func scanCredential(row pgx.Row) (*model.WebAuthnCredential, error) {
+	var credential model.WebAuthnCredential
+	var signCount int64
+	err := row.Scan(
+		&credential.Username,
+		&credential.CredentialID,
+		&credential.Name,
+		&credential.PublicKey,
+		&signCount,
+		&credential.Transports,
+		&credential.AAGUID,
+		&credential.CreatedAt,
+		&credential.LastUsedAt,
+	)
+	if err != nil {
+		return nil, err
+	}
+	credential.SignCount = uint32(signCount)
+
+	return &credential, nil
+}
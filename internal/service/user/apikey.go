@@ -0,0 +1,136 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/token"
+)
+
+// Префикс API-ключей, по которому их находят сканеры утёкших секретов
+// и отличают от токенов сессий
+const apiKeyPrefix = "usk_"
+
+// Сколько символов случайной части ключа показывается в списке
+const apiKeyHintLength = 6
+
+var apiKeyScopes = map[string]bool{
+	model.ApiKeyScopeRead:  true,
+	model.ApiKeyScopeWrite: true,
+	model.ApiKeyScopeAll:   true,
+}
+
+// CreateApiKey создаёт ключ пользователя. Ключ возвращается только в ответе.
+// Без областей ключ получает все права владельца. Вызывающий по API-ключу
+// может создать ключ только с областями, которые есть у него самого
+func (s *service) CreateApiKey(ctx context.Context, username string, create *model.CreateApiKey) (*model.ApiKey, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	scopes := create.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{model.ApiKeyScopeAll}
+	}
+
+	principal := auth.FromContext(ctx)
+	for _, scope := range scopes {
+		if !apiKeyScopes[scope] {
+			return nil, errInvalidApiKeyScope
+		}
+		if !principal.HasScope(scope) {
+			return nil, errApiKeyScopeNotAllowed
+		}
+	}
+
+	if create.ExpiresAt != nil && !create.ExpiresAt.After(time.Now()) {
+		return nil, errApiKeyExpired
+	}
+
+	count, err := s.apiKeyRepo.CountActive(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+	if count >= s.apiKeyCfg.MaxPerUser {
+		return nil, errApiKeyLimitExceeded
+	}
+
+	raw, hash, err := token.Generate(apiKeyPrefix)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := s.apiKeyRepo.Create(ctx, &model.ApiKey{
+		Username:  user.Username,
+		Name:      create.Name,
+		Hint:      raw[:len(apiKeyPrefix)+apiKeyHintLength],
+		Scopes:    scopes,
+		ExpiresAt: create.ExpiresAt,
+	}, hash)
+	if err != nil {
+		return nil, err
+	}
+	key.Key = raw
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventApiKeyCreated,
+		Subject: user.Username,
+		Payload: map[string]interface{}{"id": key.ID, "name": key.Name, "scopes": key.Scopes},
+	})
+
+	return key, nil
+}
+
+func (s *service) ListApiKeys(ctx context.Context, username string) ([]*model.ApiKey, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.apiKeyRepo.List(ctx, user.Username)
+}
+
+func (s *service) RevokeApiKey(ctx context.Context, username string, id int64) error {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if err = s.apiKeyRepo.Revoke(ctx, user.Username, id); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errApiKeyNotFound
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventApiKeyRevoked,
+		Subject: user.Username,
+		Payload: map[string]interface{}{"id": id},
+	})
+
+	return nil
+}
+
+// AuthenticateApiKey возвращает действующий ключ и отмечает его использование
+func (s *service) AuthenticateApiKey(ctx context.Context, raw string) (*model.ApiKey, error) {
+	if !strings.HasPrefix(raw, apiKeyPrefix) {
+		return nil, errInvalidApiKey
+	}
+
+	key, err := s.apiKeyRepo.Use(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errInvalidApiKey
+		}
+		return nil, err
+	}
+
+	return key, nil
+}
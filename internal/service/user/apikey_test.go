@@ -0,0 +1,53 @@
+package user
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+)
+
+func TestCreateApiKeyScopes(t *testing.T) {
+	session := &auth.Principal{Username: "alice"}
+	writeKey := &auth.Principal{Username: "alice", ApiKey: true, Scopes: []string{model.ApiKeyScopeWrite}}
+	allKey := &auth.Principal{Username: "alice", ApiKey: true, Scopes: []string{model.ApiKeyScopeAll}}
+
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		scopes    []string
+		want      []string
+		wantErr   error
+	}{
+		{name: "session without scopes gets all", principal: session, want: []string{model.ApiKeyScopeAll}},
+		{name: "session narrows scopes", principal: session, scopes: []string{model.ApiKeyScopeRead}, want: []string{model.ApiKeyScopeRead}},
+		{name: "key keeps its own scope", principal: writeKey, scopes: []string{model.ApiKeyScopeWrite}, want: []string{model.ApiKeyScopeWrite}},
+		{name: "key cannot mint full key", principal: writeKey, wantErr: errApiKeyScopeNotAllowed},
+		{name: "key cannot add scope", principal: writeKey, scopes: []string{model.ApiKeyScopeRead}, wantErr: errApiKeyScopeNotAllowed},
+		{name: "full key mints narrower key", principal: allKey, scopes: []string{model.ApiKeyScopeRead}, want: []string{model.ApiKeyScopeRead}},
+		{name: "unknown scope", principal: session, scopes: []string{"admin"}, wantErr: errInvalidApiKeyScope},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := &service{
+				userRepo:   &memUserRepo{users: []*model.User{{Username: "alice"}}},
+				apiKeyRepo: &memApiKeyRepo{},
+				eventRepo:  &memEventRepo{},
+				apiKeyCfg:  &config.ApiKeyConfig{MaxPerUser: 10},
+			}
+
+			ctx := auth.NewContext(context.Background(), tt.principal)
+			key, err := s.CreateApiKey(ctx, "alice", &model.CreateApiKey{Scopes: tt.scopes})
+			if err != tt.wantErr {
+				t.Fatalf("err = %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && !reflect.DeepEqual(key.Scopes, tt.want) {
+				t.Fatalf("scopes = %v, want %v", key.Scopes, tt.want)
+			}
+		})
+	}
+}
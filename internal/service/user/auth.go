@@ -0,0 +1,81 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"github.com/Slintox/user-service/internal/auth"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/token"
+)
+
+// Authenticate определяет вызывающего по токену сессии или API-ключу
+func (s *service) Authenticate(ctx context.Context, raw string) (*auth.Principal, error) {
+	if strings.HasPrefix(raw, apiKeyPrefix) {
+		key, err := s.AuthenticateApiKey(ctx, raw)
+		if err != nil {
+			return nil, err
+		}
+
+		principal, err := s.principal(ctx, key.OrganizationID, key.Username, errInvalidApiKey)
+		if err != nil {
+			return nil, err
+		}
+		principal.ApiKey = true
+		principal.Scopes = key.Scopes
+
+		return principal, nil
+	}
+
+	session, err := s.sessionRepo.Get(ctx, token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errInvalidSession
+		}
+		return nil, err
+	}
+
+	principal, err := s.principal(ctx, session.OrganizationID, session.Username, errInvalidSession)
+	if err != nil {
+		return nil, err
+	}
+	principal.MfaEnrollmentRequired = session.MfaEnrollmentRequired
+	principal.SessionID = session.ID
+
+	return principal, nil
+}
+
+// principal описывает владельца сессии или ключа. Организация берётся из сессии или ключа,
+// а не из заголовка запроса, чтобы её можно было сверить с заголовком
+func (s *service) principal(ctx context.Context, organizationID int64, username string, errNotFound error) (*auth.Principal, error) {
+	user, err := s.userRepo.Get(ctx, username)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errNotFound
+		}
+		return nil, err
+	}
+
+	permissions, err := s.permissionRepo.ListByRoles(ctx, user.RoleIDs()...)
+	if err != nil {
+		return nil, err
+	}
+
+	principal := &auth.Principal{
+		OrganizationID: organizationID,
+		Username:       user.Username,
+		Email:          user.Email,
+		Roles:          user.RoleIDs(),
+		RoleNames:      make([]string, 0, len(user.Roles)),
+		Permissions:    make(map[string]bool, len(permissions)),
+	}
+	for _, role := range user.Roles {
+		principal.RoleNames = append(principal.RoleNames, role.Name)
+	}
+	for _, permission := range permissions {
+		principal.Permissions[permission] = true
+	}
+
+	return principal, nil
+}
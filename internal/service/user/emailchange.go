@@ -0,0 +1,203 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	"github.com/Slintox/user-service/internal/notifier"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+// requestEmailChange сохраняет новый адрес как ожидающий подтверждения.
+// На новый адрес уходит ссылка подтверждения, на прежний - уведомление со ссылкой отмены
+func (s *service) requestEmailChange(ctx context.Context, username, oldEmail, newEmail string) error {
+	organizationID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	change, err := s.emailChangeRepo.Create(ctx, username, oldEmail, newEmail, s.emailChangeCfg.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	confirmToken, err := s.signer.Sign(&emailClaims{
+		Purpose:        purposeEmailChange,
+		OrganizationID: organizationID,
+		Username:       username,
+		Email:          normalize.Email(newEmail),
+		ChangeID:       change.ID,
+	}, s.emailChangeCfg.TokenTTL)
+	if err != nil {
+		return err
+	}
+
+	// Отменить смену можно и после подтверждения, пока не истёк льготный период
+	cancelTTL := s.emailChangeCfg.TokenTTL + s.emailChangeCfg.CancelGracePeriod
+	cancelToken, err := s.signer.Sign(&emailClaims{
+		Purpose:        purposeEmailChangeCancel,
+		OrganizationID: organizationID,
+		Username:       username,
+		Email:          normalize.Email(oldEmail),
+		ChangeID:       change.ID,
+	}, cancelTTL)
+	if err != nil {
+		return err
+	}
+
+	s.notifyAsync(&notifier.Notification{
+		Kind:     notifier.KindEmailChangeConfirm,
+		To:       newEmail,
+		Username: username,
+		Data: map[string]string{
+			"token":      confirmToken,
+			"expires_in": s.emailChangeCfg.TokenTTL.String(),
+		},
+	})
+
+	s.notifyAsync(&notifier.Notification{
+		Kind:     notifier.KindEmailChangeNotice,
+		To:       oldEmail,
+		Username: username,
+		Data: map[string]string{
+			"new_email":    newEmail,
+			"cancel_token": cancelToken,
+			"expires_in":   cancelTTL.String(),
+		},
+	})
+
+	return nil
+}
+
+// ConfirmEmailChange применяет ожидающий адрес по токену, отправленному на него.
+// Переход по ссылке подтверждает владение адресом
+func (s *service) ConfirmEmailChange(ctx context.Context, confirmToken string) error {
+	var claims emailClaims
+	if !s.verifyEmailToken(ctx, confirmToken, purposeEmailChange, &claims) {
+		return errInvalidEmailChangeToken
+	}
+
+	change, err := s.emailChangeRepo.Get(ctx, claims.ChangeID)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errInvalidEmailChangeToken
+		}
+		return err
+	}
+
+	// Адрес мог занять другой пользователь, пока смена ждала подтверждения
+	owner, err := s.userRepo.GetByEmail(ctx, change.NewEmail)
+	if err != nil && !errors.Is(err, repo.ErrRecordNotFound) {
+		return err
+	}
+	if owner != nil && normalize.Username(owner.Username) != normalize.Username(change.Username) {
+		return errEmailIsAlreadyUsed
+	}
+
+	if err = s.emailChangeRepo.Confirm(ctx, change.ID); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errInvalidEmailChangeToken
+		}
+		return err
+	}
+
+	if err = s.setEmail(ctx, change.Username, change.NewEmail); err != nil {
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventEmailChanged,
+		Subject: change.Username,
+		Payload: map[string]interface{}{"old_email": change.OldEmail, "new_email": change.NewEmail},
+	})
+
+	return nil
+}
+
+// CancelEmailChange отменяет смену по ссылке, отправленной на прежний адрес.
+// Если смена уже применена, возвращается прежний адрес и завершаются все сессии,
+// так как смену мог выполнить получивший доступ к учётной записи
+func (s *service) CancelEmailChange(ctx context.Context, cancelToken string) error {
+	var claims emailClaims
+	if !s.verifyEmailToken(ctx, cancelToken, purposeEmailChangeCancel, &claims) {
+		return errInvalidEmailChangeToken
+	}
+
+	if err := s.emailChangeRepo.Cancel(ctx, claims.ChangeID, s.emailChangeCfg.CancelGracePeriod); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errInvalidEmailChangeToken
+		}
+		return err
+	}
+
+	// Запрос читается после отмены, чтобы не пропустить подтверждение, выполненное между ними
+	change, err := s.emailChangeRepo.Get(ctx, claims.ChangeID)
+	if err != nil {
+		return err
+	}
+
+	if change.ConfirmedAt != nil {
+		if err = s.revertEmailChange(ctx, change); err != nil {
+			return err
+		}
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventEmailChangeCancelled,
+		Subject: change.Username,
+		Payload: map[string]interface{}{
+			"old_email": change.OldEmail,
+			"new_email": change.NewEmail,
+			"reverted":  change.ConfirmedAt != nil,
+		},
+	})
+
+	return nil
+}
+
+func (s *service) revertEmailChange(ctx context.Context, change *model.EmailChange) error {
+	user, err := s.Get(ctx, change.Username)
+	if err != nil {
+		return err
+	}
+
+	// Адрес мог смениться ещё раз или прежний адрес мог занять другой пользователь.
+	// Сессии завершаются в любом случае
+	owner, err := s.userRepo.GetByEmail(ctx, change.OldEmail)
+	if err != nil && !errors.Is(err, repo.ErrRecordNotFound) {
+		return err
+	}
+
+	switch {
+	case normalize.Email(user.Email) != normalize.Email(change.NewEmail):
+		log.Printf("user.revertEmailChange: email of %s changed again, not reverting", change.Username)
+	case owner != nil:
+		log.Printf("user.revertEmailChange: old email of %s is used by %s, not reverting", change.Username, owner.Username)
+	default:
+		if err = s.setEmail(ctx, change.Username, change.OldEmail); err != nil {
+			return err
+		}
+	}
+
+	_, err = s.sessionRepo.RevokeAll(ctx, user.Username)
+	return err
+}
+
+// setEmail сохраняет адрес, владение которым подтверждено переходом по ссылке
+func (s *service) setEmail(ctx context.Context, username, email string) error {
+	if err := s.userRepo.Update(ctx, username, &model.UpdateUser{Email: &email}); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errUserNotFound
+		}
+		return mapUniqueError(err)
+	}
+
+	if err := s.userRepo.MarkEmailVerified(ctx, username, email); err != nil && !errors.Is(err, repo.ErrRecordNotFound) {
+		return err
+	}
+
+	return nil
+}
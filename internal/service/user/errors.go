@@ -1,14 +1,141 @@
 package user
 
-import "errors"
+import (
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// Домен и причины ошибок для google.rpc.ErrorInfo, по которым клиент
+// может отличить ошибки с одинаковым кодом
+const (
+	errorDomain = "user-service"
+
+	reasonPasswordBreached = "PASSWORD_BREACHED"
+	reasonPasswordReused   = "PASSWORD_REUSED"
+	reasonLoginThrottled   = "LOGIN_THROTTLED"
+	reasonResendThrottled  = "RESEND_THROTTLED"
+	reasonMfaRequired      = "MFA_REQUIRED"
+	reasonMfaInvalid       = "MFA_INVALID"
+)
 
 // Текст ошибок сделан для отображения "пользователю"
 var (
-	errInvalidUserPasswordConfirm = errors.New("Пароли не совпадают")
-	errUsernameIsAlreadyUsed      = errors.New("Данное имя пользователя уже занято")
+	errUsernameIsAlreadyUsed = status.Error(codes.AlreadyExists, "Данное имя пользователя уже занято")
+	errEmailIsAlreadyUsed    = status.Error(codes.AlreadyExists, "Данный email уже используется")
+	errPasswordBreached      = errorWithReason(codes.InvalidArgument, "Пароль найден в базе утёкших паролей, выберите другой", reasonPasswordBreached)
+	errPasswordReused        = errorWithReason(codes.InvalidArgument, "Пароль совпадает с одним из предыдущих", reasonPasswordReused)
 )
 
 var (
-	errInvalidUserRole = errors.New("Указанная роль пользователя не существует")
-	errUserNotFound    = errors.New("Пользователь не найден")
+	errInvalidUserRole     = status.Error(codes.InvalidArgument, "Указанная роль пользователя не существует")
+	errUserNotFound        = status.Error(codes.NotFound, "Пользователь не найден")
+	errUserVersionMismatch = status.Error(codes.Aborted, "Пользователь был изменён, версия не совпадает с ожидаемой")
+	errInvalidCredentials  = status.Error(codes.Unauthenticated, "Неверное имя пользователя или пароль")
+	errInvalidResetToken   = status.Error(codes.InvalidArgument, "Ссылка для сброса пароля недействительна или устарела")
+
+	errInvalidCurrentPassword   = status.Error(codes.InvalidArgument, "Текущий пароль указан неверно")
+	errPasswordChangeNotAllowed = status.Error(codes.PermissionDenied, "Пароль меняется через ChangePassword с указанием текущего пароля")
+
+	errInvalidVerificationToken = status.Error(codes.InvalidArgument, "Ссылка для подтверждения email недействительна или устарела")
+	errEmailAlreadyVerified     = status.Error(codes.FailedPrecondition, "Email уже подтверждён")
+	errInvalidEmailChangeToken  = status.Error(codes.InvalidArgument, "Ссылка для смены email недействительна или устарела")
+
+	errMfaRequired       = errorWithReason(codes.Unauthenticated, "Требуется код второго фактора", reasonMfaRequired)
+	errInvalidMfaCode    = errorWithReason(codes.Unauthenticated, "Неверный код второго фактора", reasonMfaInvalid)
+	errMfaAlreadyEnabled = status.Error(codes.FailedPrecondition, "Второй фактор уже подключён")
+	errMfaNotEnrolled    = status.Error(codes.FailedPrecondition, "Подключение второго фактора не начато")
+
+	errWebAuthnFailed             = status.Error(codes.Unauthenticated, "Не удалось проверить ключ доступа")
+	errWebAuthnRegistrationFailed = status.Error(codes.InvalidArgument, "Не удалось зарегистрировать ключ доступа, начните регистрацию заново")
+	errWebAuthnCredentialExists   = status.Error(codes.AlreadyExists, "Ключ доступа уже зарегистрирован")
+	errWebAuthnCredentialNotFound = status.Error(codes.NotFound, "Ключ доступа не найден")
+
+	errInvalidSession = status.Error(codes.Unauthenticated, "Сессия недействительна или истекла, войдите заново")
+
+	errInvalidApiKey       = status.Error(codes.Unauthenticated, "API-ключ недействителен, отозван или истёк")
+	errInvalidApiKeyScope  = status.Error(codes.InvalidArgument, "Указанная область действия API-ключа не существует")
+	errApiKeyExpired       = status.Error(codes.InvalidArgument, "Срок действия API-ключа должен быть в будущем")
+	errApiKeyLimitExceeded = status.Error(codes.FailedPrecondition, "Достигнуто максимальное число API-ключей, отзовите неиспользуемые")
+	errApiKeyNotFound      = status.Error(codes.NotFound, "API-ключ не найден")
+
+	errApiKeyScopeNotAllowed = status.Error(codes.PermissionDenied, "API-ключ не может создать ключ с областями, которых нет у него самого")
+
+	errRoleNotFound      = status.Error(codes.NotFound, "Роль не найдена")
+	errRoleAlreadyExists = status.Error(codes.AlreadyExists, "Роль с таким именем уже существует")
+	errRoleBuiltIn       = status.Error(codes.FailedPrecondition, "Встроенную роль нельзя переименовать или удалить")
+	errRoleInUse         = status.Error(codes.FailedPrecondition, "Роль назначена пользователям или группам и не может быть удалена")
+
+	errRoleAlreadyAssigned = status.Error(codes.AlreadyExists, "Роль уже назначена пользователю")
+	errRoleNotAssigned     = status.Error(codes.NotFound, "Роль не назначена пользователю")
+
+	errInvalidRoleGrantPeriod = status.Error(codes.InvalidArgument, "Окончание действия роли должно быть в будущем и позже начала")
+
+	errRoleAssignmentNotAllowed = status.Error(codes.PermissionDenied, "Недостаточно прав для назначения роли")
+	errPermissionNotFound       = status.Error(codes.NotFound, "Разрешение не найдено")
+	errPermissionNotGranted     = status.Error(codes.NotFound, "У роли нет такого разрешения")
+
+	errOrganizationNotFound      = status.Error(codes.NotFound, "Организация не найдена")
+	errOrganizationAlreadyExists = status.Error(codes.AlreadyExists, "Организация с таким именем уже существует")
+
+	errGroupNotFound            = status.Error(codes.NotFound, "Группа не найдена")
+	errGroupAlreadyExists       = status.Error(codes.AlreadyExists, "Группа с таким именем уже существует")
+	errInvalidGroupMember       = status.Error(codes.InvalidArgument, "Укажите либо пользователя, либо группу")
+	errGroupMemberAlreadyExists = status.Error(codes.AlreadyExists, "Участник уже входит в группу")
+	errGroupMemberNotFound      = status.Error(codes.NotFound, "Участник не входит в группу напрямую")
+	errGroupCycle               = status.Error(codes.FailedPrecondition, "Группа не может входить сама в себя, в том числе через другие группы")
+	errGroupRoleAlreadyAssigned = status.Error(codes.AlreadyExists, "Роль уже назначена группе")
+	errGroupRoleNotAssigned     = status.Error(codes.NotFound, "Роль не назначена группе")
+
+	errPolicyMethodRequired = status.Error(codes.InvalidArgument, "Укажите метод для проверки политик")
 )
+
+// errorWithReason создаёт ошибку с деталями google.rpc.ErrorInfo
+func errorWithReason(code codes.Code, msg, reason string) error {
+	st, err := status.New(code, msg).WithDetails(&errdetails.ErrorInfo{
+		Reason: reason,
+		Domain: errorDomain,
+	})
+	if err != nil {
+		return status.Error(code, msg)
+	}
+
+	return st.Err()
+}
+
+// errLoginThrottled сообщает, через сколько можно повторить попытку входа
+func errLoginThrottled(retryAfter time.Duration) error {
+	return errorWithRetry("Слишком много неудачных попыток входа, повторите позже", reasonLoginThrottled, retryAfter)
+}
+
+// errResendThrottled сообщает, через сколько можно повторно отправить письмо
+func errResendThrottled(retryAfter time.Duration) error {
+	return errorWithRetry("Письмо уже отправлено, повторите позже", reasonResendThrottled, retryAfter)
+}
+
+// errInvalidPolicy сообщает, почему не удалось разобрать черновик политики
+func errInvalidPolicy(err error) error {
+	return status.Errorf(codes.InvalidArgument, "Политика содержит ошибки: %s", err.Error())
+}
+
+// errorWithRetry создаёт ошибку ResourceExhausted с деталями
+// google.rpc.ErrorInfo и google.rpc.RetryInfo
+func errorWithRetry(msg, reason string, retryAfter time.Duration) error {
+	st, err := status.New(codes.ResourceExhausted, msg).WithDetails(
+		&errdetails.ErrorInfo{
+			Reason: reason,
+			Domain: errorDomain,
+		},
+		&errdetails.RetryInfo{
+			RetryDelay: durationpb.New(retryAfter.Round(time.Second)),
+		},
+	)
+	if err != nil {
+		return status.Error(codes.ResourceExhausted, msg)
+	}
+
+	return st.Err()
+}
@@ -0,0 +1,533 @@
+package user
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"time"
+
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	repo "github.com/Slintox/user-service/internal/repository"
+	apiKeyRepo "github.com/Slintox/user-service/internal/repository/apikey"
+	eventRepo "github.com/Slintox/user-service/internal/repository/event"
+	groupRepo "github.com/Slintox/user-service/internal/repository/group"
+	mfaRepo "github.com/Slintox/user-service/internal/repository/mfa"
+	permissionRepo "github.com/Slintox/user-service/internal/repository/permission"
+	roleRepo "github.com/Slintox/user-service/internal/repository/role"
+	sessionRepo "github.com/Slintox/user-service/internal/repository/session"
+	throttleRepo "github.com/Slintox/user-service/internal/repository/throttle"
+	uRepo "github.com/Slintox/user-service/internal/repository/user"
+	webAuthnRepo "github.com/Slintox/user-service/internal/repository/webauthn"
+)
+
+// Хранилища в памяти для тестов сервиса. Методы, которые тестам не нужны,
+// достаются от встроенного интерфейса и паникуют при вызове
+
+type memUserRepo struct {
+	uRepo.Repository
+	users []*model.User
+	// Глубина истории паролей и история по пользователям, начиная с последнего пароля
+	historyDepth int
+	history      map[string][]string
+}
+
+func (r *memUserRepo) Get(_ context.Context, username string) (*model.User, error) {
+	for _, user := range r.users {
+		if normalize.Username(user.Username) == normalize.Username(username) {
+			return user, nil
+		}
+	}
+
+	return nil, repo.ErrRecordNotFound
+}
+
+// Update меняет только пароль, прежний хеш уходит в историю не глубже historyDepth, как в базе
+func (r *memUserRepo) Update(ctx context.Context, username string, updateData *model.UpdateUser) error {
+	user, err := r.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if updateData.Password != nil {
+		if r.historyDepth > 0 {
+			if r.history == nil {
+				r.history = make(map[string][]string)
+			}
+			history := append([]string{user.Password}, r.history[user.Username]...)
+			if len(history) > r.historyDepth {
+				history = history[:r.historyDepth]
+			}
+			r.history[user.Username] = history
+		}
+		user.Password = *updateData.Password
+	}
+
+	return nil
+}
+
+func (r *memUserRepo) GetPasswordHistory(_ context.Context, username string, limit int) ([]string, error) {
+	history := r.history[username]
+	if len(history) > limit {
+		history = history[:limit]
+	}
+
+	return history, nil
+}
+
+type memEventRepo struct {
+	eventRepo.Repository
+	mu     sync.Mutex
+	events []*model.Event
+}
+
+func (r *memEventRepo) Add(_ context.Context, event *model.Event) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.events = append(r.events, event)
+
+	return nil
+}
+
+type memSessionRepo struct {
+	sessionRepo.Repository
+	mu       sync.Mutex
+	sessions map[string]*model.Session
+}
+
+func (r *memSessionRepo) Create(_ context.Context, username, tokenHash string, mfaEnrollmentRequired bool, ttl time.Duration) (*model.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	session := &model.Session{
+		ID:                    int64(len(r.sessions) + 1),
+		Username:              username,
+		CreatedAt:             now,
+		ExpiresAt:             now.Add(ttl),
+		MfaEnrollmentRequired: mfaEnrollmentRequired,
+	}
+
+	if r.sessions == nil {
+		r.sessions = make(map[string]*model.Session)
+	}
+	stored := *session
+	r.sessions[tokenHash] = &stored
+
+	return session, nil
+}
+
+func (r *memSessionRepo) Get(_ context.Context, tokenHash string) (*model.Session, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	session, ok := r.sessions[tokenHash]
+	if !ok || time.Now().After(session.ExpiresAt) {
+		return nil, repo.ErrRecordNotFound
+	}
+
+	stored := *session
+	return &stored, nil
+}
+
+func (r *memSessionRepo) RevokeAll(_ context.Context, username string) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var revoked int64
+	for hash, session := range r.sessions {
+		if session.Username == username {
+			delete(r.sessions, hash)
+			revoked++
+		}
+	}
+
+	return revoked, nil
+}
+
+func (r *memSessionRepo) RevokeAllExcept(_ context.Context, username string, id int64) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var revoked int64
+	for hash, session := range r.sessions {
+		if session.Username == username && session.ID != id {
+			delete(r.sessions, hash)
+			revoked++
+		}
+	}
+
+	return revoked, nil
+}
+
+func (r *memSessionRepo) CompleteMfaEnrollment(_ context.Context, username string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, session := range r.sessions {
+		if session.Username == username {
+			session.MfaEnrollmentRequired = false
+		}
+	}
+
+	return nil
+}
+
+// memThrottleRepo ведёт счётчики и блокировки так же, как таблица login_throttle
+type memThrottleRepo struct {
+	throttleRepo.Repository
+	mu           sync.Mutex
+	failures     map[string]int
+	lastFailure  map[string]time.Time
+	blockedUntil map[string]time.Time
+}
+
+func (r *memThrottleRepo) Reserve(_ context.Context, limits ...throttleRepo.Limit) ([]throttleRepo.Reservation, time.Duration, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.failures == nil {
+		r.failures = make(map[string]int)
+		r.lastFailure = make(map[string]time.Time)
+		r.blockedUntil = make(map[string]time.Time)
+	}
+
+	now := time.Now()
+
+	var blockedFor time.Duration
+	for _, limit := range limits {
+		if remaining := r.blockedUntil[limit.Subject].Sub(now); remaining > blockedFor {
+			blockedFor = remaining
+		}
+	}
+	if blockedFor > 0 {
+		return nil, blockedFor, nil
+	}
+
+	reservations := make([]throttleRepo.Reservation, len(limits))
+	for i, limit := range limits {
+		failures := r.failures[limit.Subject] + 1
+		if now.Sub(r.lastFailure[limit.Subject]) > limit.Window {
+			failures = 1
+		}
+
+		reservations[i] = throttleRepo.Reservation{
+			Subject:           limit.Subject,
+			Failures:          failures,
+			ReservedAt:        now,
+			PrevLastFailureAt: r.lastFailure[limit.Subject],
+		}
+		if blockedUntil, ok := r.blockedUntil[limit.Subject]; ok {
+			reservations[i].PrevBlockedUntil = &blockedUntil
+		}
+
+		r.failures[limit.Subject] = failures
+		r.lastFailure[limit.Subject] = now
+		if delay := limit.Delay(failures); delay > 0 {
+			r.blockedUntil[limit.Subject] = now.Add(delay)
+		}
+	}
+
+	return reservations, 0, nil
+}
+
+func (r *memThrottleRepo) Release(_ context.Context, reservations ...throttleRepo.Reservation) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, reservation := range reservations {
+		subject := reservation.Subject
+		if r.failures[subject] > 0 {
+			r.failures[subject]--
+		}
+
+		if !r.lastFailure[subject].Equal(reservation.ReservedAt) {
+			continue
+		}
+		r.lastFailure[subject] = reservation.PrevLastFailureAt
+		if reservation.PrevBlockedUntil != nil {
+			r.blockedUntil[subject] = *reservation.PrevBlockedUntil
+		} else {
+			delete(r.blockedUntil, subject)
+		}
+	}
+
+	return nil
+}
+
+func (r *memThrottleRepo) Reset(_ context.Context, subject string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	_, ok := r.failures[subject]
+	delete(r.failures, subject)
+	delete(r.lastFailure, subject)
+	delete(r.blockedUntil, subject)
+
+	return ok, nil
+}
+
+type memWebAuthnRepo struct {
+	webAuthnRepo.Repository
+	mu          sync.Mutex
+	handles     map[string][]byte
+	challenges  []*model.WebAuthnChallenge
+	credentials []*model.WebAuthnCredential
+}
+
+func (r *memWebAuthnRepo) EnsureUserHandle(_ context.Context, username string, handle []byte) ([]byte, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.handles == nil {
+		r.handles = make(map[string][]byte)
+	}
+	if existing, ok := r.handles[username]; ok {
+		return existing, nil
+	}
+	r.handles[username] = handle
+
+	return handle, nil
+}
+
+func (r *memWebAuthnRepo) AddChallenge(_ context.Context, challenge *model.WebAuthnChallenge, _ time.Duration) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.challenges = append(r.challenges, challenge)
+
+	return nil
+}
+
+func (r *memWebAuthnRepo) ConsumeChallenge(_ context.Context, challenge []byte, ceremony string) (*model.WebAuthnChallenge, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for i, c := range r.challenges {
+		if bytes.Equal(c.Challenge, challenge) && c.Ceremony == ceremony {
+			r.challenges = append(r.challenges[:i], r.challenges[i+1:]...)
+			return c, nil
+		}
+	}
+
+	return nil, repo.ErrRecordNotFound
+}
+
+func (r *memWebAuthnRepo) AddCredential(_ context.Context, credential *model.WebAuthnCredential) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.credentials {
+		if bytes.Equal(c.CredentialID, credential.CredentialID) {
+			return repo.ErrAlreadyExists
+		}
+	}
+
+	stored := *credential
+	stored.CreatedAt = time.Now()
+	r.credentials = append(r.credentials, &stored)
+
+	return nil
+}
+
+func (r *memWebAuthnRepo) GetCredential(_ context.Context, credentialID []byte) (*model.WebAuthnCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			credential := *c
+			return &credential, nil
+		}
+	}
+
+	return nil, repo.ErrRecordNotFound
+}
+
+func (r *memWebAuthnRepo) ListCredentials(_ context.Context, username string) ([]*model.WebAuthnCredential, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var credentials []*model.WebAuthnCredential
+	for _, c := range r.credentials {
+		if c.Username == username {
+			credential := *c
+			credentials = append(credentials, &credential)
+		}
+	}
+
+	return credentials, nil
+}
+
+func (r *memWebAuthnRepo) UpdateSignCount(_ context.Context, credentialID []byte, signCount uint32) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, c := range r.credentials {
+		if bytes.Equal(c.CredentialID, credentialID) {
+			c.SignCount = signCount
+			return nil
+		}
+	}
+
+	return repo.ErrRecordNotFound
+}
+
+type memApiKeyRepo struct {
+	apiKeyRepo.Repository
+	keys []*model.ApiKey
+}
+
+func (r *memApiKeyRepo) Create(_ context.Context, key *model.ApiKey, _ string) (*model.ApiKey, error) {
+	stored := *key
+	stored.ID = int64(len(r.keys) + 1)
+	stored.CreatedAt = time.Now()
+	r.keys = append(r.keys, &stored)
+
+	created := stored
+	return &created, nil
+}
+
+func (r *memApiKeyRepo) CountActive(_ context.Context, username string) (int, error) {
+	count := 0
+	for _, key := range r.keys {
+		if key.Username == username {
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+// RevokeAll удаляет ключи пользователя: отозванные ключи репозиторий не возвращает
+func (r *memApiKeyRepo) RevokeAll(_ context.Context, username string) (int64, error) {
+	active := r.keys[:0]
+	for _, key := range r.keys {
+		if key.Username != username {
+			active = append(active, key)
+		}
+	}
+
+	revoked := int64(len(r.keys) - len(active))
+	r.keys = active
+
+	return revoked, nil
+}
+
+// memMfaRepo принимает код шага, только если он позже последнего использованного, как UseStep в базе
+type memMfaRepo struct {
+	mfaRepo.Repository
+	mfa *model.Mfa
+	// Второй фактор обязателен для всех ролей
+	required bool
+}
+
+func (r *memMfaRepo) SetSecret(_ context.Context, username, secret string) error {
+	if r.mfa != nil && r.mfa.ConfirmedAt != nil {
+		return repo.ErrRecordNotFound
+	}
+
+	r.mfa = &model.Mfa{Username: username, Secret: secret}
+	return nil
+}
+
+func (r *memMfaRepo) Confirm(_ context.Context, _ string, step int64, _ []string) error {
+	if r.mfa == nil || r.mfa.ConfirmedAt != nil {
+		return repo.ErrRecordNotFound
+	}
+
+	confirmedAt := time.Now()
+	r.mfa.ConfirmedAt = &confirmedAt
+	r.mfa.LastUsedStep = step
+	return nil
+}
+
+func (r *memMfaRepo) IsRequired(context.Context, ...model.UserRole) (bool, error) {
+	return r.required, nil
+}
+
+func (r *memMfaRepo) Get(context.Context, string) (*model.Mfa, error) {
+	if r.mfa == nil {
+		return nil, repo.ErrRecordNotFound
+	}
+
+	mfa := *r.mfa
+	return &mfa, nil
+}
+
+func (r *memMfaRepo) UseStep(_ context.Context, _ string, step int64) error {
+	if r.mfa == nil || r.mfa.ConfirmedAt == nil || step <= r.mfa.LastUsedStep {
+		return repo.ErrRecordNotFound
+	}
+
+	r.mfa.LastUsedStep = step
+	return nil
+}
+
+// memPermissionRepo выдаёт ролям разрешения из byRole
+type memPermissionRepo struct {
+	permissionRepo.Repository
+	byRole map[model.UserRole][]string
+}
+
+func (r *memPermissionRepo) ListByRoles(_ context.Context, roles ...model.UserRole) ([]string, error) {
+	seen := make(map[string]bool)
+	var permissions []string
+	for _, role := range roles {
+		for _, permission := range r.byRole[role] {
+			if !seen[permission] {
+				seen[permission] = true
+				permissions = append(permissions, permission)
+			}
+		}
+	}
+
+	return permissions, nil
+}
+
+type memRoleRepo struct {
+	roleRepo.Repository
+	roles  []*model.Role
+	grants []*model.RoleGrant
+}
+
+func (r *memRoleRepo) GetByName(_ context.Context, name string) (*model.Role, error) {
+	for _, role := range r.roles {
+		if role.Name == name {
+			return role, nil
+		}
+	}
+
+	return nil, repo.ErrRecordNotFound
+}
+
+func (r *memRoleRepo) Assign(_ context.Context, grant *model.RoleGrant) error {
+	r.grants = append(r.grants, grant)
+	return nil
+}
+
+type memGroupRepo struct {
+	groupRepo.Repository
+	groups []*model.Group
+	roles  map[int64][]model.UserRole
+}
+
+func (r *memGroupRepo) GetByName(_ context.Context, name string) (*model.Group, error) {
+	for _, group := range r.groups {
+		if group.Name == name {
+			return group, nil
+		}
+	}
+
+	return nil, repo.ErrRecordNotFound
+}
+
+func (r *memGroupRepo) AssignRole(_ context.Context, id int64, role model.UserRole) error {
+	if r.roles == nil {
+		r.roles = make(map[int64][]model.UserRole)
+	}
+	r.roles[id] = append(r.roles[id], role)
+
+	return nil
+}
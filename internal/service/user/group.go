@@ -0,0 +1,274 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/validator"
+)
+
+var groupNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+
+var groupNameRules = []validator.Rule[string]{
+	validator.Required(),
+	validator.Length(2, 64),
+	validator.Match(groupNamePattern, "Допустимы строчные латинские буквы, цифры и символы . _ -, начиная с буквы или цифры"),
+}
+
+func (s *service) CreateGroup(ctx context.Context, name string) (*model.Group, error) {
+	if err := validator.Validate(validator.Field("name", &name, groupNameRules...)); err != nil {
+		return nil, err
+	}
+
+	group, err := s.groupRepo.Create(ctx, name)
+	if err != nil {
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			return nil, errGroupAlreadyExists
+		}
+		return nil, err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventGroupCreated,
+		Subject: group.Name,
+	})
+
+	return group, nil
+}
+
+func (s *service) GetGroup(ctx context.Context, name string) (*model.Group, error) {
+	return s.getGroup(ctx, name)
+}
+
+func (s *service) ListGroups(ctx context.Context) ([]*model.Group, error) {
+	return s.groupRepo.List(ctx)
+}
+
+func (s *service) RenameGroup(ctx context.Context, name, newName string) error {
+	if err := validator.Validate(validator.Field("new_name", &newName, groupNameRules...)); err != nil {
+		return err
+	}
+
+	group, err := s.getGroup(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err = s.groupRepo.Rename(ctx, group.ID, newName); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrRecordNotFound):
+			return errGroupNotFound
+		case errors.Is(err, repo.ErrAlreadyExists):
+			return errGroupAlreadyExists
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventGroupRenamed,
+		Subject: newName,
+		Payload: map[string]interface{}{"old_name": group.Name},
+	})
+
+	return nil
+}
+
+// DeleteGroup удаляет группу. Её участники теряют унаследованные через неё роли
+func (s *service) DeleteGroup(ctx context.Context, name string) error {
+	group, err := s.getGroup(ctx, name)
+	if err != nil {
+		return err
+	}
+
+	if err = s.groupRepo.Delete(ctx, group.ID); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errGroupNotFound
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventGroupDeleted,
+		Subject: group.Name,
+	})
+
+	return nil
+}
+
+// AddGroupMember добавляет в группу пользователя или другую группу.
+// Группа не может войти в группу, которая сама в неё входит
+func (s *service) AddGroupMember(ctx context.Context, groupName string, member *model.GroupMember) error {
+	group, err := s.getGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+
+	payload, err := s.changeGroupMember(ctx, group, member, s.groupRepo.AddUser, s.groupRepo.AddGroup)
+	if err != nil {
+		switch {
+		case errors.Is(err, repo.ErrAlreadyExists):
+			return errGroupMemberAlreadyExists
+		case errors.Is(err, repo.ErrCycle):
+			return errGroupCycle
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventGroupMemberAdded,
+		Subject: group.Name,
+		Payload: payload,
+	})
+
+	return nil
+}
+
+func (s *service) RemoveGroupMember(ctx context.Context, groupName string, member *model.GroupMember) error {
+	group, err := s.getGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+
+	payload, err := s.changeGroupMember(ctx, group, member, s.groupRepo.RemoveUser, s.groupRepo.RemoveGroup)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errGroupMemberNotFound
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventGroupMemberRemoved,
+		Subject: group.Name,
+		Payload: payload,
+	})
+
+	return nil
+}
+
+// changeGroupMember находит участника и применяет к нему изменение для пользователя
+// или для группы. Возвращает описание участника для события
+func (s *service) changeGroupMember(
+	ctx context.Context,
+	group *model.Group,
+	member *model.GroupMember,
+	changeUser func(ctx context.Context, id int64, username string) error,
+	changeGroup func(ctx context.Context, id, memberID int64) error,
+) (map[string]interface{}, error) {
+	if (member.Username == "") == (member.GroupName == "") {
+		return nil, errInvalidGroupMember
+	}
+
+	if member.GroupName != "" {
+		memberGroup, err := s.getGroup(ctx, member.GroupName)
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{"group": memberGroup.Name}, changeGroup(ctx, group.ID, memberGroup.ID)
+	}
+
+	user, err := s.Get(ctx, member.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return map[string]interface{}{"username": user.Username}, changeUser(ctx, group.ID, user.Username)
+}
+
+// ListGroupMembers возвращает прямых участников группы или, если effective,
+// всех пользователей и группы, входящие в неё через вложенные группы
+func (s *service) ListGroupMembers(ctx context.Context, groupName string, effective bool) (*model.GroupMembers, error) {
+	group, err := s.getGroup(ctx, groupName)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.groupRepo.ListMembers(ctx, group.ID, effective)
+}
+
+// ListUserGroups возвращает все группы, в которые пользователь входит прямо или через вложенные группы
+func (s *service) ListUserGroups(ctx context.Context, username string) ([]*model.GroupMembership, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.groupRepo.ListUserGroups(ctx, user.Username)
+}
+
+// AssignGroupRole назначает роль группе. Роль действует для всех её участников,
+// в том числе входящих через вложенные группы
+func (s *service) AssignGroupRole(ctx context.Context, groupName, roleName string) error {
+	group, err := s.getGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.getRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	// Роль группы получают все её участники, поэтому действует то же ограничение, что и в AssignRole
+	if err = s.checkCanGrantRole(ctx, role.ID); err != nil {
+		return err
+	}
+
+	if err = s.groupRepo.AssignRole(ctx, group.ID, role.ID); err != nil {
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			return errGroupRoleAlreadyAssigned
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventGroupRoleAssigned,
+		Subject: group.Name,
+		Payload: map[string]interface{}{"role": role.Name},
+	})
+
+	return nil
+}
+
+func (s *service) UnassignGroupRole(ctx context.Context, groupName, roleName string) error {
+	group, err := s.getGroup(ctx, groupName)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.getRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	if err = s.groupRepo.UnassignRole(ctx, group.ID, role.ID); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errGroupRoleNotAssigned
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventGroupRoleUnassigned,
+		Subject: group.Name,
+		Payload: map[string]interface{}{"role": role.Name},
+	})
+
+	return nil
+}
+
+func (s *service) getGroup(ctx context.Context, name string) (*model.Group, error) {
+	group, err := s.groupRepo.GetByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errGroupNotFound
+		}
+		return nil, err
+	}
+
+	return group, nil
+}
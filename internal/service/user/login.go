@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Slintox/user-service/internal/clientip"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/token"
+)
+
+func (s *service) Login(ctx context.Context, credentials *model.Credentials) (*model.User, *model.Session, error) {
+	username, password := credentials.Username, credentials.Password
+	ip := clientip.FromContext(ctx)
+
+	attempt, err := s.reserveLoginAttempt(ctx, username, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.finishLoginAttempt(ctx, attempt)
+
+	user, err := s.userRepo.Get(ctx, username)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			_, _ = s.hasher.Verify(s.dummyHash, password)
+			attempt.failed = true
+			return nil, nil, errInvalidCredentials
+		}
+		return nil, nil, err
+	}
+
+	ok, err := s.hasher.Verify(user.Password, password)
+	if err != nil {
+		return nil, nil, err
+	}
+	if !ok {
+		attempt.failed = true
+		return nil, nil, errInvalidCredentials
+	}
+
+	mfaEnrollmentRequired, err := s.checkMfa(ctx, user, credentials)
+	if err != nil {
+		if errors.Is(err, errInvalidMfaCode) {
+			attempt.failed = true
+		}
+		return nil, nil, err
+	}
+
+	s.resetLoginFailures(ctx, username)
+	s.upgradePasswordHash(ctx, user, password)
+
+	session, err := s.createSession(ctx, user.Username, mfaEnrollmentRequired)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, session, nil
+}
+
+// createSession выдаёт новую сессию. Токен возвращается клиенту один раз,
+// в базе хранится только его хеш. Сессия с mfaEnrollmentRequired позволяет
+// только подключить второй фактор
+func (s *service) createSession(ctx context.Context, username string, mfaEnrollmentRequired bool) (*model.Session, error) {
+	raw, hash, err := token.Generate("")
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.sessionRepo.Create(ctx, username, hash, mfaEnrollmentRequired, s.sessionCfg.TTL)
+	if err != nil {
+		return nil, err
+	}
+	session.Token = raw
+
+	return session, nil
+}
+
+// upgradePasswordHash пересчитывает хеш с текущими алгоритмом и параметрами.
+// Ошибка не прерывает вход: хеш будет обновлён при следующем входе
+func (s *service) upgradePasswordHash(ctx context.Context, user *model.User, password string) {
+	if !s.hasher.NeedsRehash(user.Password) {
+		return
+	}
+
+	newHash, err := s.hasher.Hash(password)
+	if err != nil {
+		log.Printf("user.upgradePasswordHash: failed to hash password: %s", err.Error())
+		return
+	}
+
+	if err = s.userRepo.UpdatePasswordHash(ctx, user.Username, user.Password, newHash); err != nil {
+		log.Printf("user.upgradePasswordHash: failed to update hash: %s", err.Error())
+		return
+	}
+
+	user.Password = newHash
+}
+
+func (s *service) GetPasswordHashStats(ctx context.Context) (map[string]int64, error) {
+	return s.userRepo.CountByPasswordAlgorithm(ctx)
+}
@@ -0,0 +1,235 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/token"
+	"github.com/Slintox/user-service/internal/totp"
+)
+
+// Коды восстановления: 80 бит в base32, показываются группами по 4 символа
+const (
+	recoveryCodeBytes = 10
+	recoveryCodeGroup = 4
+)
+
+// EnrollMfa начинает подключение TOTP: создаёт секрет, который вступит в силу
+// после подтверждения первым кодом. Повторный вызов заменяет неподтверждённый секрет
+func (s *service) EnrollMfa(ctx context.Context, username string) (*model.MfaEnrollment, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.mfaRepo.SetSecret(ctx, user.Username, secret); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errMfaAlreadyEnabled
+		}
+		return nil, err
+	}
+
+	return &model.MfaEnrollment{
+		Secret: secret,
+		URI:    totp.URI(s.mfaCfg.Issuer, user.Username, secret),
+	}, nil
+}
+
+// ConfirmMfa включает второй фактор после проверки первого кода
+// и возвращает коды восстановления. Коды показываются только один раз
+func (s *service) ConfirmMfa(ctx context.Context, username, code string) ([]string, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	mfa, err := s.mfaRepo.Get(ctx, user.Username)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errMfaNotEnrolled
+		}
+		return nil, err
+	}
+
+	if mfa.ConfirmedAt != nil {
+		return nil, errMfaAlreadyEnabled
+	}
+
+	step, ok, err := totp.Validate(mfa.Secret, code, time.Now(), s.mfaCfg.Skew)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return nil, errInvalidMfaCode
+	}
+
+	codes, hashes, err := generateRecoveryCodes(s.mfaCfg.RecoveryCodes)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = s.mfaRepo.Confirm(ctx, user.Username, step, hashes); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errMfaAlreadyEnabled
+		}
+		return nil, err
+	}
+
+	// Сессии, ограниченные подключением второго фактора, получают полный доступ
+	if err = s.sessionRepo.CompleteMfaEnrollment(ctx, user.Username); err != nil {
+		return nil, err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventMfaEnabled,
+		Subject: user.Username,
+	})
+
+	return codes, nil
+}
+
+// DisableMfa отключает второй фактор, например при потере устройства и кодов восстановления
+func (s *service) DisableMfa(ctx context.Context, username string) error {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if err = s.mfaRepo.Delete(ctx, user.Username); err != nil {
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventMfaDisabled,
+		Subject: user.Username,
+	})
+
+	return nil
+}
+
+func (s *service) GetMfaPolicies(ctx context.Context) ([]*model.MfaRolePolicy, error) {
+	return s.mfaRepo.GetPolicies(ctx)
+}
+
+func (s *service) SetMfaPolicy(ctx context.Context, policy *model.MfaRolePolicy) error {
+	role, err := s.resolveRole(ctx, policy.Role, policy.RoleName)
+	if err != nil {
+		return err
+	}
+
+	return s.mfaRepo.SetPolicy(ctx, &model.MfaRolePolicy{
+		Role:     role,
+		Required: policy.Required,
+	})
+}
+
+// mfaEnrollmentRequired сообщает, что второй фактор обязателен для ролей пользователя,
+// но ещё не подключён
+func (s *service) mfaEnrollmentRequired(ctx context.Context, user *model.User) (bool, error) {
+	mfa, err := s.mfaRepo.Get(ctx, user.Username)
+	if err != nil && !errors.Is(err, repo.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if mfa != nil && mfa.ConfirmedAt != nil {
+		return false, nil
+	}
+
+	return s.mfaRepo.IsRequired(ctx, user.RoleIDs()...)
+}
+
+// checkMfa проверяет второй фактор пользователя, уже подтвердившего пароль.
+// Если второй фактор не подключён, сообщает, обязателен ли он для ролей пользователя
+func (s *service) checkMfa(ctx context.Context, user *model.User, credentials *model.Credentials) (bool, error) {
+	mfa, err := s.mfaRepo.Get(ctx, user.Username)
+	if err != nil && !errors.Is(err, repo.ErrRecordNotFound) {
+		return false, err
+	}
+
+	if mfa == nil || mfa.ConfirmedAt == nil {
+		return s.mfaRepo.IsRequired(ctx, user.RoleIDs()...)
+	}
+
+	switch {
+	case credentials.MfaCode != "":
+		step, ok, err := totp.Validate(mfa.Secret, credentials.MfaCode, time.Now(), s.mfaCfg.Skew)
+		if err != nil {
+			return false, err
+		}
+		if !ok {
+			return false, errInvalidMfaCode
+		}
+
+		// Код одного шага принимается только один раз
+		if err = s.mfaRepo.UseStep(ctx, user.Username, step); err != nil {
+			if errors.Is(err, repo.ErrRecordNotFound) {
+				return false, errInvalidMfaCode
+			}
+			return false, err
+		}
+	case credentials.RecoveryCode != "":
+		err = s.mfaRepo.UseRecoveryCode(ctx, user.Username, token.Hash(canonicalRecoveryCode(credentials.RecoveryCode)))
+		if err != nil {
+			if errors.Is(err, repo.ErrRecordNotFound) {
+				return false, errInvalidMfaCode
+			}
+			return false, err
+		}
+
+		s.publishEvent(ctx, &model.Event{
+			Type:    model.EventMfaRecoveryCodeUsed,
+			Subject: user.Username,
+		})
+	default:
+		return false, errMfaRequired
+	}
+
+	return false, nil
+}
+
+// generateRecoveryCodes возвращает коды для пользователя и их хеши для хранения
+func generateRecoveryCodes(count int) ([]string, []string, error) {
+	codes := make([]string, 0, count)
+	hashes := make([]string, 0, count)
+
+	for i := 0; i < count; i++ {
+		b := make([]byte, recoveryCodeBytes)
+		if _, err := rand.Read(b); err != nil {
+			return nil, nil, err
+		}
+
+		raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+
+		groups := make([]string, 0, len(raw)/recoveryCodeGroup)
+		for start := 0; start < len(raw); start += recoveryCodeGroup {
+			groups = append(groups, raw[start:start+recoveryCodeGroup])
+		}
+
+		codes = append(codes, strings.Join(groups, "-"))
+		hashes = append(hashes, token.Hash(raw))
+	}
+
+	return codes, hashes, nil
+}
+
+// canonicalRecoveryCode убирает разделители и приводит код к верхнему регистру,
+// чтобы код принимался в том виде, в каком его ввёл пользователь
+func canonicalRecoveryCode(code string) string {
+	return strings.Map(func(r rune) rune {
+		if r == '-' || r == ' ' {
+			return -1
+		}
+		return r
+	}, strings.ToUpper(code))
+}
@@ -0,0 +1,104 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/internal/totp"
+)
+
+func TestMfaCodeReplayRejected(t *testing.T) {
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	confirmedAt := time.Now()
+	s := &service{
+		mfaRepo: &memMfaRepo{mfa: &model.Mfa{Username: "alice", Secret: secret, ConfirmedAt: &confirmedAt}},
+		mfaCfg:  &config.MfaConfig{Skew: 1},
+	}
+	user := &model.User{Username: "alice"}
+
+	code := func(offset int64) string {
+		code, err := totp.Code(secret, totp.Step(time.Now())+offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return code
+	}
+	check := func(code string) error {
+		_, err := s.checkMfa(context.Background(), user, &model.Credentials{Username: "alice", MfaCode: code})
+		return err
+	}
+
+	current := code(0)
+	if err = check(current); err != nil {
+		t.Fatalf("first use: %v", err)
+	}
+	if err = check(current); err != errInvalidMfaCode {
+		t.Fatalf("replay: err = %v, want %v", err, errInvalidMfaCode)
+	}
+
+	// Код предыдущего шага ещё в окне, но после более позднего кода не принимается
+	if err = check(code(-1)); err != errInvalidMfaCode {
+		t.Fatalf("earlier step: err = %v, want %v", err, errInvalidMfaCode)
+	}
+
+	if err = check(code(1)); err != nil {
+		t.Fatalf("next step: %v", err)
+	}
+}
+
+// Вход без второго фактора, обязательного для роли, даёт сессию,
+// которая позволяет только подключить его
+func TestMfaEnrollmentRestrictsSessionUntilConfirmed(t *testing.T) {
+	s, _, _ := newThrottleService(t)
+	s.sessionRepo = &memSessionRepo{}
+	s.mfaRepo = &memMfaRepo{required: true}
+	s.permissionRepo = &memPermissionRepo{}
+	s.sessionCfg = &config.SessionConfig{TTL: time.Hour}
+	s.mfaCfg = &config.MfaConfig{Issuer: "test", Skew: 1, RecoveryCodes: 2}
+
+	ctx := tenant.NewContext(context.Background(), model.DefaultOrganizationID)
+
+	_, session, err := s.Login(ctx, &model.Credentials{Username: "alice", Password: "right password"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !session.MfaEnrollmentRequired {
+		t.Fatal("session is not restricted to MFA enrollment")
+	}
+
+	principal, err := s.Authenticate(ctx, session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !principal.MfaEnrollmentRequired {
+		t.Fatal("principal is not restricted to MFA enrollment")
+	}
+
+	enrollment, err := s.EnrollMfa(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := totp.Code(enrollment.Secret, totp.Step(time.Now()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = s.ConfirmMfa(ctx, "alice", code); err != nil {
+		t.Fatal(err)
+	}
+
+	principal, err = s.Authenticate(ctx, session.Token)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if principal.MfaEnrollmentRequired {
+		t.Fatal("session is still restricted after MFA enrollment")
+	}
+}
@@ -0,0 +1,83 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"regexp"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/internal/validator"
+)
+
+var organizationNamePattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+var organizationNameRules = []validator.Rule[string]{
+	validator.Required(),
+	validator.Length(2, 63),
+	validator.Match(organizationNamePattern, "Допустимы строчные латинские буквы, цифры и дефис, начиная с буквы или цифры"),
+}
+
+// CreateOrganization создаёт организацию и, если указан admin, её первого администратора.
+// Данные администратора проверяются до создания организации
+func (s *service) CreateOrganization(ctx context.Context, name string, admin *model.CreateUser) (*model.Organization, error) {
+	if err := validator.Validate(validator.Field("name", &name, organizationNameRules...)); err != nil {
+		return nil, err
+	}
+
+	if admin != nil {
+		if !auth.FromContext(ctx).Can(model.PermissionAssignRoles) {
+			return nil, errRoleAssignmentNotAllowed
+		}
+		if err := s.validateCreateUser(admin); err != nil {
+			return nil, err
+		}
+		if err := s.checkBreached(admin.Password); err != nil {
+			return nil, err
+		}
+	}
+
+	organization, err := s.organizationRepo.Create(ctx, name)
+	if err != nil {
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			return nil, errOrganizationAlreadyExists
+		}
+		return nil, err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventOrganizationCreated,
+		Subject: organization.Name,
+	})
+
+	if admin != nil {
+		adminUser := *admin
+		adminUser.Role = model.UserRoleAdmin
+		adminUser.RoleName = ""
+
+		if err = s.Create(tenant.NewContext(ctx, organization.ID), &adminUser); err != nil {
+			return nil, err
+		}
+	}
+
+	return organization, nil
+}
+
+func (s *service) ListOrganizations(ctx context.Context) ([]*model.Organization, error) {
+	return s.organizationRepo.List(ctx)
+}
+
+// ResolveOrganization возвращает id организации по имени из заголовка запроса
+func (s *service) ResolveOrganization(ctx context.Context, name string) (int64, error) {
+	organization, err := s.organizationRepo.GetByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return 0, errOrganizationNotFound
+		}
+		return 0, err
+	}
+
+	return organization.ID, nil
+}
@@ -0,0 +1,91 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/clientip"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	"github.com/Slintox/user-service/internal/password"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/validator"
+)
+
+// ChangePassword меняет пароль пользователя, знающего текущий пароль.
+// Неверный текущий пароль учитывается как неудачная попытка входа.
+// Остальные сессии пользователя отзываются: в них мог остаться тот, кто знал прежний пароль.
+// Сессия, из которой пользователь сменил свой пароль, продолжает действовать
+func (s *service) ChangePassword(ctx context.Context, username string, changeData *model.ChangePassword) error {
+	ip := clientip.FromContext(ctx)
+
+	attempt, err := s.reserveLoginAttempt(ctx, username, ip)
+	if err != nil {
+		return err
+	}
+	defer s.finishLoginAttempt(ctx, attempt)
+
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	ok, err := s.hasher.Verify(user.Password, changeData.CurrentPassword)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		attempt.failed = true
+		return errInvalidCurrentPassword
+	}
+
+	if err = validator.Validate(
+		validator.Field("new_password", &changeData.NewPassword, password.Rules(s.passwordPolicy, user.Username, user.Email)...),
+		validator.Field("confirm_password", &changeData.ConfirmPassword, validator.Equal(changeData.NewPassword, "Пароли не совпадают")),
+	); err != nil {
+		return err
+	}
+
+	if err = s.checkNewPassword(ctx, user, changeData.NewPassword); err != nil {
+		return err
+	}
+
+	if err = s.storePassword(ctx, user, changeData.NewPassword); err != nil {
+		return err
+	}
+
+	var currentSession int64
+	if principal := auth.FromContext(ctx); principal != nil && normalize.Username(principal.Username) == normalize.Username(user.Username) {
+		currentSession = principal.SessionID
+	}
+
+	_, err = s.sessionRepo.RevokeAllExcept(ctx, user.Username, currentSession)
+	return err
+}
+
+// checkNewPassword проверяет уже прошедший валидацию пароль по базе утечек и истории
+func (s *service) checkNewPassword(ctx context.Context, user *model.User, newPassword string) error {
+	if err := s.checkBreached(newPassword); err != nil {
+		return err
+	}
+
+	return s.checkPasswordReuse(ctx, user, newPassword)
+}
+
+// storePassword сохраняет хеш нового пароля, предыдущий уходит в историю
+func (s *service) storePassword(ctx context.Context, user *model.User, newPassword string) error {
+	hash, err := s.hasher.Hash(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err = s.userRepo.Update(ctx, user.Username, &model.UpdateUser{Password: &hash}); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errUserNotFound
+		}
+		return err
+	}
+
+	return nil
+}
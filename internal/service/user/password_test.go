@@ -0,0 +1,132 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/password"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+// newPasswordService создаёт сервис с пользователем alice, пароль которого "right password"
+func newPasswordService(t *testing.T) (*service, *memSessionRepo) {
+	t.Helper()
+
+	s, _, _ := newThrottleService(t)
+
+	breachChecker, err := password.LoadBreachChecker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := &memSessionRepo{}
+	s.sessionRepo = sessions
+	s.breachChecker = breachChecker
+	s.passwordPolicy = &model.PasswordPolicy{MinLength: 8, MaxLength: 72}
+
+	return s, sessions
+}
+
+func changePassword(s *service, ctx context.Context, current, next string) error {
+	return s.ChangePassword(ctx, "alice", &model.ChangePassword{
+		CurrentPassword: current,
+		NewPassword:     next,
+		ConfirmPassword: next,
+	})
+}
+
+func TestChangePasswordRevokesOtherSessions(t *testing.T) {
+	tests := []struct {
+		name      string
+		principal *auth.Principal
+		// Сессия alice, которая остаётся. Сессия администратора совпадает с ней по id,
+		// но принадлежит другому пользователю и не сохраняет сессию alice
+		kept string
+	}{
+		{name: "own password", principal: &auth.Principal{Username: "Alice"}, kept: "current"},
+		{name: "by administrator", principal: &auth.Principal{Username: "root", SessionID: 1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, sessions := newPasswordService(t)
+			ctx := context.Background()
+
+			current, err := sessions.Create(ctx, "alice", "current", false, time.Hour)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = sessions.Create(ctx, "alice", "other", false, time.Hour); err != nil {
+				t.Fatal(err)
+			}
+
+			principal := *tt.principal
+			if tt.kept != "" {
+				principal.SessionID = current.ID
+			}
+
+			if err = changePassword(s, auth.NewContext(ctx, &principal), "right password", "new password"); err != nil {
+				t.Fatalf("ChangePassword() err = %v", err)
+			}
+
+			for _, hash := range []string{"current", "other"} {
+				_, err := sessions.Get(ctx, hash)
+				if revoked := err == repo.ErrRecordNotFound; revoked != (hash != tt.kept) {
+					t.Fatalf("session %s: revoked = %v", hash, revoked)
+				}
+			}
+		})
+	}
+}
+
+// Пароль нельзя повторить, пока он в пределах глубины истории.
+// Более старые записи удаляются, и такие пароли снова допустимы
+func TestChangePasswordRejectsReuseWithinHistory(t *testing.T) {
+	const depth = 2
+
+	s, _ := newPasswordService(t)
+	s.passwordPolicy.HistoryDepth = depth
+	users := s.userRepo.(*memUserRepo)
+	users.historyDepth = depth
+	ctx := context.Background()
+
+	// Пароли по порядку: исходный, затем три смены
+	passwords := []string{"right password", "first password", "second password", "third password"}
+	for i := 1; i < len(passwords); i++ {
+		if err := changePassword(s, ctx, passwords[i-1], passwords[i]); err != nil {
+			t.Fatalf("change to %q: err = %v", passwords[i], err)
+		}
+	}
+
+	if history := users.history["alice"]; len(history) != depth {
+		t.Fatalf("history has %d entries, want %d", len(history), depth)
+	}
+
+	current := passwords[len(passwords)-1]
+	tests := []struct {
+		password string
+		want     error
+	}{
+		{password: current, want: errPasswordReused},
+		{password: passwords[2], want: errPasswordReused},
+		{password: passwords[1], want: errPasswordReused},
+		// Исходный пароль вытеснен из истории
+		{password: passwords[0]},
+	}
+
+	for _, tt := range tests {
+		if err := s.checkPasswordReuse(ctx, users.users[0], tt.password); err != tt.want {
+			t.Fatalf("checkPasswordReuse(%q) err = %v, want %v", tt.password, err, tt.want)
+		}
+	}
+
+	if err := changePassword(s, ctx, current, passwords[2]); err != errPasswordReused {
+		t.Fatalf("ChangePassword() to a recent password err = %v, want %v", err, errPasswordReused)
+	}
+	if err := changePassword(s, ctx, current, passwords[0]); err != nil {
+		t.Fatalf("ChangePassword() to a pruned password err = %v", err)
+	}
+}
@@ -0,0 +1,123 @@
+package user
+
+import (
+	"context"
+	"errors"
+
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+// ListPermissions возвращает все разрешения или, если указана роль, только разрешения роли
+func (s *service) ListPermissions(ctx context.Context, roleName string) ([]*model.Permission, error) {
+	permissions, err := s.permissionRepo.List(ctx)
+	if err != nil || roleName == "" {
+		return permissions, err
+	}
+
+	role, err := s.getRole(ctx, roleName)
+	if err != nil {
+		return nil, err
+	}
+
+	granted, err := s.permissionRepo.ListByRoles(ctx, role.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	grantedSet := make(map[string]bool, len(granted))
+	for _, name := range granted {
+		grantedSet[name] = true
+	}
+
+	result := make([]*model.Permission, 0, len(granted))
+	for _, permission := range permissions {
+		if grantedSet[permission.Name] {
+			result = append(result, permission)
+		}
+	}
+
+	return result, nil
+}
+
+func (s *service) GrantPermission(ctx context.Context, roleName, permission string) error {
+	role, err := s.getRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	if _, err = s.getPermission(ctx, permission); err != nil {
+		return err
+	}
+
+	if err = s.permissionRepo.Grant(ctx, role.ID, permission); err != nil {
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventPermissionGranted,
+		Subject: role.Name,
+		Payload: map[string]interface{}{"permission": permission},
+	})
+
+	return nil
+}
+
+func (s *service) RevokePermission(ctx context.Context, roleName, permission string) error {
+	role, err := s.getRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	if err = s.permissionRepo.Revoke(ctx, role.ID, permission); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errPermissionNotGranted
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventPermissionRevoked,
+		Subject: role.Name,
+		Payload: map[string]interface{}{"permission": permission},
+	})
+
+	return nil
+}
+
+// CheckPermission сообщает, есть ли разрешение хотя бы у одной из ролей пользователя
+func (s *service) CheckPermission(ctx context.Context, username, permission string) (bool, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return false, err
+	}
+
+	if _, err = s.getPermission(ctx, permission); err != nil {
+		return false, err
+	}
+
+	granted, err := s.permissionRepo.ListByRoles(ctx, user.RoleIDs()...)
+	if err != nil {
+		return false, err
+	}
+
+	for _, name := range granted {
+		if name == permission {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (s *service) getPermission(ctx context.Context, name string) (*model.Permission, error) {
+	permission, err := s.permissionRepo.Get(ctx, name)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errPermissionNotFound
+		}
+		return nil, err
+	}
+
+	return permission, nil
+}
@@ -0,0 +1,53 @@
+package user
+
+import (
+	"context"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/policy"
+	repo "github.com/Slintox/user-service/internal/repository"
+)
+
+// DryRunPolicy проверяет запрос правилами политик, ничего не выполняя.
+// Проверяются загруженные политики или черновик из dryRun.Source,
+// от имени вызывающего или пользователя dryRun.PrincipalUsername
+func (s *service) DryRunPolicy(ctx context.Context, dryRun *model.PolicyDryRun) (*model.PolicyResult, error) {
+	if dryRun.Method == "" {
+		return nil, errPolicyMethodRequired
+	}
+
+	rules := s.policies.Rules()
+	if dryRun.Source != "" {
+		draft, err := policy.Parse("draft", []byte(dryRun.Source))
+		if err != nil {
+			return nil, errInvalidPolicy(err)
+		}
+		rules = draft
+	}
+
+	principal := auth.FromContext(ctx)
+	if dryRun.PrincipalUsername != "" {
+		organizationID, err := repo.TenantID(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if principal, err = s.principal(ctx, organizationID, dryRun.PrincipalUsername, errUserNotFound); err != nil {
+			return nil, err
+		}
+	}
+
+	var target *model.User
+	if dryRun.Username != "" {
+		var err error
+		if target, err = s.Get(ctx, dryRun.Username); err != nil {
+			return nil, err
+		}
+	}
+
+	return rules.Evaluate(&policy.Input{
+		Principal: principal,
+		Method:    dryRun.Method,
+		Target:    target,
+	}), nil
+}
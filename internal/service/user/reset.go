@@ -0,0 +1,151 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/Slintox/user-service/internal/clientip"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	"github.com/Slintox/user-service/internal/notifier"
+	"github.com/Slintox/user-service/internal/password"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/internal/token"
+	"github.com/Slintox/user-service/internal/validator"
+)
+
+const (
+	resetResendSubjectPrefix   = "reset:"
+	resetResendIPSubjectPrefix = "reset-ip:"
+)
+
+// RequestPasswordReset отправляет пользователю с указанным email одноразовый токен сброса.
+// Ответ не зависит от существования email, а вся работа выполняется в фоне,
+// чтобы по времени ответа нельзя было определить, зарегистрирован ли адрес.
+// Частота запросов ограничена для адреса и IP-адреса так же, как повторная отправка
+// письма подтверждения, независимо от того, зарегистрирован ли адрес.
+// Фоновая работа не зависит от отмены запроса, но ограничена его организацией
+func (s *service) RequestPasswordReset(ctx context.Context, email string) error {
+	subjects := []string{resetResendSubjectPrefix + normalize.Email(email)}
+	if ip := clientip.FromContext(ctx); ip != "" {
+		subjects = append(subjects, resetResendIPSubjectPrefix+ip)
+	}
+
+	if err := s.checkResendLimit(ctx, subjects...); err != nil {
+		return err
+	}
+
+	organizationID, ok := tenant.FromContext(ctx)
+
+	s.notifyWorker.Go(notifier.KindPasswordReset, func() {
+		ctx := context.Background()
+		if ok {
+			ctx = tenant.NewContext(ctx, organizationID)
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, notifyTimeout)
+		defer cancel()
+
+		if err := s.sendPasswordReset(ctx, email); err != nil {
+			log.Printf("user.RequestPasswordReset: %s", err.Error())
+		}
+	})
+
+	return nil
+}
+
+func (s *service) sendPasswordReset(ctx context.Context, email string) error {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	raw, hash, err := token.Generate("")
+	if err != nil {
+		return err
+	}
+
+	if err = s.resetRepo.Create(ctx, user.Username, hash, s.resetCfg.TokenTTL); err != nil {
+		return err
+	}
+
+	return s.notifier.Notify(ctx, &notifier.Notification{
+		Kind:     notifier.KindPasswordReset,
+		To:       user.Email,
+		Username: user.Username,
+		Data: map[string]string{
+			"token":      raw,
+			"expires_in": s.resetCfg.TokenTTL.String(),
+		},
+	})
+}
+
+// ResetPassword устанавливает новый пароль по токену сброса.
+// Токен одноразовый, а все сессии и API-ключи пользователя после сброса отзываются:
+// сброс означает, что прежние учётные данные могли попасть к чужим
+func (s *service) ResetPassword(ctx context.Context, resetToken, newPassword string) error {
+	hash := token.Hash(resetToken)
+
+	resetData, err := s.resetRepo.Get(ctx, hash)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errInvalidResetToken
+		}
+		return err
+	}
+
+	user, err := s.Get(ctx, resetData.Username)
+	if err != nil {
+		return err
+	}
+
+	if err = validator.Validate(
+		validator.Field("new_password", &newPassword, password.Rules(s.passwordPolicy, user.Username, user.Email)...),
+	); err != nil {
+		return err
+	}
+
+	if err = s.checkNewPassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	// Токен помечается использованным до смены пароля,
+	// чтобы параллельные запросы с одним токеном не прошли оба
+	if err = s.resetRepo.Consume(ctx, hash); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errInvalidResetToken
+		}
+		return err
+	}
+
+	if err = s.storePassword(ctx, user, newPassword); err != nil {
+		return err
+	}
+
+	if err = s.resetRepo.InvalidateAll(ctx, user.Username); err != nil {
+		return err
+	}
+
+	if _, err = s.sessionRepo.RevokeAll(ctx, user.Username); err != nil {
+		return err
+	}
+
+	if _, err = s.apiKeyRepo.RevokeAll(ctx, user.Username); err != nil {
+		return err
+	}
+
+	// Владелец почты подтвердил личность, блокировка входа больше не нужна
+	s.resetLoginFailures(ctx, user.Username)
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventPasswordReset,
+		Subject: user.Username,
+	})
+
+	return nil
+}
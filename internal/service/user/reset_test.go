@@ -0,0 +1,242 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/status"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/clientip"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/notifier"
+	"github.com/Slintox/user-service/internal/password"
+	repo "github.com/Slintox/user-service/internal/repository"
+	resetRepo "github.com/Slintox/user-service/internal/repository/reset"
+	uRepo "github.com/Slintox/user-service/internal/repository/user"
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/internal/token"
+)
+
+// tenantUserRepo находит пользователя только в организации organizationID,
+// как это делают запросы под row level security
+type tenantUserRepo struct {
+	uRepo.Repository
+	organizationID int64
+	user           *model.User
+}
+
+func (r *tenantUserRepo) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	organizationID, err := repo.TenantID(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if organizationID != r.organizationID || email != r.user.Email {
+		return nil, repo.ErrRecordNotFound
+	}
+
+	return r.user, nil
+}
+
+type tenantResetRepo struct {
+	resetRepo.Repository
+	organizationIDs chan int64
+}
+
+func (r *tenantResetRepo) Create(ctx context.Context, _, _ string, _ time.Duration) error {
+	organizationID, err := repo.TenantID(ctx)
+	if err != nil {
+		return err
+	}
+
+	r.organizationIDs <- organizationID
+
+	return nil
+}
+
+// memResetRepo хранит токены сброса по хешу
+type memResetRepo struct {
+	resetRepo.Repository
+	tokens map[string]string
+}
+
+func (r *memResetRepo) Get(_ context.Context, tokenHash string) (*model.PasswordResetToken, error) {
+	username, ok := r.tokens[tokenHash]
+	if !ok {
+		return nil, repo.ErrRecordNotFound
+	}
+
+	return &model.PasswordResetToken{Username: username, ExpiresAt: time.Now().Add(time.Hour)}, nil
+}
+
+func (r *memResetRepo) Consume(_ context.Context, tokenHash string) error {
+	if _, ok := r.tokens[tokenHash]; !ok {
+		return repo.ErrRecordNotFound
+	}
+	delete(r.tokens, tokenHash)
+
+	return nil
+}
+
+func (r *memResetRepo) InvalidateAll(_ context.Context, username string) error {
+	for hash, owner := range r.tokens {
+		if owner == username {
+			delete(r.tokens, hash)
+		}
+	}
+
+	return nil
+}
+
+type chanNotifier chan *notifier.Notification
+
+func (n chanNotifier) Notify(_ context.Context, notification *notifier.Notification) error {
+	n <- notification
+	return nil
+}
+
+func TestRequestPasswordResetKeepsOrganization(t *testing.T) {
+	const organizationID int64 = 42
+
+	user := &model.User{Username: "alice", Email: "alice@example.com"}
+	resets := &tenantResetRepo{organizationIDs: make(chan int64, 1)}
+	notifications := make(chanNotifier, 1)
+
+	s := &service{
+		userRepo:     &tenantUserRepo{organizationID: organizationID, user: user},
+		resetRepo:    resets,
+		throttleRepo: &memThrottleRepo{},
+		notifier:     notifications,
+		notifyWorker: newWorker(1, 1),
+		resetCfg:     &config.PasswordResetConfig{TokenTTL: time.Hour},
+		verifyCfg:    resendCfg(),
+	}
+
+	// Запрос отменяется сразу после ответа, фоновая отправка от этого не зависит
+	ctx, cancel := context.WithCancel(tenant.NewContext(context.Background(), organizationID))
+	if err := s.RequestPasswordReset(ctx, user.Email); err != nil {
+		t.Fatal(err)
+	}
+	cancel()
+
+	select {
+	case got := <-resets.organizationIDs:
+		if got != organizationID {
+			t.Fatalf("token created in organization %d, want %d", got, organizationID)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reset token was not created")
+	}
+
+	select {
+	case notification := <-notifications:
+		if notification.To != user.Email || notification.Data["token"] == "" {
+			t.Fatalf("unexpected notification %+v", notification)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reset notification was not sent")
+	}
+}
+
+func resendCfg() *config.EmailVerificationConfig {
+	return &config.EmailVerificationConfig{
+		ResendInterval: time.Minute,
+		ResendLimit:    5,
+		ResendWindow:   24 * time.Hour,
+	}
+}
+
+// Запросы сброса ограничены и для адреса, и для IP-адреса, с которого они приходят
+func TestRequestPasswordResetIsRateLimited(t *testing.T) {
+	s := &service{
+		userRepo:     &tenantUserRepo{organizationID: model.DefaultOrganizationID, user: &model.User{Username: "alice", Email: "alice@example.com"}},
+		resetRepo:    &tenantResetRepo{organizationIDs: make(chan int64, 10)},
+		throttleRepo: &memThrottleRepo{},
+		notifier:     make(chanNotifier, 10),
+		notifyWorker: newWorker(1, 10),
+		resetCfg:     &config.PasswordResetConfig{TokenTTL: time.Hour},
+		verifyCfg:    resendCfg(),
+	}
+
+	request := func(email, ip string) error {
+		ctx := clientip.NewContext(tenant.NewContext(context.Background(), model.DefaultOrganizationID), ip)
+		return s.RequestPasswordReset(ctx, email)
+	}
+	throttled := status.Code(errResendThrottled(time.Second))
+
+	tests := []struct {
+		name      string
+		email     string
+		ip        string
+		throttled bool
+	}{
+		{name: "first request", email: "alice@example.com", ip: "192.0.2.1"},
+		{name: "same email from other address", email: "Alice@Example.com", ip: "192.0.2.2", throttled: true},
+		{name: "other email from same address", email: "bob@example.com", ip: "192.0.2.1", throttled: true},
+		{name: "other email from other address", email: "bob@example.com", ip: "192.0.2.3"},
+	}
+
+	for _, tt := range tests {
+		err := request(tt.email, tt.ip)
+		if tt.throttled && status.Code(err) != throttled || !tt.throttled && err != nil {
+			t.Fatalf("%s: err = %v, want throttled = %v", tt.name, err, tt.throttled)
+		}
+	}
+}
+
+// После сброса пароля прежние сессии и API-ключи не действуют
+func TestResetPasswordRevokesSessionsAndApiKeys(t *testing.T) {
+	hasher := password.NewBcryptHasher(4)
+	hash, err := hasher.Hash("old password")
+	if err != nil {
+		t.Fatal(err)
+	}
+	breachChecker, err := password.LoadBreachChecker("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	raw, tokenHash, err := token.Generate("")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sessions := &memSessionRepo{}
+	apiKeys := &memApiKeyRepo{}
+	s := &service{
+		userRepo:       &memUserRepo{users: []*model.User{{Username: "alice", Email: "alice@example.com", Password: hash}}},
+		resetRepo:      &memResetRepo{tokens: map[string]string{tokenHash: "alice"}},
+		sessionRepo:    sessions,
+		apiKeyRepo:     apiKeys,
+		throttleRepo:   &memThrottleRepo{},
+		eventRepo:      &memEventRepo{},
+		hasher:         hasher,
+		breachChecker:  breachChecker,
+		passwordPolicy: &model.PasswordPolicy{MinLength: 8, MaxLength: 72},
+	}
+
+	ctx := context.Background()
+	if _, err = sessions.Create(ctx, "alice", "session", false, time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	for _, username := range []string{"alice", "alice", "bob"} {
+		if _, err = apiKeys.Create(ctx, &model.ApiKey{Username: username}, ""); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err = s.ResetPassword(ctx, raw, "new password"); err != nil {
+		t.Fatalf("ResetPassword() err = %v", err)
+	}
+
+	if _, err = sessions.Get(ctx, "session"); err != repo.ErrRecordNotFound {
+		t.Fatalf("session not revoked: err = %v", err)
+	}
+	if count, _ := apiKeys.CountActive(ctx, "alice"); count != 0 {
+		t.Fatalf("alice has %d active api keys after reset, want 0", count)
+	}
+	if count, _ := apiKeys.CountActive(ctx, "bob"); count != 1 {
+		t.Fatalf("bob has %d active api keys, want 1", count)
+	}
+}
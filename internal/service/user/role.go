@@ -0,0 +1,265 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"regexp"
+	"time"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/validator"
+)
+
+var roleNamePattern = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+var roleNameRules = []validator.Rule[string]{
+	validator.Required(),
+	validator.Length(2, 32),
+	validator.Match(roleNamePattern, "Допустимы строчные латинские буквы, цифры и символы _ -, начиная с буквы"),
+}
+
+func (s *service) CreateRole(ctx context.Context, name string) (*model.Role, error) {
+	if err := validator.Validate(validator.Field("name", &name, roleNameRules...)); err != nil {
+		return nil, err
+	}
+
+	role, err := s.roleRepo.Create(ctx, name)
+	if err != nil {
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			return nil, errRoleAlreadyExists
+		}
+		return nil, err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventRoleCreated,
+		Subject: role.Name,
+	})
+
+	return role, nil
+}
+
+func (s *service) ListRoles(ctx context.Context) ([]*model.Role, error) {
+	return s.roleRepo.List(ctx)
+}
+
+// RenameRole меняет имя роли. Назначения ролей хранят id и не меняются
+func (s *service) RenameRole(ctx context.Context, name, newName string) error {
+	if err := validator.Validate(validator.Field("new_name", &newName, roleNameRules...)); err != nil {
+		return err
+	}
+
+	role, err := s.getRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return errRoleBuiltIn
+	}
+
+	if err = s.roleRepo.Rename(ctx, role.Name, newName); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrRecordNotFound):
+			return errRoleNotFound
+		case errors.Is(err, repo.ErrAlreadyExists):
+			return errRoleAlreadyExists
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventRoleRenamed,
+		Subject: newName,
+		Payload: map[string]interface{}{"old_name": role.Name},
+	})
+
+	return nil
+}
+
+// DeleteRole удаляет роль, если она не назначена ни одному пользователю
+func (s *service) DeleteRole(ctx context.Context, name string) error {
+	role, err := s.getRole(ctx, name)
+	if err != nil {
+		return err
+	}
+	if role.BuiltIn {
+		return errRoleBuiltIn
+	}
+
+	if err = s.roleRepo.Delete(ctx, role.Name); err != nil {
+		switch {
+		case errors.Is(err, repo.ErrRecordNotFound):
+			return errRoleNotFound
+		case errors.Is(err, repo.ErrInUse):
+			return errRoleInUse
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventRoleDeleted,
+		Subject: role.Name,
+	})
+
+	return nil
+}
+
+// AssignRole добавляет роль к уже назначенным пользователю, возможно на ограниченный срок.
+// Назначить можно только роль, все разрешения которой есть у вызывающего
+func (s *service) AssignRole(ctx context.Context, username, roleName string, grant *model.RoleGrant) error {
+	if grant.ValidUntil != nil {
+		if !grant.ValidUntil.After(time.Now()) || (grant.ValidFrom != nil && !grant.ValidUntil.After(*grant.ValidFrom)) {
+			return errInvalidRoleGrantPeriod
+		}
+	}
+
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.getRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	if err = s.checkCanGrantRole(ctx, role.ID); err != nil {
+		return err
+	}
+
+	err = s.roleRepo.Assign(ctx, &model.RoleGrant{
+		Username:   user.Username,
+		Role:       *role,
+		ValidFrom:  grant.ValidFrom,
+		ValidUntil: grant.ValidUntil,
+		Reason:     grant.Reason,
+	})
+	if err != nil {
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			return errRoleAlreadyAssigned
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventRoleAssigned,
+		Subject: user.Username,
+		Payload: roleGrantPayload(role.Name, grant),
+	})
+
+	return nil
+}
+
+func (s *service) UnassignRole(ctx context.Context, username, roleName string) error {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	role, err := s.getRole(ctx, roleName)
+	if err != nil {
+		return err
+	}
+
+	if err = s.roleRepo.Unassign(ctx, user.Username, role.ID); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errRoleNotAssigned
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventRoleUnassigned,
+		Subject: user.Username,
+		Payload: map[string]interface{}{"role": role.Name},
+	})
+
+	return nil
+}
+
+// ExpireRoleGrants удаляет истёкшие назначения ролей и сохраняет событие
+// для каждого из них. Возвращает число удалённых назначений
+func (s *service) ExpireRoleGrants(ctx context.Context) (int, error) {
+	grants, err := s.roleRepo.DeleteExpired(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, grant := range grants {
+		s.publishEvent(ctx, &model.Event{
+			Type:    model.EventRoleExpired,
+			Subject: grant.Username,
+			Payload: roleGrantPayload(grant.Role.Name, grant),
+		})
+	}
+
+	return len(grants), nil
+}
+
+func roleGrantPayload(roleName string, grant *model.RoleGrant) map[string]interface{} {
+	payload := map[string]interface{}{"role": roleName}
+	if grant.ValidFrom != nil {
+		payload["valid_from"] = grant.ValidFrom.UTC().Format(time.RFC3339)
+	}
+	if grant.ValidUntil != nil {
+		payload["valid_until"] = grant.ValidUntil.UTC().Format(time.RFC3339)
+	}
+	if grant.Reason != "" {
+		payload["reason"] = grant.Reason
+	}
+
+	return payload
+}
+
+// checkCanGrantRole запрещает выдавать роль, у которой есть разрешения, отсутствующие
+// у вызывающего. Иначе держатель roles.assign мог бы назначить кому угодно, в том числе
+// себе, роль admin
+func (s *service) checkCanGrantRole(ctx context.Context, role model.UserRole) error {
+	permissions, err := s.permissionRepo.ListByRoles(ctx, role)
+	if err != nil {
+		return err
+	}
+
+	principal := auth.FromContext(ctx)
+	for _, permission := range permissions {
+		if !principal.Can(permission) {
+			return errRoleAssignmentNotAllowed
+		}
+	}
+
+	return nil
+}
+
+func (s *service) getRole(ctx context.Context, name string) (*model.Role, error) {
+	role, err := s.roleRepo.GetByName(ctx, name)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errRoleNotFound
+		}
+		return nil, err
+	}
+
+	return role, nil
+}
+
+// resolveRole возвращает id роли по имени, если оно указано,
+// иначе проверяет, что роль с указанным id существует
+func (s *service) resolveRole(ctx context.Context, id model.UserRole, name string) (model.UserRole, error) {
+	var role *model.Role
+	var err error
+	if name != "" {
+		role, err = s.roleRepo.GetByName(ctx, name)
+	} else {
+		role, err = s.roleRepo.Get(ctx, id)
+	}
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return 0, errInvalidUserRole
+		}
+		return 0, err
+	}
+
+	return role.ID, nil
+}
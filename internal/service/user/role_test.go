@@ -0,0 +1,97 @@
+package user
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Slintox/user-service/internal/auth"
+	"github.com/Slintox/user-service/internal/model"
+)
+
+const supportRole model.UserRole = 3
+
+func newRoleService() (*service, *memRoleRepo, *memGroupRepo) {
+	roles := &memRoleRepo{roles: []*model.Role{
+		{ID: model.UserRoleUser, Name: "user", BuiltIn: true},
+		{ID: model.UserRoleAdmin, Name: "admin", BuiltIn: true},
+		{ID: supportRole, Name: "support"},
+	}}
+	groups := &memGroupRepo{groups: []*model.Group{{ID: 1, Name: "staff"}}}
+
+	return &service{
+		userRepo: &memUserRepo{users: []*model.User{
+			{Username: "alice", Roles: []model.Role{{ID: supportRole, Name: "support"}}},
+			{Username: "bob"},
+		}},
+		roleRepo:  roles,
+		groupRepo: groups,
+		permissionRepo: &memPermissionRepo{byRole: map[model.UserRole][]string{
+			model.UserRoleUser: {model.PermissionReadUsers},
+			model.UserRoleAdmin: {
+				model.PermissionReadUsers,
+				model.PermissionDeleteUsers,
+				model.PermissionAssignRoles,
+				model.PermissionSetPassword,
+			},
+			supportRole: {model.PermissionReadUsers, model.PermissionAssignRoles},
+		}},
+		eventRepo: &memEventRepo{},
+	}, roles, groups
+}
+
+// Держатель roles.assign не может выдать роль с разрешениями, которых нет у него самого
+func TestAssignRoleRequiresGrantedPermissions(t *testing.T) {
+	support := &auth.Principal{
+		OrganizationID: model.DefaultOrganizationID,
+		Username:       "alice",
+		Permissions:    map[string]bool{model.PermissionReadUsers: true, model.PermissionAssignRoles: true},
+	}
+
+	tests := []struct {
+		name     string
+		username string
+		role     string
+		want     error
+	}{
+		{name: "role within own permissions", username: "bob", role: "user"},
+		{name: "same role", username: "bob", role: "support"},
+		{name: "admin to other user", username: "bob", role: "admin", want: errRoleAssignmentNotAllowed},
+		{name: "admin to self", username: "alice", role: "admin", want: errRoleAssignmentNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, roles, _ := newRoleService()
+			ctx := auth.NewContext(context.Background(), support)
+
+			err := s.AssignRole(ctx, tt.username, tt.role, &model.RoleGrant{})
+			if err != tt.want {
+				t.Fatalf("AssignRole() err = %v, want %v", err, tt.want)
+			}
+			if assigned := len(roles.grants) > 0; assigned != (tt.want == nil) {
+				t.Fatalf("role assigned = %v", assigned)
+			}
+		})
+	}
+}
+
+func TestAssignGroupRoleRequiresGrantedPermissions(t *testing.T) {
+	support := &auth.Principal{
+		OrganizationID: model.DefaultOrganizationID,
+		Username:       "alice",
+		Permissions:    map[string]bool{model.PermissionReadUsers: true, model.PermissionAssignRoles: true},
+	}
+
+	s, _, groups := newRoleService()
+	ctx := auth.NewContext(context.Background(), support)
+
+	if err := s.AssignGroupRole(ctx, "staff", "admin"); err != errRoleAssignmentNotAllowed {
+		t.Fatalf("AssignGroupRole(admin) err = %v, want %v", err, errRoleAssignmentNotAllowed)
+	}
+	if err := s.AssignGroupRole(ctx, "staff", "support"); err != nil {
+		t.Fatalf("AssignGroupRole(support) err = %v", err)
+	}
+	if roles := groups.roles[1]; len(roles) != 1 || roles[0] != supportRole {
+		t.Fatalf("group roles = %v, want [%d]", roles, supportRole)
+	}
+}
@@ -0,0 +1,174 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	repo "github.com/Slintox/user-service/internal/repository"
+	throttleRepo "github.com/Slintox/user-service/internal/repository/throttle"
+)
+
+// Субъекты учёта неудачных попыток входа
+const (
+	userSubjectPrefix = "user:"
+	ipSubjectPrefix   = "ip:"
+)
+
+func userSubject(username string) string {
+	return userSubjectPrefix + normalize.Username(username)
+}
+
+func ipSubject(ip string) string {
+	return ipSubjectPrefix + ip
+}
+
+// loginAttempt попытка входа, заранее учтённая как неудачная
+type loginAttempt struct {
+	username string
+	ip       string
+	// Учтённые попытки пользователя и IP-адреса
+	reservations []throttleRepo.Reservation
+	// Попытка оказалась неудачной: неверный пароль, код или подпись
+	failed bool
+}
+
+// reserveLoginAttempt запрещает попытку входа, пока пользователь или IP-адрес заблокированы,
+// и в той же транзакции учитывает её как неудачную. Иначе параллельные попытки успевали бы
+// пройти проверку до того, как учтена первая неудача. Попытку завершает finishLoginAttempt.
+// Имя учитывается, даже если такого пользователя нет, чтобы блокировка не выдавала наличие имени
+func (s *service) reserveLoginAttempt(ctx context.Context, username, ip string) (*loginAttempt, error) {
+	limits := []throttleRepo.Limit{s.loginLimit(userSubject(username), s.loginCfg.LockThreshold)}
+	if ip != "" {
+		limits = append(limits, s.loginLimit(ipSubject(ip), s.loginCfg.IPLockThreshold))
+	}
+
+	reservations, blockedFor, err := s.throttleRepo.Reserve(ctx, limits...)
+	if err != nil {
+		return nil, err
+	}
+
+	if blockedFor > 0 {
+		return nil, errLoginThrottled(blockedFor)
+	}
+
+	return &loginAttempt{
+		username:     username,
+		ip:           ip,
+		reservations: reservations,
+	}, nil
+}
+
+// loginLimit задержка после неудач и блокировка после lockThreshold неудач подряд
+func (s *service) loginLimit(subject string, lockThreshold int) throttleRepo.Limit {
+	return throttleRepo.Limit{
+		Subject: subject,
+		Window:  s.loginCfg.FailureWindow,
+		Delay: func(failures int) time.Duration {
+			if failures >= lockThreshold {
+				return s.loginCfg.LockDuration
+			}
+			return s.loginDelay(failures)
+		},
+	}
+}
+
+// finishLoginAttempt завершает попытку. Неудача уже учтена, о ней остаётся сообщить,
+// если она заблокировала пользователя или IP-адрес. Попытку, которая не оказалась
+// неудачной, снимает со счётчиков вместе с выставленной заранее блокировкой,
+// чтобы успешные входы не задерживали и не блокировали IP-адрес
+func (s *service) finishLoginAttempt(ctx context.Context, attempt *loginAttempt) {
+	if !attempt.failed {
+		if err := s.throttleRepo.Release(ctx, attempt.reservations...); err != nil {
+			log.Printf("user.finishLoginAttempt: %s", err.Error())
+		}
+		return
+	}
+
+	s.publishLock(ctx, attempt.reservations[0].Failures, s.loginCfg.LockThreshold, &model.Event{
+		Type:    model.EventUserLocked,
+		Subject: attempt.username,
+	})
+
+	if attempt.ip != "" {
+		s.publishLock(ctx, attempt.reservations[1].Failures, s.loginCfg.IPLockThreshold, &model.Event{
+			Type:    model.EventIPBlocked,
+			Subject: attempt.ip,
+		})
+	}
+}
+
+// publishLock сообщает о блокировке, если неудач набралось lockThreshold
+func (s *service) publishLock(ctx context.Context, failures, lockThreshold int, lockEvent *model.Event) {
+	if failures < lockThreshold {
+		return
+	}
+
+	lockEvent.Payload = map[string]interface{}{
+		"failures":      failures,
+		"blocked_until": time.Now().Add(s.loginCfg.LockDuration).UTC().Format(time.RFC3339),
+	}
+	s.publishEvent(ctx, lockEvent)
+}
+
+// loginDelay возвращает задержку после failures неудач подряд:
+// 0 для первых FreeAttempts, затем BaseDelay, удваиваясь до MaxDelay
+func (s *service) loginDelay(failures int) time.Duration {
+	exceeded := failures - s.loginCfg.FreeAttempts
+	if exceeded <= 0 {
+		return 0
+	}
+
+	delay := s.loginCfg.BaseDelay
+	for i := 1; i < exceeded && delay < s.loginCfg.MaxDelay; i++ {
+		delay *= 2
+	}
+
+	if delay > s.loginCfg.MaxDelay {
+		return s.loginCfg.MaxDelay
+	}
+
+	return delay
+}
+
+func (s *service) resetLoginFailures(ctx context.Context, username string) {
+	if _, err := s.throttleRepo.Reset(ctx, userSubject(username)); err != nil {
+		log.Printf("user.resetLoginFailures: %s", err.Error())
+	}
+}
+
+func (s *service) UnlockUser(ctx context.Context, username string) error {
+	user, err := s.userRepo.Get(ctx, username)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errUserNotFound
+		}
+		return err
+	}
+
+	unlocked, err := s.throttleRepo.Reset(ctx, userSubject(user.Username))
+	if err != nil {
+		return err
+	}
+
+	if unlocked {
+		s.publishEvent(ctx, &model.Event{
+			Type:    model.EventUserUnlocked,
+			Subject: user.Username,
+		})
+	}
+
+	return nil
+}
+
+func (s *service) publishEvent(ctx context.Context, event *model.Event) {
+	if err := s.eventRepo.Add(ctx, event); err != nil {
+		log.Printf("user.publishEvent: failed to store %s event: %s", event.Type, err.Error())
+		return
+	}
+
+	log.Printf("event %s: %s", event.Type, event.Subject)
+}
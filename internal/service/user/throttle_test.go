@@ -0,0 +1,144 @@
+package user
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/status"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/clientip"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/password"
+)
+
+func newThrottleService(t *testing.T) (*service, *memThrottleRepo, *memEventRepo) {
+	t.Helper()
+
+	hasher := password.NewBcryptHasher(4)
+	hash, err := hasher.Hash("right password")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	throttle := &memThrottleRepo{}
+	events := &memEventRepo{}
+
+	return &service{
+		userRepo:     &memUserRepo{users: []*model.User{{Username: "alice", Password: hash}}},
+		throttleRepo: throttle,
+		eventRepo:    events,
+		hasher:       hasher,
+		dummyHash:    hash,
+		loginCfg: &config.LoginThrottleConfig{
+			FreeAttempts:    100,
+			LockThreshold:   3,
+			IPLockThreshold: 100,
+			LockDuration:    time.Hour,
+			FailureWindow:   time.Hour,
+		},
+	}, throttle, events
+}
+
+// Параллельные попытки не должны успевать пройти проверку до учёта неудач
+func TestConcurrentLoginFailuresCannotExceedLockThreshold(t *testing.T) {
+	s, _, events := newThrottleService(t)
+	ctx := clientip.NewContext(context.Background(), "192.0.2.1")
+
+	const attempts = 10
+	errs := make(chan error, attempts)
+
+	var wg sync.WaitGroup
+	for i := 0; i < attempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := s.Login(ctx, &model.Credentials{Username: "alice", Password: "wrong password"})
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	invalid, throttled := 0, 0
+	for err := range errs {
+		switch {
+		case err == errInvalidCredentials:
+			invalid++
+		case status.Code(err) == status.Code(errLoginThrottled(time.Second)):
+			throttled++
+		default:
+			t.Fatalf("unexpected error: %v", err)
+		}
+	}
+
+	if invalid != s.loginCfg.LockThreshold || throttled != attempts-s.loginCfg.LockThreshold {
+		t.Fatalf("invalid = %d, throttled = %d, want %d and %d", invalid, throttled, s.loginCfg.LockThreshold, attempts-s.loginCfg.LockThreshold)
+	}
+
+	locked := 0
+	for _, event := range events.events {
+		if event.Type == model.EventUserLocked {
+			locked++
+		}
+	}
+	if locked != 1 {
+		t.Fatalf("got %d lock events, want 1", locked)
+	}
+}
+
+func TestLoginAttemptReleasedUnlessFailed(t *testing.T) {
+	s, throttle, _ := newThrottleService(t)
+	ctx := context.Background()
+
+	attempt, err := s.reserveLoginAttempt(ctx, "alice", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.finishLoginAttempt(ctx, attempt)
+
+	for _, subject := range []string{userSubject("alice"), ipSubject("192.0.2.1")} {
+		if failures := throttle.failures[subject]; failures != 0 {
+			t.Fatalf("%s: failures = %d after released attempt, want 0", subject, failures)
+		}
+	}
+
+	attempt, err = s.reserveLoginAttempt(ctx, "alice", "192.0.2.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	attempt.failed = true
+	s.finishLoginAttempt(ctx, attempt)
+
+	if failures := throttle.failures[userSubject("alice")]; failures != 1 {
+		t.Fatalf("failures = %d after failed attempt, want 1", failures)
+	}
+}
+
+// Успешные входы не должны оставлять задержку, выставленную на случай неудачи
+func TestSuccessfulLoginsNeverBlockIP(t *testing.T) {
+	s, _, _ := newThrottleService(t)
+	s.loginCfg.FreeAttempts = 2
+	s.loginCfg.BaseDelay = time.Minute
+	s.loginCfg.MaxDelay = time.Hour
+	s.loginCfg.IPLockThreshold = 5
+	ctx := clientip.NewContext(context.Background(), "192.0.2.1")
+
+	// Неудачи с IP-адреса исчерпывают бесплатные попытки: ещё одна неудача даст задержку
+	for i := 0; i < s.loginCfg.FreeAttempts; i++ {
+		if _, _, err := s.Login(ctx, &model.Credentials{Username: "bob", Password: "wrong password"}); err != errInvalidCredentials {
+			t.Fatalf("Login() err = %v, want %v", err, errInvalidCredentials)
+		}
+	}
+
+	// Успешный вход: попытка не оказалась неудачной
+	for i := 0; i < 2*s.loginCfg.IPLockThreshold; i++ {
+		attempt, err := s.reserveLoginAttempt(ctx, "alice", "192.0.2.1")
+		if err != nil {
+			t.Fatalf("login %d: err = %v", i+1, err)
+		}
+		s.finishLoginAttempt(ctx, attempt)
+	}
+}
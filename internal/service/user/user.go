@@ -3,33 +3,231 @@ package user
 import (
 	"context"
 	"errors"
+	"log"
 
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/auth"
 	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	"github.com/Slintox/user-service/internal/notifier"
+	"github.com/Slintox/user-service/internal/password"
+	"github.com/Slintox/user-service/internal/policy"
 	repo "github.com/Slintox/user-service/internal/repository"
+	apiKeyRepo "github.com/Slintox/user-service/internal/repository/apikey"
+	emailChangeRepo "github.com/Slintox/user-service/internal/repository/emailchange"
+	eventRepo "github.com/Slintox/user-service/internal/repository/event"
+	groupRepo "github.com/Slintox/user-service/internal/repository/group"
+	mfaRepo "github.com/Slintox/user-service/internal/repository/mfa"
+	organizationRepo "github.com/Slintox/user-service/internal/repository/organization"
+	permissionRepo "github.com/Slintox/user-service/internal/repository/permission"
+	resetRepo "github.com/Slintox/user-service/internal/repository/reset"
+	roleRepo "github.com/Slintox/user-service/internal/repository/role"
+	sessionRepo "github.com/Slintox/user-service/internal/repository/session"
+	throttleRepo "github.com/Slintox/user-service/internal/repository/throttle"
 	uRepo "github.com/Slintox/user-service/internal/repository/user"
+	webAuthnRepo "github.com/Slintox/user-service/internal/repository/webauthn"
+	"github.com/Slintox/user-service/internal/token"
+	"github.com/Slintox/user-service/internal/webauthn"
 )
 
 type service struct {
-	userRepo uRepo.Repository
+	userRepo         uRepo.Repository
+	throttleRepo     throttleRepo.Repository
+	eventRepo        eventRepo.Repository
+	sessionRepo      sessionRepo.Repository
+	resetRepo        resetRepo.Repository
+	emailChangeRepo  emailChangeRepo.Repository
+	mfaRepo          mfaRepo.Repository
+	webAuthnRepo     webAuthnRepo.Repository
+	apiKeyRepo       apiKeyRepo.Repository
+	roleRepo         roleRepo.Repository
+	permissionRepo   permissionRepo.Repository
+	organizationRepo organizationRepo.Repository
+	groupRepo        groupRepo.Repository
+
+	passwordPolicy *model.PasswordPolicy
+	breachChecker  password.BreachChecker
+	hasher         password.Hasher
+	notifier       notifier.Notifier
+	signer         *token.Signer
+	relyingParty   *webauthn.RelyingParty
+	policies       *policy.Evaluator
+
+	loginCfg       *config.LoginThrottleConfig
+	sessionCfg     *config.SessionConfig
+	resetCfg       *config.PasswordResetConfig
+	verifyCfg      *config.EmailVerificationConfig
+	emailChangeCfg *config.EmailChangeConfig
+	mfaCfg         *config.MfaConfig
+	webAuthnCfg    *config.WebAuthnConfig
+	apiKeyCfg      *config.ApiKeyConfig
+
+	// Отправляет письма в фоне
+	notifyWorker *worker
+
+	// Хеш, с которым сверяется пароль несуществующего пользователя,
+	// чтобы время ответа не выдавало наличие имени
+	dummyHash string
+}
+
+// Deps описывает зависимости сервиса пользователей
+type Deps struct {
+	UserRepo         uRepo.Repository
+	ThrottleRepo     throttleRepo.Repository
+	EventRepo        eventRepo.Repository
+	SessionRepo      sessionRepo.Repository
+	ResetRepo        resetRepo.Repository
+	EmailChangeRepo  emailChangeRepo.Repository
+	MfaRepo          mfaRepo.Repository
+	WebAuthnRepo     webAuthnRepo.Repository
+	ApiKeyRepo       apiKeyRepo.Repository
+	RoleRepo         roleRepo.Repository
+	PermissionRepo   permissionRepo.Repository
+	OrganizationRepo organizationRepo.Repository
+	GroupRepo        groupRepo.Repository
+
+	PasswordPolicy *model.PasswordPolicy
+	BreachChecker  password.BreachChecker
+	Hasher         password.Hasher
+	Notifier       notifier.Notifier
+	Signer         *token.Signer
+	RelyingParty   *webauthn.RelyingParty
+	Policies       *policy.Evaluator
+
+	LoginCfg       *config.LoginThrottleConfig
+	SessionCfg     *config.SessionConfig
+	ResetCfg       *config.PasswordResetConfig
+	VerifyCfg      *config.EmailVerificationConfig
+	EmailChangeCfg *config.EmailChangeConfig
+	MfaCfg         *config.MfaConfig
+	WebAuthnCfg    *config.WebAuthnConfig
+	ApiKeyCfg      *config.ApiKeyConfig
 }
 
-func NewService(userRepo uRepo.Repository) Service {
+func NewService(deps Deps) Service {
+	dummyHash, err := deps.Hasher.Hash("dummy-password")
+	if err != nil {
+		log.Printf("user.NewService: failed to hash dummy password: %s", err.Error())
+	}
+
 	return &service{
-		userRepo: userRepo,
+		userRepo:         deps.UserRepo,
+		throttleRepo:     deps.ThrottleRepo,
+		eventRepo:        deps.EventRepo,
+		sessionRepo:      deps.SessionRepo,
+		resetRepo:        deps.ResetRepo,
+		emailChangeRepo:  deps.EmailChangeRepo,
+		mfaRepo:          deps.MfaRepo,
+		webAuthnRepo:     deps.WebAuthnRepo,
+		apiKeyRepo:       deps.ApiKeyRepo,
+		roleRepo:         deps.RoleRepo,
+		permissionRepo:   deps.PermissionRepo,
+		organizationRepo: deps.OrganizationRepo,
+		groupRepo:        deps.GroupRepo,
+		passwordPolicy:   deps.PasswordPolicy,
+		breachChecker:    deps.BreachChecker,
+		hasher:           deps.Hasher,
+		notifier:         deps.Notifier,
+		signer:           deps.Signer,
+		relyingParty:     deps.RelyingParty,
+		policies:         deps.Policies,
+		loginCfg:         deps.LoginCfg,
+		sessionCfg:       deps.SessionCfg,
+		resetCfg:         deps.ResetCfg,
+		verifyCfg:        deps.VerifyCfg,
+		emailChangeCfg:   deps.EmailChangeCfg,
+		mfaCfg:           deps.MfaCfg,
+		webAuthnCfg:      deps.WebAuthnCfg,
+		apiKeyCfg:        deps.ApiKeyCfg,
+		notifyWorker:     newWorker(notifyWorkers, notifyQueueSize),
+		dummyHash:        dummyHash,
 	}
 }
 
 type Service interface {
 	Create(ctx context.Context, user *model.CreateUser) error
 	Get(ctx context.Context, username string) (*model.User, error)
+	GetByEmail(ctx context.Context, email string) (*model.User, error)
 	Update(ctx context.Context, username string, updateData *model.UpdateUser) error
-	Delete(ctx context.Context, username string) error
+	Delete(ctx context.Context, username string, deleteData *model.DeleteUser) (*model.User, error)
+	GetPasswordPolicy(ctx context.Context) *model.PasswordPolicy
+	Login(ctx context.Context, credentials *model.Credentials) (*model.User, *model.Session, error)
+	GetPasswordHashStats(ctx context.Context) (map[string]int64, error)
+	UnlockUser(ctx context.Context, username string) error
+	RequestPasswordReset(ctx context.Context, email string) error
+	ResetPassword(ctx context.Context, token, newPassword string) error
+	ChangePassword(ctx context.Context, username string, changeData *model.ChangePassword) error
+	VerifyEmail(ctx context.Context, token string) error
+	ResendEmailVerification(ctx context.Context, username string) error
+	ConfirmEmailChange(ctx context.Context, token string) error
+	CancelEmailChange(ctx context.Context, token string) error
+	EnrollMfa(ctx context.Context, username string) (*model.MfaEnrollment, error)
+	ConfirmMfa(ctx context.Context, username, code string) ([]string, error)
+	DisableMfa(ctx context.Context, username string) error
+	GetMfaPolicies(ctx context.Context) ([]*model.MfaRolePolicy, error)
+	SetMfaPolicy(ctx context.Context, policy *model.MfaRolePolicy) error
+	BeginWebAuthnRegistration(ctx context.Context, username string) ([]byte, error)
+	FinishWebAuthnRegistration(ctx context.Context, username string, registration *model.WebAuthnRegistration) (*model.WebAuthnCredential, error)
+	BeginWebAuthnLogin(ctx context.Context, username string) ([]byte, error)
+	FinishWebAuthnLogin(ctx context.Context, assertion *model.WebAuthnAssertion) (*model.User, *model.Session, error)
+	ListWebAuthnCredentials(ctx context.Context, username string) ([]*model.WebAuthnCredential, error)
+	DeleteWebAuthnCredential(ctx context.Context, username string, credentialID []byte) error
+	CreateApiKey(ctx context.Context, username string, create *model.CreateApiKey) (*model.ApiKey, error)
+	ListApiKeys(ctx context.Context, username string) ([]*model.ApiKey, error)
+	RevokeApiKey(ctx context.Context, username string, id int64) error
+	AuthenticateApiKey(ctx context.Context, raw string) (*model.ApiKey, error)
+	Authenticate(ctx context.Context, raw string) (*auth.Principal, error)
+	CreateRole(ctx context.Context, name string) (*model.Role, error)
+	ListRoles(ctx context.Context) ([]*model.Role, error)
+	RenameRole(ctx context.Context, name, newName string) error
+	DeleteRole(ctx context.Context, name string) error
+	AssignRole(ctx context.Context, username, roleName string, grant *model.RoleGrant) error
+	UnassignRole(ctx context.Context, username, roleName string) error
+	ExpireRoleGrants(ctx context.Context) (int, error)
+	ListPermissions(ctx context.Context, roleName string) ([]*model.Permission, error)
+	GrantPermission(ctx context.Context, roleName, permission string) error
+	RevokePermission(ctx context.Context, roleName, permission string) error
+	CheckPermission(ctx context.Context, username, permission string) (bool, error)
+	CreateOrganization(ctx context.Context, name string, admin *model.CreateUser) (*model.Organization, error)
+	ListOrganizations(ctx context.Context) ([]*model.Organization, error)
+	ResolveOrganization(ctx context.Context, name string) (int64, error)
+	CreateGroup(ctx context.Context, name string) (*model.Group, error)
+	GetGroup(ctx context.Context, name string) (*model.Group, error)
+	ListGroups(ctx context.Context) ([]*model.Group, error)
+	RenameGroup(ctx context.Context, name, newName string) error
+	DeleteGroup(ctx context.Context, name string) error
+	AddGroupMember(ctx context.Context, groupName string, member *model.GroupMember) error
+	RemoveGroupMember(ctx context.Context, groupName string, member *model.GroupMember) error
+	ListGroupMembers(ctx context.Context, groupName string, effective bool) (*model.GroupMembers, error)
+	ListUserGroups(ctx context.Context, username string) ([]*model.GroupMembership, error)
+	AssignGroupRole(ctx context.Context, groupName, roleName string) error
+	UnassignGroupRole(ctx context.Context, groupName, roleName string) error
+	DryRunPolicy(ctx context.Context, dryRun *model.PolicyDryRun) (*model.PolicyResult, error)
 }
 
 func (s *service) Create(ctx context.Context, user *model.CreateUser) error {
-	// Проверка на правильность пароля
-	if user.Password != user.ConfirmPassword {
-		return errInvalidUserPasswordConfirm
+	// Проверка формата полей, включая совпадение пароля с подтверждением
+	if err := s.validateCreateUser(user); err != nil {
+		return err
+	}
+
+	if err := s.checkBreached(user.Password); err != nil {
+		return err
+	}
+
+	role, err := s.resolveRole(ctx, user.Role, user.RoleName)
+	if err != nil {
+		return err
+	}
+
+	// При регистрации без разрешения доступна только роль по умолчанию
+	if role != model.UserRoleUser {
+		if !auth.FromContext(ctx).Can(model.PermissionAssignRoles) {
+			return errRoleAssignmentNotAllowed
+		}
+		if err = s.checkCanGrantRole(ctx, role); err != nil {
+			return err
+		}
 	}
 
 	// Проверка на доступность username
@@ -41,14 +239,37 @@ func (s *service) Create(ctx context.Context, user *model.CreateUser) error {
 		return errUsernameIsAlreadyUsed
 	}
 
+	// Проверка на доступность email
+	isEmailAvailable, err := s.userRepo.IsEmailAvailable(ctx, user.Email)
+	if err != nil {
+		return err
+	}
+	if !isEmailAvailable {
+		return errEmailIsAlreadyUsed
+	}
+
+	// Пароль хранится только в виде хеша
+	hash, err := s.hasher.Hash(user.Password)
+	if err != nil {
+		return err
+	}
+
+	hashedUser := *user
+	hashedUser.Password = hash
+	hashedUser.ConfirmPassword = ""
+	hashedUser.Role = role
+
 	// Сохранение нового пользователя
-	if err = s.userRepo.Add(ctx, user); err != nil {
+	// Проверки выше не защищают от параллельной регистрации тех же имени или адреса
+	if err = s.userRepo.Add(ctx, &hashedUser); err != nil {
 		if errors.Is(err, repo.ErrRecordNotFound) {
 			return errInvalidUserRole
 		}
-		return err
+		return mapUniqueError(err)
 	}
 
+	s.sendEmailVerification(ctx, user.Username, user.Email)
+
 	return nil
 }
 
@@ -64,9 +285,90 @@ func (s *service) Get(ctx context.Context, username string) (*model.User, error)
 	return user, nil
 }
 
+func (s *service) GetByEmail(ctx context.Context, email string) (*model.User, error) {
+	user, err := s.userRepo.GetByEmail(ctx, email)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, errUserNotFound
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
 func (s *service) Update(ctx context.Context, username string, updateData *model.UpdateUser) error {
-	// Проверка на возможность обновления username
-	if updateData.Username != nil {
+	// Без текущего пароля пароль может задать только администратор с разрешением,
+	// пользователи меняют его через ChangePassword
+	if updateData.Password != nil && !auth.FromContext(ctx).Can(model.PermissionSetPassword) {
+		return errPasswordChangeNotAllowed
+	}
+
+	// Для проверки нового пароля по политике нужны текущие имя и email,
+	// а для подтверждения нового email - прежний адрес
+	var current *model.User
+	if updateData.Password != nil || updateData.Email != nil {
+		var err error
+		current, err = s.Get(ctx, username)
+		if err != nil {
+			return err
+		}
+	}
+
+	if err := s.validateUpdateUser(updateData, current); err != nil {
+		return err
+	}
+
+	if updateData.Role != nil || updateData.RoleName != nil {
+		if !auth.FromContext(ctx).Can(model.PermissionAssignRoles) {
+			return errRoleAssignmentNotAllowed
+		}
+
+		var id model.UserRole
+		if updateData.Role != nil {
+			id = *updateData.Role
+		}
+		var name string
+		if updateData.RoleName != nil {
+			name = *updateData.RoleName
+		}
+
+		role, err := s.resolveRole(ctx, id, name)
+		if err != nil {
+			return err
+		}
+		if err = s.checkCanGrantRole(ctx, role); err != nil {
+			return err
+		}
+
+		resolvedData := *updateData
+		resolvedData.Role = &role
+		resolvedData.RoleName = nil
+		updateData = &resolvedData
+	}
+
+	if updateData.Password != nil {
+		if err := s.checkBreached(*updateData.Password); err != nil {
+			return err
+		}
+
+		if err := s.checkPasswordReuse(ctx, current, *updateData.Password); err != nil {
+			return err
+		}
+
+		hash, err := s.hasher.Hash(*updateData.Password)
+		if err != nil {
+			return err
+		}
+
+		hashedData := *updateData
+		hashedData.Password = &hash
+		updateData = &hashedData
+	}
+
+	// Проверка на возможность обновления username.
+	// Смена только регистра или формы записи своего же имени разрешена
+	if updateData.Username != nil && normalize.Username(*updateData.Username) != normalize.Username(username) {
 		isUsernameAvailable, err := s.userRepo.IsUsernameAvailable(ctx, *updateData.Username)
 		if err != nil {
 			return err
@@ -77,22 +379,88 @@ func (s *service) Update(ctx context.Context, username string, updateData *model
 		}
 	}
 
+	// Email может принадлежать только одному пользователю
+	if updateData.Email != nil {
+		owner, err := s.userRepo.GetByEmail(ctx, *updateData.Email)
+		if err != nil && !errors.Is(err, repo.ErrRecordNotFound) {
+			return err
+		}
+
+		if owner != nil && normalize.Username(owner.Username) != normalize.Username(username) {
+			return errEmailIsAlreadyUsed
+		}
+	}
+
+	// Новый адрес применяется только после подтверждения, иначе получивший
+	// доступ к учётной записи мог бы сразу перехватить её через сброс пароля.
+	// Изменение только формы записи того же адреса применяется сразу
+	var pendingEmail *string
+	if updateData.Email != nil && normalize.Email(*updateData.Email) != normalize.Email(current.Email) {
+		pendingEmail = updateData.Email
+
+		withoutEmail := *updateData
+		withoutEmail.Email = nil
+		updateData = &withoutEmail
+	}
+
 	// Обновление пользователя
-	if err := s.userRepo.Update(ctx, username, updateData); err != nil {
-		if errors.Is(err, repo.ErrRecordNotFound) {
-			return errUserNotFound
+	if !isEmptyUpdate(updateData) {
+		if err := s.userRepo.Update(ctx, username, updateData); err != nil {
+			if errors.Is(err, repo.ErrRecordNotFound) {
+				return errUserNotFound
+			}
+			return mapUniqueError(err)
 		}
-		return err
+	}
+
+	if pendingEmail != nil {
+		newUsername := current.Username
+		if updateData.Username != nil {
+			newUsername = *updateData.Username
+		}
+
+		return s.requestEmailChange(ctx, newUsername, current.Email, *pendingEmail)
 	}
 
 	return nil
 }
 
-func (s *service) Delete(ctx context.Context, username string) error {
-	err := s.userRepo.Delete(ctx, username)
+// mapUniqueError переводит занятое имя или адрес из репозитория в ошибку клиенту
+func mapUniqueError(err error) error {
+	switch {
+	case errors.Is(err, repo.ErrUsernameTaken):
+		return errUsernameIsAlreadyUsed
+	case errors.Is(err, repo.ErrEmailTaken):
+		return errEmailIsAlreadyUsed
+	}
+
+	return err
+}
+
+func isEmptyUpdate(updateData *model.UpdateUser) bool {
+	return updateData.Username == nil && updateData.Email == nil && updateData.Password == nil && updateData.Role == nil
+}
+
+func (s *service) Delete(ctx context.Context, username string, deleteData *model.DeleteUser) (*model.User, error) {
+	user, err := s.userRepo.Delete(ctx, username, deleteData.ExpectedVersion)
 	if err != nil {
-		return err
+		switch {
+		case errors.Is(err, repo.ErrRecordNotFound):
+			// Согласно AIP-135 удаление отсутствующего пользователя
+			// с allow_missing считается успешным
+			if deleteData.AllowMissing {
+				return nil, nil
+			}
+			return nil, errUserNotFound
+		case errors.Is(err, repo.ErrVersionMismatch):
+			return nil, errUserVersionMismatch
+		}
+		return nil, err
 	}
 
-	return nil
+	return user, nil
+}
+
+func (s *service) GetPasswordPolicy(_ context.Context) *model.PasswordPolicy {
+	return s.passwordPolicy
 }
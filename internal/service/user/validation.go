@@ -0,0 +1,103 @@
+package user
+
+import (
+	"context"
+	"regexp"
+
+	"github.com/Slintox/user-service/internal/metrics"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	"github.com/Slintox/user-service/internal/password"
+	"github.com/Slintox/user-service/internal/validator"
+)
+
+var usernamePattern = regexp.MustCompile(`^[\p{L}\p{N}._-]+$`)
+
+var (
+	usernameRules = []validator.Rule[string]{
+		validator.Required(),
+		validator.Length(3, 32),
+		validator.Match(usernamePattern, "Допустимы только буквы, цифры и символы . _ -"),
+		singleScript,
+	}
+
+	emailRules = []validator.Rule[string]{
+		validator.Required(),
+		validator.Email(),
+	}
+)
+
+// singleScript запрещает имена, смешивающие буквы разных алфавитов
+func singleScript(username string) string {
+	if normalize.HasMixedScripts(username) {
+		return "Имя не должно смешивать буквы разных алфавитов"
+	}
+	return ""
+}
+
+func (s *service) validateCreateUser(user *model.CreateUser) error {
+	return validator.Validate(
+		validator.Field("username", &user.Username, usernameRules...),
+		validator.Field("email", &user.Email, emailRules...),
+		validator.Field("password", &user.Password, password.Rules(s.passwordPolicy, user.Username, user.Email)...),
+		validator.Field("confirm_password", &user.ConfirmPassword, validator.Equal(user.Password, "Пароли не совпадают")),
+	)
+}
+
+// validateUpdateUser проверяет обновляемые поля. current нужен для проверки
+// нового пароля на совпадение с именем и email и может быть nil, если пароль не меняется
+func (s *service) validateUpdateUser(user *model.UpdateUser, current *model.User) error {
+	var passwordRules []validator.Rule[string]
+	if user.Password != nil && current != nil {
+		username, email := current.Username, current.Email
+		if user.Username != nil {
+			username = *user.Username
+		}
+		if user.Email != nil {
+			email = *user.Email
+		}
+
+		passwordRules = password.Rules(s.passwordPolicy, username, email)
+	}
+
+	return validator.Validate(
+		validator.Field("username", user.Username, usernameRules...),
+		validator.Field("email", user.Email, emailRules...),
+		validator.Field("password", user.Password, passwordRules...),
+	)
+}
+
+// checkBreached отклоняет пароли, найденные в базе утечек
+func (s *service) checkBreached(password string) error {
+	breached, err := s.breachChecker.IsBreached(password)
+	if err != nil {
+		return err
+	}
+
+	if breached {
+		metrics.BreachedPasswordHits.Inc()
+		return errPasswordBreached
+	}
+
+	return nil
+}
+
+// checkPasswordReuse отклоняет текущий пароль и пароли из истории
+func (s *service) checkPasswordReuse(ctx context.Context, current *model.User, password string) error {
+	history, err := s.userRepo.GetPasswordHistory(ctx, current.Username, s.passwordPolicy.HistoryDepth)
+	if err != nil {
+		return err
+	}
+
+	for _, hash := range append([]string{current.Password}, history...) {
+		matches, err := s.hasher.Verify(hash, password)
+		if err != nil {
+			return err
+		}
+		if matches {
+			return errPasswordReused
+		}
+	}
+
+	return nil
+}
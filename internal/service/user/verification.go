@@ -0,0 +1,188 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"log"
+	"time"
+
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	"github.com/Slintox/user-service/internal/notifier"
+	repo "github.com/Slintox/user-service/internal/repository"
+	throttleRepo "github.com/Slintox/user-service/internal/repository/throttle"
+)
+
+// Назначения подписанных токенов. Токен одного назначения не принимается для другого
+const (
+	purposeEmailVerification = "email_verification"
+	purposeEmailChange       = "email_change"
+	purposeEmailChangeCancel = "email_change_cancel"
+)
+
+const verifyResendSubjectPrefix = "verify:"
+
+// Время на доставку уведомления, отправленного в фоне
+const notifyTimeout = time.Minute
+
+// emailClaims данные подписанного токена, выданного для адреса пользователя
+type emailClaims struct {
+	Purpose string `json:"purpose"`
+	// Организация пользователя: имена уникальны только в её пределах
+	OrganizationID int64  `json:"organization_id"`
+	Username       string `json:"username"`
+	Email          string `json:"email"`
+	ChangeID       int64  `json:"change_id,omitempty"` // Запрос на смену email
+}
+
+// verifyEmailToken проверяет подпись и назначение токена и то, что он выдан
+// в организации запроса. Иначе токен пользователя одной организации
+// подошёл бы пользователю с тем же именем в другой
+func (s *service) verifyEmailToken(ctx context.Context, raw, purpose string, claims *emailClaims) bool {
+	if err := s.signer.Verify(raw, claims); err != nil || claims.Purpose != purpose {
+		return false
+	}
+
+	organizationID, err := repo.TenantID(ctx)
+	if err != nil {
+		return false
+	}
+
+	return claims.OrganizationID == organizationID
+}
+
+// sendEmailVerification отправляет на адрес ссылку подтверждения.
+// Ошибка отправки не прерывает операцию: письмо можно запросить повторно
+func (s *service) sendEmailVerification(ctx context.Context, username, email string) {
+	organizationID, err := repo.TenantID(ctx)
+	if err != nil {
+		log.Printf("user.sendEmailVerification: %s", err.Error())
+		return
+	}
+
+	raw, err := s.signer.Sign(&emailClaims{
+		Purpose:        purposeEmailVerification,
+		OrganizationID: organizationID,
+		Username:       username,
+		Email:          normalize.Email(email),
+	}, s.verifyCfg.TokenTTL)
+	if err != nil {
+		log.Printf("user.sendEmailVerification: failed to sign token: %s", err.Error())
+		return
+	}
+
+	s.notifyAsync(&notifier.Notification{
+		Kind:     notifier.KindEmailVerification,
+		To:       email,
+		Username: username,
+		Data: map[string]string{
+			"token":      raw,
+			"expires_in": s.verifyCfg.TokenTTL.String(),
+		},
+	})
+}
+
+// VerifyEmail подтверждает email по токену. Токен действует,
+// только пока у пользователя тот же адрес, на который он был выдан
+func (s *service) VerifyEmail(ctx context.Context, verificationToken string) error {
+	var claims emailClaims
+	if !s.verifyEmailToken(ctx, verificationToken, purposeEmailVerification, &claims) {
+		return errInvalidVerificationToken
+	}
+
+	user, err := s.userRepo.Get(ctx, claims.Username)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errInvalidVerificationToken
+		}
+		return err
+	}
+
+	if normalize.Email(user.Email) != claims.Email {
+		return errInvalidVerificationToken
+	}
+
+	// Повторный переход по ссылке не считается ошибкой
+	if user.EmailVerifiedAt != nil {
+		return nil
+	}
+
+	if err = s.userRepo.MarkEmailVerified(ctx, user.Username, claims.Email); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errInvalidVerificationToken
+		}
+		return err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventEmailVerified,
+		Subject: user.Username,
+		Payload: map[string]interface{}{"email": user.Email},
+	})
+
+	return nil
+}
+
+// ResendEmailVerification повторно отправляет ссылку подтверждения
+// с ограничением частоты из конфигурации
+func (s *service) ResendEmailVerification(ctx context.Context, username string) error {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if user.EmailVerifiedAt != nil {
+		return errEmailAlreadyVerified
+	}
+
+	if err = s.checkResendLimit(ctx, verifyResendSubjectPrefix+normalize.Username(user.Username)); err != nil {
+		return err
+	}
+
+	s.sendEmailVerification(ctx, user.Username, user.Email)
+
+	return nil
+}
+
+// checkResendLimit учитывает отправку письма каждому из субъектов и запрещает её,
+// пока для любого из них не прошёл ResendInterval или исчерпан ResendLimit за ResendWindow.
+// Проверка и учёт выполняются атомарно, чтобы параллельные запросы не обходили лимит
+func (s *service) checkResendLimit(ctx context.Context, subjects ...string) error {
+	limits := make([]throttleRepo.Limit, 0, len(subjects))
+	for _, subject := range subjects {
+		limits = append(limits, throttleRepo.Limit{
+			Subject: subject,
+			Window:  s.verifyCfg.ResendWindow,
+			Delay: func(sent int) time.Duration {
+				if sent >= s.verifyCfg.ResendLimit {
+					return s.verifyCfg.ResendWindow
+				}
+				return s.verifyCfg.ResendInterval
+			},
+		})
+	}
+
+	_, blockedFor, err := s.throttleRepo.Reserve(ctx, limits...)
+	if err != nil {
+		return err
+	}
+
+	if blockedFor > 0 {
+		return errResendThrottled(blockedFor)
+	}
+
+	return nil
+}
+
+// notifyAsync отправляет уведомление в фоне, чтобы медленная доставка
+// не задерживала ответ. Ошибки доставки только логируются
+func (s *service) notifyAsync(notification *notifier.Notification) {
+	s.notifyWorker.Go(notification.Kind, func() {
+		ctx, cancel := context.WithTimeout(context.Background(), notifyTimeout)
+		defer cancel()
+
+		if err := s.notifier.Notify(ctx, notification); err != nil {
+			log.Printf("user.notifyAsync: failed to send %s: %s", notification.Kind, err.Error())
+		}
+	})
+}
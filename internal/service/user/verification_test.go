@@ -0,0 +1,50 @@
+package user
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Slintox/user-service/internal/tenant"
+	"github.com/Slintox/user-service/internal/token"
+)
+
+func TestEmailTokenBoundToOrganization(t *testing.T) {
+	s := &service{signer: token.NewSigner([]byte("secret"))}
+
+	raw, err := s.signer.Sign(&emailClaims{
+		Purpose:        purposeEmailVerification,
+		OrganizationID: 1,
+		Username:       "alice",
+		Email:          "alice@example.com",
+	}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		purpose string
+		want    bool
+	}{
+		{name: "same organization", ctx: tenant.NewContext(context.Background(), 1), purpose: purposeEmailVerification, want: true},
+		{name: "other organization", ctx: tenant.NewContext(context.Background(), 2), purpose: purposeEmailVerification},
+		{name: "no organization", ctx: context.Background(), purpose: purposeEmailVerification},
+		{name: "other purpose", ctx: tenant.NewContext(context.Background(), 1), purpose: purposeEmailChange},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var claims emailClaims
+			if got := s.verifyEmailToken(tt.ctx, raw, tt.purpose, &claims); got != tt.want {
+				t.Fatalf("verifyEmailToken() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	// Токен чужой организации отклоняется до поиска пользователя по имени
+	if err = s.VerifyEmail(tenant.NewContext(context.Background(), 2), raw); err != errInvalidVerificationToken {
+		t.Fatalf("VerifyEmail in other organization: err = %v, want %v", err, errInvalidVerificationToken)
+	}
+}
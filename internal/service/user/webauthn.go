@@ -0,0 +1,294 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"log"
+
+	"github.com/Slintox/user-service/internal/clientip"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/normalize"
+	repo "github.com/Slintox/user-service/internal/repository"
+	"github.com/Slintox/user-service/internal/webauthn"
+)
+
+// Размер user.id для аутентификаторов, спецификация допускает до 64 байт
+const userHandleSize = 32
+
+// BeginWebAuthnRegistration выдаёт опции для регистрации нового ключа пользователя
+// в формате JSON для PublicKeyCredential.parseCreationOptionsFromJSON
+func (s *service) BeginWebAuthnRegistration(ctx context.Context, username string) ([]byte, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	userHandle, err := s.webAuthnUserHandle(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	credentials, err := s.webAuthnRepo.ListCredentials(ctx, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.newWebAuthnChallenge(ctx, model.WebAuthnCeremonyRegistration, user.Username)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(s.relyingParty.CreationOptions(challenge, userHandle, user.Username, toRelyingPartyCredentials(credentials)))
+}
+
+// FinishWebAuthnRegistration проверяет ответ аутентификатора и сохраняет ключ.
+// У пользователя может быть несколько ключей
+func (s *service) FinishWebAuthnRegistration(ctx context.Context, username string, registration *model.WebAuthnRegistration) (*model.WebAuthnCredential, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	challenge, err := s.consumeWebAuthnChallenge(ctx, registration.ClientDataJSON, model.WebAuthnCeremonyRegistration)
+	if err != nil || normalize.Username(challenge.Username) != normalize.Username(user.Username) {
+		return nil, errWebAuthnRegistrationFailed
+	}
+
+	verified, err := s.relyingParty.VerifyRegistration(challenge.Challenge, registration.ClientDataJSON, registration.AttestationObject)
+	if err != nil {
+		log.Printf("user.FinishWebAuthnRegistration: %s", err.Error())
+		return nil, errWebAuthnRegistrationFailed
+	}
+
+	credential := &model.WebAuthnCredential{
+		Username:     user.Username,
+		CredentialID: verified.ID,
+		Name:         registration.Name,
+		PublicKey:    verified.PublicKey,
+		SignCount:    verified.SignCount,
+		Transports:   registration.Transports,
+		AAGUID:       verified.AAGUID,
+	}
+	if credential.Transports == nil {
+		credential.Transports = []string{}
+	}
+
+	if err = s.webAuthnRepo.AddCredential(ctx, credential); err != nil {
+		if errors.Is(err, repo.ErrAlreadyExists) {
+			return nil, errWebAuthnCredentialExists
+		}
+		return nil, err
+	}
+
+	s.publishEvent(ctx, &model.Event{
+		Type:    model.EventWebAuthnRegistered,
+		Subject: user.Username,
+		Payload: map[string]interface{}{"name": credential.Name},
+	})
+
+	return s.webAuthnRepo.GetCredential(ctx, credential.CredentialID)
+}
+
+// BeginWebAuthnLogin выдаёт опции для входа по ключу. Без имени пользователя
+// аутентификатор предлагает любой сохранённый ключ доступа (passkey).
+// Для несуществующего имени опции выдаются так же, без списка ключей
+func (s *service) BeginWebAuthnLogin(ctx context.Context, username string) ([]byte, error) {
+	var owner string
+	var credentials []*model.WebAuthnCredential
+
+	if username != "" {
+		user, err := s.userRepo.Get(ctx, username)
+		if err != nil && !errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, err
+		}
+
+		if user != nil {
+			owner = user.Username
+			credentials, err = s.webAuthnRepo.ListCredentials(ctx, user.Username)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	challenge, err := s.newWebAuthnChallenge(ctx, model.WebAuthnCeremonyLogin, owner)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(s.relyingParty.RequestOptions(challenge, toRelyingPartyCredentials(credentials)))
+}
+
+// FinishWebAuthnLogin проверяет подпись аутентификатора и открывает сессию.
+// Ключ с проверкой пользователя сам является двумя факторами, поэтому TOTP не запрашивается
+func (s *service) FinishWebAuthnLogin(ctx context.Context, assertion *model.WebAuthnAssertion) (*model.User, *model.Session, error) {
+	challenge, err := s.consumeWebAuthnChallenge(ctx, assertion.ClientDataJSON, model.WebAuthnCeremonyLogin)
+	if err != nil {
+		return nil, nil, errWebAuthnFailed
+	}
+
+	credential, err := s.webAuthnRepo.GetCredential(ctx, assertion.CredentialID)
+	if err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return nil, nil, errWebAuthnFailed
+		}
+		return nil, nil, err
+	}
+
+	// Challenge, выданный для конкретного пользователя, не подходит к чужому ключу
+	if challenge.Username != "" && normalize.Username(challenge.Username) != normalize.Username(credential.Username) {
+		return nil, nil, errWebAuthnFailed
+	}
+
+	ip := clientip.FromContext(ctx)
+	attempt, err := s.reserveLoginAttempt(ctx, credential.Username, ip)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer s.finishLoginAttempt(ctx, attempt)
+
+	if len(assertion.UserHandle) > 0 {
+		userHandle, err := s.webAuthnUserHandle(ctx, credential.Username)
+		if err != nil {
+			return nil, nil, err
+		}
+		if subtle.ConstantTimeCompare(userHandle, assertion.UserHandle) != 1 {
+			return nil, nil, errWebAuthnFailed
+		}
+	}
+
+	signCount, err := s.relyingParty.VerifyAssertion(
+		challenge.Challenge,
+		toRelyingPartyCredential(credential),
+		assertion.ClientDataJSON,
+		assertion.AuthenticatorData,
+		assertion.Signature,
+	)
+	if err != nil {
+		log.Printf("user.FinishWebAuthnLogin: %s", err.Error())
+
+		if errors.Is(err, webauthn.ErrSignCount) {
+			s.publishEvent(ctx, &model.Event{
+				Type:    model.EventWebAuthnCloneSuspected,
+				Subject: credential.Username,
+				Payload: map[string]interface{}{"name": credential.Name},
+			})
+		}
+
+		attempt.failed = true
+		return nil, nil, errWebAuthnFailed
+	}
+
+	if err = s.webAuthnRepo.UpdateSignCount(ctx, credential.CredentialID, signCount); err != nil {
+		return nil, nil, err
+	}
+
+	s.resetLoginFailures(ctx, credential.Username)
+
+	user, err := s.Get(ctx, credential.Username)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Ключ доступа с проверкой пользователя сам по себе второй фактор,
+	// иначе действует то же ограничение, что и при входе по паролю
+	var mfaEnrollmentRequired bool
+	if !s.relyingParty.RequireUserVerification {
+		mfaEnrollmentRequired, err = s.mfaEnrollmentRequired(ctx, user)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	session, err := s.createSession(ctx, user.Username, mfaEnrollmentRequired)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return user, session, nil
+}
+
+func (s *service) ListWebAuthnCredentials(ctx context.Context, username string) ([]*model.WebAuthnCredential, error) {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.webAuthnRepo.ListCredentials(ctx, user.Username)
+}
+
+func (s *service) DeleteWebAuthnCredential(ctx context.Context, username string, credentialID []byte) error {
+	user, err := s.Get(ctx, username)
+	if err != nil {
+		return err
+	}
+
+	if err = s.webAuthnRepo.DeleteCredential(ctx, user.Username, credentialID); err != nil {
+		if errors.Is(err, repo.ErrRecordNotFound) {
+			return errWebAuthnCredentialNotFound
+		}
+		return err
+	}
+
+	return nil
+}
+
+// webAuthnUserHandle возвращает постоянный user.id пользователя, создавая его при первом обращении
+func (s *service) webAuthnUserHandle(ctx context.Context, username string) ([]byte, error) {
+	handle := make([]byte, userHandleSize)
+	if _, err := rand.Read(handle); err != nil {
+		return nil, err
+	}
+
+	return s.webAuthnRepo.EnsureUserHandle(ctx, username, handle)
+}
+
+func (s *service) newWebAuthnChallenge(ctx context.Context, ceremony, username string) ([]byte, error) {
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		return nil, err
+	}
+
+	err = s.webAuthnRepo.AddChallenge(ctx, &model.WebAuthnChallenge{
+		Challenge: challenge,
+		Ceremony:  ceremony,
+		Username:  username,
+	}, s.webAuthnCfg.ChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// consumeWebAuthnChallenge находит по clientDataJSON выданный challenge и погашает его
+func (s *service) consumeWebAuthnChallenge(ctx context.Context, clientDataJSON []byte, ceremony string) (*model.WebAuthnChallenge, error) {
+	challenge, err := webauthn.ParseChallenge(clientDataJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	return s.webAuthnRepo.ConsumeChallenge(ctx, challenge, ceremony)
+}
+
+func toRelyingPartyCredentials(credentials []*model.WebAuthnCredential) []*webauthn.Credential {
+	result := make([]*webauthn.Credential, 0, len(credentials))
+	for _, credential := range credentials {
+		result = append(result, toRelyingPartyCredential(credential))
+	}
+
+	return result
+}
+
+func toRelyingPartyCredential(credential *model.WebAuthnCredential) *webauthn.Credential {
+	return &webauthn.Credential{
+		ID:         credential.CredentialID,
+		PublicKey:  credential.PublicKey,
+		SignCount:  credential.SignCount,
+		Transports: credential.Transports,
+		AAGUID:     credential.AAGUID,
+	}
+}
@@ -0,0 +1,194 @@
+package user
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/Slintox/user-service/config"
+	"github.com/Slintox/user-service/internal/model"
+	"github.com/Slintox/user-service/internal/webauthn"
+	"github.com/Slintox/user-service/internal/webauthn/webauthntest"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func newWebAuthnService() *service {
+	return &service{
+		userRepo:     &memUserRepo{users: []*model.User{{Username: "alice", Email: "alice@example.com"}}},
+		webAuthnRepo: &memWebAuthnRepo{},
+		sessionRepo:  &memSessionRepo{},
+		throttleRepo: &memThrottleRepo{},
+		eventRepo:    &memEventRepo{},
+		relyingParty: &webauthn.RelyingParty{
+			ID:                      testRPID,
+			Name:                    "Example",
+			Origins:                 []string{testOrigin},
+			RequireUserVerification: true,
+			Timeout:                 time.Minute,
+		},
+		loginCfg:    &config.LoginThrottleConfig{LockThreshold: 10, IPLockThreshold: 100},
+		sessionCfg:  &config.SessionConfig{TTL: time.Hour},
+		webAuthnCfg: &config.WebAuthnConfig{ChallengeTTL: time.Minute},
+	}
+}
+
+// optionsChallenge достаёт challenge из опций церемонии в JSON
+func optionsChallenge(t *testing.T, options []byte) []byte {
+	t.Helper()
+
+	var parsed struct {
+		Challenge string `json:"challenge"`
+	}
+	if err := json.Unmarshal(options, &parsed); err != nil {
+		t.Fatal(err)
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(parsed.Challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return challenge
+}
+
+func registerAuthenticator(t *testing.T, s *service, username string) *webauthntest.Authenticator {
+	t.Helper()
+	ctx := context.Background()
+
+	authenticator, err := webauthntest.New(testRPID, testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := s.BeginWebAuthnRegistration(ctx, username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientDataJSON, attestationObject, err := authenticator.Register(optionsChallenge(t, options))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = s.FinishWebAuthnRegistration(ctx, username, &model.WebAuthnRegistration{
+		ClientDataJSON:    clientDataJSON,
+		AttestationObject: attestationObject,
+	})
+	if err != nil {
+		t.Fatalf("FinishWebAuthnRegistration: %v", err)
+	}
+
+	return authenticator
+}
+
+func assertion(t *testing.T, s *service, authenticator *webauthntest.Authenticator, username string) *model.WebAuthnAssertion {
+	t.Helper()
+
+	options, err := s.BeginWebAuthnLogin(context.Background(), username)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientDataJSON, authData, signature, err := authenticator.Assert(optionsChallenge(t, options))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return &model.WebAuthnAssertion{
+		CredentialID:      authenticator.CredentialID(),
+		ClientDataJSON:    clientDataJSON,
+		AuthenticatorData: authData,
+		Signature:         signature,
+	}
+}
+
+func TestWebAuthnRegistrationThenLogin(t *testing.T) {
+	s := newWebAuthnService()
+	authenticator := registerAuthenticator(t, s, "alice")
+
+	user, session, err := s.FinishWebAuthnLogin(context.Background(), assertion(t, s, authenticator, "alice"))
+	if err != nil {
+		t.Fatalf("FinishWebAuthnLogin: %v", err)
+	}
+	if user.Username != "alice" || session.Token == "" {
+		t.Fatalf("unexpected login result: %+v %+v", user, session)
+	}
+}
+
+func TestWebAuthnChallengeReuseRejected(t *testing.T) {
+	ctx := context.Background()
+	s := newWebAuthnService()
+
+	authenticator, err := webauthntest.New(testRPID, testOrigin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	options, err := s.BeginWebAuthnRegistration(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	clientDataJSON, attestationObject, err := authenticator.Register(optionsChallenge(t, options))
+	if err != nil {
+		t.Fatal(err)
+	}
+	registration := &model.WebAuthnRegistration{ClientDataJSON: clientDataJSON, AttestationObject: attestationObject}
+
+	if _, err = s.FinishWebAuthnRegistration(ctx, "alice", registration); err != nil {
+		t.Fatalf("FinishWebAuthnRegistration: %v", err)
+	}
+	if _, err = s.FinishWebAuthnRegistration(ctx, "alice", registration); err != errWebAuthnRegistrationFailed {
+		t.Fatalf("replayed registration: err = %v, want %v", err, errWebAuthnRegistrationFailed)
+	}
+
+	login := assertion(t, s, authenticator, "alice")
+	if _, _, err = s.FinishWebAuthnLogin(ctx, login); err != nil {
+		t.Fatalf("FinishWebAuthnLogin: %v", err)
+	}
+	if _, _, err = s.FinishWebAuthnLogin(ctx, login); err != errWebAuthnFailed {
+		t.Fatalf("replayed login: err = %v, want %v", err, errWebAuthnFailed)
+	}
+}
+
+func TestWebAuthnSeveralCredentials(t *testing.T) {
+	ctx := context.Background()
+	s := newWebAuthnService()
+
+	first := registerAuthenticator(t, s, "alice")
+	second := registerAuthenticator(t, s, "alice")
+
+	credentials, err := s.ListWebAuthnCredentials(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(credentials) != 2 {
+		t.Fatalf("got %d credentials, want 2", len(credentials))
+	}
+
+	for _, authenticator := range []*webauthntest.Authenticator{first, second} {
+		if _, _, err = s.FinishWebAuthnLogin(ctx, assertion(t, s, authenticator, "alice")); err != nil {
+			t.Fatalf("FinishWebAuthnLogin: %v", err)
+		}
+	}
+
+	// Ключи исключаются из регистрации, чтобы один аутентификатор не записывался дважды
+	options, err := s.BeginWebAuthnRegistration(ctx, "alice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parsed struct {
+		ExcludeCredentials []json.RawMessage `json:"excludeCredentials"`
+	}
+	if err = json.Unmarshal(options, &parsed); err != nil {
+		t.Fatal(err)
+	}
+	if len(parsed.ExcludeCredentials) != 2 {
+		t.Fatalf("got %d excluded credentials, want 2", len(parsed.ExcludeCredentials))
+	}
+}
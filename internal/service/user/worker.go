@@ -0,0 +1,40 @@
+package user
+
+import "log"
+
+// Фоновая отправка писем: число горутин и длина очереди
+const (
+	notifyWorkers   = 4
+	notifyQueueSize = 256
+)
+
+// worker выполняет фоновые задачи в фиксированном числе горутин.
+// Поток запросов не порождает горутину на каждое письмо: если очередь заполнена,
+// задача отбрасывается, как отбрасывается письмо при ошибке доставки
+type worker struct {
+	jobs chan func()
+}
+
+func newWorker(workers, queueSize int) *worker {
+	w := &worker{jobs: make(chan func(), queueSize)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range w.jobs {
+				job()
+			}
+		}()
+	}
+
+	return w
+}
+
+// Go ставит задачу в очередь. Возвращает false, если очередь заполнена
+func (w *worker) Go(name string, job func()) bool {
+	select {
+	case w.jobs <- job:
+		return true
+	default:
+		log.Printf("user.worker: queue is full, %s dropped", name)
+		return false
+	}
+}
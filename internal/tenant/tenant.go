@@ -0,0 +1,16 @@
+package tenant
+
+import "context"
+
+type ctxKey struct{}
+
+// NewContext сохраняет id организации запроса в контексте
+func NewContext(ctx context.Context, organizationID int64) context.Context {
+	return context.WithValue(ctx, ctxKey{}, organizationID)
+}
+
+// FromContext возвращает id организации запроса или false, если она не определена
+func FromContext(ctx context.Context) (int64, bool) {
+	organizationID, ok := ctx.Value(ctxKey{}).(int64)
+	return organizationID, ok
+}
@@ -0,0 +1,93 @@
+package token
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token expired")
+)
+
+// Signer выпускает токены, подписанные HMAC-SHA256. Такие токены не хранятся
+// на сервере: данные и срок действия содержатся в самом токене.
+//
+// Формат токена: base64url(JSON с данными и сроком действия).base64url(подпись)
+type Signer struct {
+	secret []byte
+}
+
+func NewSigner(secret []byte) *Signer {
+	return &Signer{
+		secret: secret,
+	}
+}
+
+type envelope struct {
+	ExpiresAt int64           `json:"exp"`
+	Data      json.RawMessage `json:"data"`
+}
+
+// Sign возвращает токен с данными claims, действующий ttl
+func (s *Signer) Sign(claims interface{}, ttl time.Duration) (string, error) {
+	data, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+
+	payload, err := json.Marshal(envelope{
+		ExpiresAt: time.Now().Add(ttl).Unix(),
+		Data:      data,
+	})
+	if err != nil {
+		return "", err
+	}
+
+	encoded := base64.RawURLEncoding.EncodeToString(payload)
+	return encoded + "." + base64.RawURLEncoding.EncodeToString(s.mac(encoded)), nil
+}
+
+// Verify проверяет подпись и срок действия токена и заполняет claims
+func (s *Signer) Verify(raw string, claims interface{}) error {
+	encoded, signature, ok := strings.Cut(raw, ".")
+	if !ok {
+		return ErrInvalidToken
+	}
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, s.mac(encoded)) {
+		return ErrInvalidToken
+	}
+
+	payload, err := base64.RawURLEncoding.DecodeString(encoded)
+	if err != nil {
+		return ErrInvalidToken
+	}
+
+	var env envelope
+	if err = json.Unmarshal(payload, &env); err != nil {
+		return ErrInvalidToken
+	}
+
+	if time.Now().Unix() >= env.ExpiresAt {
+		return ErrTokenExpired
+	}
+
+	if err = json.Unmarshal(env.Data, claims); err != nil {
+		return ErrInvalidToken
+	}
+
+	return nil
+}
+
+func (s *Signer) mac(encoded string) []byte {
+	h := hmac.New(sha256.New, s.secret)
+	h.Write([]byte(encoded))
+	return h.Sum(nil)
+}
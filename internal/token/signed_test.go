@@ -0,0 +1,92 @@
+package token
+
+import (
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+)
+
+type testClaims struct {
+	Username string `json:"username"`
+}
+
+func TestSignerRoundTrip(t *testing.T) {
+	s := NewSigner([]byte("secret"))
+
+	raw, err := s.Sign(&testClaims{Username: "alice"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims testClaims
+	if err = s.Verify(raw, &claims); err != nil {
+		t.Fatalf("Verify() err = %v", err)
+	}
+	if claims.Username != "alice" {
+		t.Fatalf("username = %q, want alice", claims.Username)
+	}
+}
+
+func TestSignerRejectsTamperedTokens(t *testing.T) {
+	s := NewSigner([]byte("secret"))
+
+	raw, err := s.Sign(&testClaims{Username: "alice"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	encoded, signature, _ := strings.Cut(raw, ".")
+
+	// Подменённые данные с исходной подписью
+	forged, err := NewSigner([]byte("other")).Sign(&testClaims{Username: "admin"}, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	forgedEncoded, forgedSignature, _ := strings.Cut(forged, ".")
+
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mac[0] ^= 1
+
+	tests := map[string]string{
+		"payload":          forgedEncoded + "." + signature,
+		"signature":        encoded + "." + base64.RawURLEncoding.EncodeToString(mac),
+		"other secret":     forged,
+		"foreign payload":  encoded + "." + forgedSignature,
+		"no signature":     encoded,
+		"empty signature":  encoded + ".",
+		"invalid encoding": encoded + ".!!!",
+		"empty":            "",
+	}
+
+	for name, token := range tests {
+		t.Run(name, func(t *testing.T) {
+			var claims testClaims
+			if err := s.Verify(token, &claims); err != ErrInvalidToken {
+				t.Fatalf("Verify() err = %v, want %v", err, ErrInvalidToken)
+			}
+			if claims.Username != "" {
+				t.Fatalf("claims filled from rejected token: %+v", claims)
+			}
+		})
+	}
+}
+
+func TestSignerRejectsExpiredToken(t *testing.T) {
+	s := NewSigner([]byte("secret"))
+
+	raw, err := s.Sign(&testClaims{Username: "alice"}, -time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var claims testClaims
+	if err = s.Verify(raw, &claims); err != ErrTokenExpired {
+		t.Fatalf("Verify() err = %v, want %v", err, ErrTokenExpired)
+	}
+	if claims.Username != "" {
+		t.Fatalf("claims filled from expired token: %+v", claims)
+	}
+}
@@ -0,0 +1,30 @@
+package token
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+)
+
+// Длина случайной части токена в байтах
+const entropyBytes = 32
+
+// Generate создаёт случайный токен с необязательным префиксом и его хеш для хранения.
+// Сам токен показывается клиенту один раз и нигде не сохраняется
+func Generate(prefix string) (raw string, hash string, err error) {
+	b := make([]byte, entropyBytes)
+	if _, err = rand.Read(b); err != nil {
+		return "", "", err
+	}
+
+	raw = prefix + base64.RawURLEncoding.EncodeToString(b)
+	return raw, Hash(raw), nil
+}
+
+// Hash возвращает SHA-256 токена в hex. Медленное хеширование не нужно,
+// так как токены высокоэнтропийные, а поиск по хешу должен быть быстрым
+func Hash(raw string) string {
+	sum := sha256.Sum256([]byte(raw))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,81 @@
+package validator
+
+import (
+	"fmt"
+	"net/mail"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+const maxEmailLength = 254
+
+type integer interface {
+	~int | ~int8 | ~int16 | ~int32 | ~int64
+}
+
+// Required запрещает пустые строки и строки из одних пробелов
+func Required() Rule[string] {
+	return func(value string) string {
+		if strings.TrimSpace(value) == "" {
+			return "Поле обязательно для заполнения"
+		}
+		return ""
+	}
+}
+
+// Length ограничивает длину строки в символах
+func Length(min, max int) Rule[string] {
+	return func(value string) string {
+		length := utf8.RuneCountInString(value)
+		if length < min || length > max {
+			return fmt.Sprintf("Длина должна быть от %d до %d символов", min, max)
+		}
+		return ""
+	}
+}
+
+// Match требует соответствия строки регулярному выражению
+func Match(re *regexp.Regexp, description string) Rule[string] {
+	return func(value string) string {
+		if !re.MatchString(value) {
+			return description
+		}
+		return ""
+	}
+}
+
+// Email требует адрес в формате addr-spec из RFC 5322, без отображаемого имени
+func Email() Rule[string] {
+	return func(value string) string {
+		if len(value) > maxEmailLength {
+			return fmt.Sprintf("Адрес не должен быть длиннее %d символов", maxEmailLength)
+		}
+
+		addr, err := mail.ParseAddress(value)
+		if err != nil || addr.Name != "" || addr.Address != value {
+			return "Некорректный адрес электронной почты"
+		}
+		return ""
+	}
+}
+
+// Between ограничивает целое значение диапазоном [min, max]
+func Between[T integer](min, max T) Rule[T] {
+	return func(value T) string {
+		if value < min || value > max {
+			return fmt.Sprintf("Значение должно быть от %d до %d", min, max)
+		}
+		return ""
+	}
+}
+
+// Equal требует совпадения значения с другим, например подтверждения пароля с паролем
+func Equal(other string, description string) Rule[string] {
+	return func(value string) string {
+		if value != other {
+			return description
+		}
+		return ""
+	}
+}
@@ -0,0 +1,107 @@
+package validator
+
+import (
+	"strings"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const errorsMessage = "Некорректные данные"
+
+// FieldError описывает нарушение правила для одного поля
+type FieldError struct {
+	Field       string
+	Description string
+}
+
+// Errors содержит все найденные нарушения. Реализует GRPCStatus,
+// поэтому возвращается клиенту как InvalidArgument с деталями BadRequest.
+type Errors []FieldError
+
+func (e Errors) Error() string {
+	descriptions := make([]string, 0, len(e))
+	for _, fieldErr := range e {
+		descriptions = append(descriptions, fieldErr.Field+": "+fieldErr.Description)
+	}
+
+	return errorsMessage + ": " + strings.Join(descriptions, "; ")
+}
+
+func (e Errors) GRPCStatus() *status.Status {
+	st := status.New(codes.InvalidArgument, e.Error())
+
+	badRequest := &errdetails.BadRequest{}
+	for _, fieldErr := range e {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       fieldErr.Field,
+			Description: fieldErr.Description,
+		})
+	}
+
+	withDetails, err := st.WithDetails(badRequest)
+	if err != nil {
+		return st
+	}
+
+	return withDetails
+}
+
+// Rule проверяет значение и возвращает описание нарушения
+// или пустую строку, если значение корректно
+type Rule[T any] func(value T) string
+
+// Checker проверяет одно поле
+type Checker interface {
+	Check() []FieldError
+}
+
+type field[T any] struct {
+	name  string
+	value *T
+	rules []Rule[T]
+}
+
+// Field описывает правила для поля. Если value равен nil, поле не проверяется,
+// что позволяет использовать одни и те же правила для необязательных полей обновления.
+func Field[T any](name string, value *T, rules ...Rule[T]) Checker {
+	return field[T]{
+		name:  name,
+		value: value,
+		rules: rules,
+	}
+}
+
+func (f field[T]) Check() []FieldError {
+	if f.value == nil {
+		return nil
+	}
+
+	var fieldErrs []FieldError
+	for _, rule := range f.rules {
+		if description := rule(*f.value); description != "" {
+			fieldErrs = append(fieldErrs, FieldError{
+				Field:       f.name,
+				Description: description,
+			})
+		}
+	}
+
+	return fieldErrs
+}
+
+// Validate проверяет все поля и возвращает Errors со всеми нарушениями
+// или nil, если нарушений нет
+func Validate(checkers ...Checker) error {
+	var errs Errors
+	for _, checker := range checkers {
+		errs = append(errs, checker.Check()...)
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
@@ -0,0 +1,98 @@
+package validator
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestValidateCollectsAllViolations(t *testing.T) {
+	username := ""
+	email := "not an email"
+	age := 200
+
+	err := Validate(
+		Field("username", &username, Required(), Length(3, 32)),
+		Field("email", &email, Required(), Email()),
+		Field("age", &age, Between(0, 150)),
+		// Поле без значения не проверяется
+		Field[string]("password", nil, Required()),
+	)
+
+	var errs Errors
+	if !errors.As(err, &errs) {
+		t.Fatalf("err = %v, want Errors", err)
+	}
+
+	want := Errors{
+		{Field: "username", Description: "Поле обязательно для заполнения"},
+		{Field: "username", Description: "Длина должна быть от 3 до 32 символов"},
+		{Field: "email", Description: "Некорректный адрес электронной почты"},
+		{Field: "age", Description: "Значение должно быть от 0 до 150"},
+	}
+	if !reflect.DeepEqual(errs, want) {
+		t.Fatalf("violations = %+v, want %+v", errs, want)
+	}
+}
+
+func TestValidateWithoutViolations(t *testing.T) {
+	username := "alice"
+	email := "alice@example.com"
+
+	err := Validate(
+		Field("username", &username, Required(), Length(3, 32)),
+		Field("email", &email, Email()),
+	)
+	if err != nil {
+		t.Fatalf("err = %v, want nil", err)
+	}
+}
+
+func TestErrorsStatusCarriesFieldViolations(t *testing.T) {
+	err := Validate(
+		Field("username", new(string), Required()),
+		Field("confirm_password", new(string), Equal("secret", "Пароли не совпадают")),
+	)
+
+	st := status.Convert(err)
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code = %s, want InvalidArgument", st.Code())
+	}
+
+	var fields []string
+	for _, detail := range st.Details() {
+		badRequest, ok := detail.(*errdetails.BadRequest)
+		if !ok {
+			continue
+		}
+		for _, violation := range badRequest.GetFieldViolations() {
+			fields = append(fields, violation.GetField())
+		}
+	}
+
+	if want := []string{"username", "confirm_password"}; !reflect.DeepEqual(fields, want) {
+		t.Fatalf("violated fields = %v, want %v", fields, want)
+	}
+}
+
+func TestEmail(t *testing.T) {
+	tests := map[string]bool{
+		"alice@example.com":                       true,
+		"Alice <alice@example.com>":               false,
+		"alice":                                   false,
+		" alice@example.com":                      false,
+		"alice@example.com.":                      false,
+		strings.Repeat("a", 250) + "@example.com": false,
+	}
+
+	for value, valid := range tests {
+		if got := Email()(value) == ""; got != valid {
+			t.Errorf("Email()(%q) valid = %v, want %v", value, got, valid)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Алгоритмы COSE (RFC 9053), которые принимаются от аутентификаторов
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Параметры ключа COSE
+const (
+	coseKty = 1
+	coseAlg = 3
+
+	// Для EC2 и OKP
+	coseCrv = -1
+	coseX   = -2
+	coseY   = -3
+
+	// Для RSA
+	coseN = -1
+	coseE = -2
+
+	ktyOKP = 1
+	ktyEC2 = 2
+	ktyRSA = 3
+
+	crvP256    = 1
+	crvEd25519 = 6
+)
+
+// supportedAlgorithms в порядке предпочтения для pubKeyCredParams
+var supportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+type publicKey struct {
+	alg int64
+	key crypto.PublicKey
+}
+
+// parsePublicKey разбирает открытый ключ в формате COSE_Key
+func parsePublicKey(coseKey []byte) (*publicKey, error) {
+	var fields map[int]cbor.RawMessage
+	if err := cbor.Unmarshal(coseKey, &fields); err != nil {
+		return nil, fmt.Errorf("%w: malformed public key", ErrInvalidResponse)
+	}
+
+	var kty, alg int64
+	if err := unmarshalField(fields, coseKty, &kty); err != nil {
+		return nil, err
+	}
+	if err := unmarshalField(fields, coseAlg, &alg); err != nil {
+		return nil, err
+	}
+
+	switch {
+	case kty == ktyEC2 && alg == AlgES256:
+		var crv int64
+		var x, y []byte
+		if err := unmarshalFields(fields, map[int]interface{}{coseCrv: &crv, coseX: &x, coseY: &y}); err != nil {
+			return nil, err
+		}
+		if crv != crvP256 {
+			return nil, fmt.Errorf("%w: unsupported curve %d", ErrInvalidResponse, crv)
+		}
+
+		key := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !key.Curve.IsOnCurve(key.X, key.Y) {
+			return nil, fmt.Errorf("%w: point is not on curve", ErrInvalidResponse)
+		}
+
+		return &publicKey{alg: alg, key: key}, nil
+	case kty == ktyOKP && alg == AlgEdDSA:
+		var crv int64
+		var x []byte
+		if err := unmarshalFields(fields, map[int]interface{}{coseCrv: &crv, coseX: &x}); err != nil {
+			return nil, err
+		}
+		if crv != crvEd25519 || len(x) != ed25519.PublicKeySize {
+			return nil, fmt.Errorf("%w: unsupported curve %d", ErrInvalidResponse, crv)
+		}
+
+		return &publicKey{alg: alg, key: ed25519.PublicKey(x)}, nil
+	case kty == ktyRSA && alg == AlgRS256:
+		var n, e []byte
+		if err := unmarshalFields(fields, map[int]interface{}{coseN: &n, coseE: &e}); err != nil {
+			return nil, err
+		}
+
+		exponent := new(big.Int).SetBytes(e)
+		if !exponent.IsInt64() || exponent.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("%w: invalid rsa exponent", ErrInvalidResponse)
+		}
+
+		return &publicKey{alg: alg, key: &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}}, nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported key type %d with algorithm %d", ErrInvalidResponse, kty, alg)
+	}
+}
+
+// verify проверяет подпись данных ключом
+func (k *publicKey) verify(data, signature []byte) bool {
+	switch key := k.key.(type) {
+	case *ecdsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return ecdsa.VerifyASN1(key, digest[:], signature)
+	case ed25519.PublicKey:
+		return ed25519.Verify(key, data, signature)
+	case *rsa.PublicKey:
+		digest := sha256.Sum256(data)
+		return rsa.VerifyPKCS1v15(key, crypto.SHA256, digest[:], signature) == nil
+	default:
+		return false
+	}
+}
+
+func unmarshalFields(fields map[int]cbor.RawMessage, targets map[int]interface{}) error {
+	for label, target := range targets {
+		if err := unmarshalField(fields, label, target); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func unmarshalField(fields map[int]cbor.RawMessage, label int, target interface{}) error {
+	raw, ok := fields[label]
+	if !ok {
+		return fmt.Errorf("%w: public key parameter %d is missing", ErrInvalidResponse, label)
+	}
+
+	if err := cbor.Unmarshal(raw, target); err != nil {
+		return fmt.Errorf("%w: invalid public key parameter %d", ErrInvalidResponse, label)
+	}
+
+	return nil
+}
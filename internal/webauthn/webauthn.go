@@ -0,0 +1,362 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/fxamacker/cbor/v2"
+)
+
+// Типы церемоний в clientDataJSON
+const (
+	TypeCreate = "webauthn.create"
+	TypeGet    = "webauthn.get"
+)
+
+// Флаги данных аутентификатора
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+)
+
+const (
+	challengeSize  = 32
+	rpIDHashSize   = sha256.Size
+	authDataMinLen = rpIDHashSize + 1 + 4
+	aaguidSize     = 16
+)
+
+var (
+	ErrInvalidResponse = errors.New("invalid webauthn response")
+	// ErrSignCount означает, что счётчик подписей не вырос: ключ мог быть скопирован
+	ErrSignCount = errors.New("webauthn sign count did not increase")
+)
+
+// RelyingParty проверяет ответы аутентификаторов для сайта с идентификатором ID.
+// Проверка не зависит от хранилища и часов, поэтому церемонии можно
+// воспроизводить программным аутентификатором из пакета webauthntest
+type RelyingParty struct {
+	ID      string
+	Name    string
+	Origins []string
+	// Требовать проверку пользователя (PIN, биометрия), а не только присутствие
+	RequireUserVerification bool
+	Timeout                 time.Duration
+}
+
+// Credential описывает зарегистрированный ключ аутентификатора
+type Credential struct {
+	ID         []byte
+	PublicKey  []byte // COSE_Key
+	SignCount  uint32
+	Transports []string
+	AAGUID     []byte
+}
+
+// NewChallenge возвращает случайный challenge для церемонии
+func NewChallenge() ([]byte, error) {
+	challenge := make([]byte, challengeSize)
+	if _, err := rand.Read(challenge); err != nil {
+		return nil, err
+	}
+
+	return challenge, nil
+}
+
+// URLEncoded сериализуется в JSON как base64url без выравнивания,
+// как того требует JSON-представление опций WebAuthn
+type URLEncoded []byte
+
+func (b URLEncoded) MarshalJSON() ([]byte, error) {
+	return json.Marshal(base64.RawURLEncoding.EncodeToString(b))
+}
+
+type relyingPartyEntity struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type userEntity struct {
+	ID          URLEncoded `json:"id"`
+	Name        string     `json:"name"`
+	DisplayName string     `json:"displayName"`
+}
+
+type credentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type credentialDescriptor struct {
+	Type       string     `json:"type"`
+	ID         URLEncoded `json:"id"`
+	Transports []string   `json:"transports,omitempty"`
+}
+
+type authenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions соответствует PublicKeyCredentialCreationOptionsJSON
+type CreationOptions struct {
+	RP                     relyingPartyEntity     `json:"rp"`
+	User                   userEntity             `json:"user"`
+	Challenge              URLEncoded             `json:"challenge"`
+	PubKeyCredParams       []credentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout,omitempty"`
+	ExcludeCredentials     []credentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection authenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions соответствует PublicKeyCredentialRequestOptionsJSON
+type RequestOptions struct {
+	Challenge        URLEncoded             `json:"challenge"`
+	Timeout          int64                  `json:"timeout,omitempty"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []credentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// CreationOptions возвращает опции для navigator.credentials.create.
+// exclude не даёт повторно зарегистрировать уже известные ключи
+func (rp *RelyingParty) CreationOptions(challenge, userHandle []byte, username string, exclude []*Credential) *CreationOptions {
+	params := make([]credentialParameter, 0, len(supportedAlgorithms))
+	for _, alg := range supportedAlgorithms {
+		params = append(params, credentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	return &CreationOptions{
+		RP:                 relyingPartyEntity{ID: rp.ID, Name: rp.Name},
+		User:               userEntity{ID: userHandle, Name: username, DisplayName: username},
+		Challenge:          challenge,
+		PubKeyCredParams:   params,
+		Timeout:            rp.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: authenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: rp.userVerification(),
+		},
+		// Аттестация не проверяется, поэтому и не запрашивается
+		Attestation: "none",
+	}
+}
+
+// RequestOptions возвращает опции для navigator.credentials.get.
+// Пустой allow позволяет выбрать любой ключ, сохранённый на аутентификаторе
+func (rp *RelyingParty) RequestOptions(challenge []byte, allow []*Credential) *RequestOptions {
+	return &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          rp.Timeout.Milliseconds(),
+		RPID:             rp.ID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: rp.userVerification(),
+	}
+}
+
+func (rp *RelyingParty) userVerification() string {
+	if rp.RequireUserVerification {
+		return "required"
+	}
+	return "preferred"
+}
+
+func descriptors(credentials []*Credential) []credentialDescriptor {
+	result := make([]credentialDescriptor, 0, len(credentials))
+	for _, credential := range credentials {
+		result = append(result, credentialDescriptor{
+			Type:       "public-key",
+			ID:         credential.ID,
+			Transports: credential.Transports,
+		})
+	}
+
+	return result
+}
+
+// CollectedClientData соответствует clientDataJSON
+type CollectedClientData struct {
+	Type        string `json:"type"`
+	Challenge   string `json:"challenge"`
+	Origin      string `json:"origin"`
+	CrossOrigin bool   `json:"crossOrigin,omitempty"`
+}
+
+// ParseChallenge извлекает challenge из clientDataJSON, чтобы найти сохранённую церемонию
+func ParseChallenge(clientDataJSON []byte) ([]byte, error) {
+	var clientData CollectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return nil, fmt.Errorf("%w: malformed client data", ErrInvalidResponse)
+	}
+
+	challenge, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil {
+		return nil, fmt.Errorf("%w: malformed challenge", ErrInvalidResponse)
+	}
+
+	return challenge, nil
+}
+
+// VerifyRegistration проверяет ответ navigator.credentials.create и возвращает новый ключ.
+// Оператор аттестации не проверяется: опции запрашивают аттестацию "none",
+// и ключу доверяют так же, как при самоаттестации
+func (rp *RelyingParty) VerifyRegistration(challenge, clientDataJSON, attestationObject []byte) (*Credential, error) {
+	if err := rp.verifyClientData(clientDataJSON, TypeCreate, challenge); err != nil {
+		return nil, err
+	}
+
+	var attestation struct {
+		Fmt      string          `cbor:"fmt"`
+		AttStmt  cbor.RawMessage `cbor:"attStmt"`
+		AuthData []byte          `cbor:"authData"`
+	}
+	if err := cbor.Unmarshal(attestationObject, &attestation); err != nil {
+		return nil, fmt.Errorf("%w: malformed attestation object", ErrInvalidResponse)
+	}
+
+	authData, err := rp.verifyAuthenticatorData(attestation.AuthData)
+	if err != nil {
+		return nil, err
+	}
+
+	if authData.credentialID == nil {
+		return nil, fmt.Errorf("%w: attested credential data is missing", ErrInvalidResponse)
+	}
+
+	if _, err = parsePublicKey(authData.publicKey); err != nil {
+		return nil, err
+	}
+
+	return &Credential{
+		ID:        authData.credentialID,
+		PublicKey: authData.publicKey,
+		SignCount: authData.signCount,
+		AAGUID:    authData.aaguid,
+	}, nil
+}
+
+// VerifyAssertion проверяет ответ navigator.credentials.get для ключа credential
+// и возвращает новое значение счётчика подписей
+func (rp *RelyingParty) VerifyAssertion(challenge []byte, credential *Credential, clientDataJSON, authenticatorData, signature []byte) (uint32, error) {
+	if err := rp.verifyClientData(clientDataJSON, TypeGet, challenge); err != nil {
+		return 0, err
+	}
+
+	authData, err := rp.verifyAuthenticatorData(authenticatorData)
+	if err != nil {
+		return 0, err
+	}
+
+	key, err := parsePublicKey(credential.PublicKey)
+	if err != nil {
+		return 0, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	signed := append(append([]byte{}, authenticatorData...), clientDataHash[:]...)
+	if !key.verify(signed, signature) {
+		return 0, fmt.Errorf("%w: signature mismatch", ErrInvalidResponse)
+	}
+
+	// Аутентификаторы без счётчика всегда передают 0
+	if (authData.signCount != 0 || credential.SignCount != 0) && authData.signCount <= credential.SignCount {
+		return 0, ErrSignCount
+	}
+
+	return authData.signCount, nil
+}
+
+func (rp *RelyingParty) verifyClientData(clientDataJSON []byte, ceremony string, challenge []byte) error {
+	var clientData CollectedClientData
+	if err := json.Unmarshal(clientDataJSON, &clientData); err != nil {
+		return fmt.Errorf("%w: malformed client data", ErrInvalidResponse)
+	}
+
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: unexpected ceremony type %q", ErrInvalidResponse, clientData.Type)
+	}
+
+	actual, err := base64.RawURLEncoding.DecodeString(clientData.Challenge)
+	if err != nil || subtle.ConstantTimeCompare(actual, challenge) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrInvalidResponse)
+	}
+
+	for _, origin := range rp.Origins {
+		if clientData.Origin == origin {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%w: unexpected origin %q", ErrInvalidResponse, clientData.Origin)
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	aaguid       []byte
+	credentialID []byte
+	publicKey    []byte
+}
+
+// verifyAuthenticatorData разбирает данные аутентификатора и проверяет
+// идентификатор сайта и флаги присутствия и проверки пользователя
+func (rp *RelyingParty) verifyAuthenticatorData(data []byte) (*authenticatorData, error) {
+	if len(data) < authDataMinLen {
+		return nil, fmt.Errorf("%w: authenticator data is too short", ErrInvalidResponse)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(rp.ID))
+	if !bytes.Equal(data[:rpIDHashSize], rpIDHash[:]) {
+		return nil, fmt.Errorf("%w: relying party id mismatch", ErrInvalidResponse)
+	}
+
+	authData := &authenticatorData{
+		flags:     data[rpIDHashSize],
+		signCount: binary.BigEndian.Uint32(data[rpIDHashSize+1 : authDataMinLen]),
+	}
+
+	if authData.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user is not present", ErrInvalidResponse)
+	}
+	if rp.RequireUserVerification && authData.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user is not verified", ErrInvalidResponse)
+	}
+
+	if authData.flags&flagAttestedData == 0 {
+		return authData, nil
+	}
+
+	rest := data[authDataMinLen:]
+	if len(rest) < aaguidSize+2 {
+		return nil, fmt.Errorf("%w: attested credential data is too short", ErrInvalidResponse)
+	}
+
+	authData.aaguid = rest[:aaguidSize]
+	idLen := int(binary.BigEndian.Uint16(rest[aaguidSize : aaguidSize+2]))
+	rest = rest[aaguidSize+2:]
+	if len(rest) < idLen {
+		return nil, fmt.Errorf("%w: credential id is too short", ErrInvalidResponse)
+	}
+
+	authData.credentialID = rest[:idLen]
+	rest = rest[idLen:]
+
+	// За ключом могут следовать расширения, поэтому читается только первый объект CBOR
+	var key cbor.RawMessage
+	if _, err := cbor.UnmarshalFirst(rest, &key); err != nil {
+		return nil, fmt.Errorf("%w: malformed credential public key", ErrInvalidResponse)
+	}
+	authData.publicKey = key
+
+	return authData, nil
+}
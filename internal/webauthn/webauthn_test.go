@@ -0,0 +1,188 @@
+package webauthn_test
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/Slintox/user-service/internal/webauthn"
+	"github.com/Slintox/user-service/internal/webauthn/webauthntest"
+)
+
+const (
+	rpID   = "example.com"
+	origin = "https://example.com"
+)
+
+func newRelyingParty() *webauthn.RelyingParty {
+	return &webauthn.RelyingParty{
+		ID:                      rpID,
+		Name:                    "Example",
+		Origins:                 []string{origin},
+		RequireUserVerification: true,
+		Timeout:                 time.Minute,
+	}
+}
+
+func newChallenge(t *testing.T) []byte {
+	t.Helper()
+
+	challenge, err := webauthn.NewChallenge()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return challenge
+}
+
+// register регистрирует ключ аутентификатора и возвращает его
+func register(t *testing.T, rp *webauthn.RelyingParty, authenticator *webauthntest.Authenticator) *webauthn.Credential {
+	t.Helper()
+
+	challenge := newChallenge(t)
+	clientDataJSON, attestationObject, err := authenticator.Register(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential, err := rp.VerifyRegistration(challenge, clientDataJSON, attestationObject)
+	if err != nil {
+		t.Fatalf("VerifyRegistration: %v", err)
+	}
+
+	return credential
+}
+
+func TestRegistrationThenAssertion(t *testing.T) {
+	rp := newRelyingParty()
+	authenticator, err := webauthntest.New(rpID, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	credential := register(t, rp, authenticator)
+	if !bytes.Equal(credential.ID, authenticator.CredentialID()) {
+		t.Fatalf("credential id = %x, want %x", credential.ID, authenticator.CredentialID())
+	}
+
+	for i := 1; i <= 3; i++ {
+		challenge := newChallenge(t)
+		clientDataJSON, authData, signature, err := authenticator.Assert(challenge)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signCount, err := rp.VerifyAssertion(challenge, credential, clientDataJSON, authData, signature)
+		if err != nil {
+			t.Fatalf("assertion %d: %v", i, err)
+		}
+		if signCount != uint32(i) {
+			t.Fatalf("assertion %d: sign count = %d", i, signCount)
+		}
+		credential.SignCount = signCount
+	}
+}
+
+func TestAssertionRejectsOtherChallenge(t *testing.T) {
+	rp := newRelyingParty()
+	authenticator, err := webauthntest.New(rpID, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential := register(t, rp, authenticator)
+
+	clientDataJSON, authData, signature, err := authenticator.Assert(newChallenge(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = rp.VerifyAssertion(newChallenge(t), credential, clientDataJSON, authData, signature)
+	if !errors.Is(err, webauthn.ErrInvalidResponse) {
+		t.Fatalf("err = %v, want ErrInvalidResponse", err)
+	}
+}
+
+func TestRejectsWrongOriginOrRPID(t *testing.T) {
+	tests := []struct {
+		name   string
+		rpID   string
+		origin string
+	}{
+		{name: "origin", rpID: rpID, origin: "https://evil.example"},
+		{name: "rp id", rpID: "evil.example", origin: origin},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rp := newRelyingParty()
+			authenticator, err := webauthntest.New(rpID, origin)
+			if err != nil {
+				t.Fatal(err)
+			}
+			credential := register(t, rp, authenticator)
+
+			authenticator.RPID = tt.rpID
+			authenticator.Origin = tt.origin
+
+			challenge := newChallenge(t)
+			clientDataJSON, attestationObject, err := authenticator.Register(challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = rp.VerifyRegistration(challenge, clientDataJSON, attestationObject); !errors.Is(err, webauthn.ErrInvalidResponse) {
+				t.Fatalf("registration err = %v, want ErrInvalidResponse", err)
+			}
+
+			challenge = newChallenge(t)
+			clientDataJSON, authData, signature, err := authenticator.Assert(challenge)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err = rp.VerifyAssertion(challenge, credential, clientDataJSON, authData, signature); !errors.Is(err, webauthn.ErrInvalidResponse) {
+				t.Fatalf("assertion err = %v, want ErrInvalidResponse", err)
+			}
+		})
+	}
+}
+
+func TestRejectsUnverifiedUser(t *testing.T) {
+	rp := newRelyingParty()
+	authenticator, err := webauthntest.New(rpID, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	authenticator.UserVerified = false
+
+	challenge := newChallenge(t)
+	clientDataJSON, attestationObject, err := authenticator.Register(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err = rp.VerifyRegistration(challenge, clientDataJSON, attestationObject); !errors.Is(err, webauthn.ErrInvalidResponse) {
+		t.Fatalf("err = %v, want ErrInvalidResponse", err)
+	}
+}
+
+func TestSignCountRegression(t *testing.T) {
+	rp := newRelyingParty()
+	authenticator, err := webauthntest.New(rpID, origin)
+	if err != nil {
+		t.Fatal(err)
+	}
+	credential := register(t, rp, authenticator)
+
+	// Сервер уже видел подпись с большим счётчиком: ключ мог быть скопирован
+	credential.SignCount = 10
+	authenticator.SignCount = 4
+
+	challenge := newChallenge(t)
+	clientDataJSON, authData, signature, err := authenticator.Assert(challenge)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = rp.VerifyAssertion(challenge, credential, clientDataJSON, authData, signature); !errors.Is(err, webauthn.ErrSignCount) {
+		t.Fatalf("err = %v, want ErrSignCount", err)
+	}
+}
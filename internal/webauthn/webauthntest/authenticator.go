@@ -0,0 +1,142 @@
+// Package webauthntest содержит программный аутентификатор для проверки
+// церемоний WebAuthn без браузера и ключа безопасности
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+
+	"github.com/fxamacker/cbor/v2"
+
+	"github.com/Slintox/user-service/internal/webauthn"
+)
+
+const (
+	flagUserPresent  = 0x01
+	flagUserVerified = 0x04
+	flagAttestedData = 0x40
+
+	credentialIDSize = 16
+)
+
+// Authenticator хранит один ключ ES256 и подписывает ответы для сайта RPID,
+// открытого на странице Origin. Поля можно менять, чтобы получить некорректные ответы
+type Authenticator struct {
+	RPID         string
+	Origin       string
+	AAGUID       [16]byte
+	SignCount    uint32
+	UserVerified bool
+
+	credentialID []byte
+	key          *ecdsa.PrivateKey
+}
+
+// New создаёт аутентификатор с новым ключом
+func New(rpID, origin string) (*Authenticator, error) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	credentialID := make([]byte, credentialIDSize)
+	if _, err = rand.Read(credentialID); err != nil {
+		return nil, err
+	}
+
+	return &Authenticator{
+		RPID:         rpID,
+		Origin:       origin,
+		UserVerified: true,
+		credentialID: credentialID,
+		key:          key,
+	}, nil
+}
+
+func (a *Authenticator) CredentialID() []byte {
+	return a.credentialID
+}
+
+// Register возвращает clientDataJSON и attestationObject с аттестацией "none"
+func (a *Authenticator) Register(challenge []byte) ([]byte, []byte, error) {
+	clientDataJSON, err := a.clientData(webauthn.TypeCreate, challenge)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	publicKey, err := cbor.Marshal(map[int]interface{}{
+		1:  2,  // kty: EC2
+		3:  -7, // alg: ES256
+		-1: 1,  // crv: P-256
+		-2: a.key.X.FillBytes(make([]byte, 32)),
+		-3: a.key.Y.FillBytes(make([]byte, 32)),
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	authData := a.authenticatorData(flagAttestedData)
+	authData = append(authData, a.AAGUID[:]...)
+	authData = binary.BigEndian.AppendUint16(authData, uint16(len(a.credentialID)))
+	authData = append(authData, a.credentialID...)
+	authData = append(authData, publicKey...)
+
+	attestationObject, err := cbor.Marshal(map[string]interface{}{
+		"fmt":      "none",
+		"attStmt":  map[string]interface{}{},
+		"authData": authData,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return clientDataJSON, attestationObject, nil
+}
+
+// Assert увеличивает счётчик подписей и возвращает clientDataJSON,
+// authenticatorData и подпись для navigator.credentials.get
+func (a *Authenticator) Assert(challenge []byte) ([]byte, []byte, []byte, error) {
+	clientDataJSON, err := a.clientData(webauthn.TypeGet, challenge)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	a.SignCount++
+	authData := a.authenticatorData(0)
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte{}, authData...), clientDataHash[:]...))
+
+	signature, err := ecdsa.SignASN1(rand.Reader, a.key, digest[:])
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	return clientDataJSON, authData, signature, nil
+}
+
+func (a *Authenticator) clientData(ceremony string, challenge []byte) ([]byte, error) {
+	return json.Marshal(&webauthn.CollectedClientData{
+		Type:      ceremony,
+		Challenge: base64.RawURLEncoding.EncodeToString(challenge),
+		Origin:    a.Origin,
+	})
+}
+
+func (a *Authenticator) authenticatorData(flags byte) []byte {
+	flags |= flagUserPresent
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(a.RPID))
+
+	authData := append([]byte{}, rpIDHash[:]...)
+	authData = append(authData, flags)
+	return binary.BigEndian.AppendUint32(authData, a.SignCount)
+}
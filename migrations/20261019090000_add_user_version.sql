@@ -0,0 +1,9 @@
+-- +goose Up
+
+alter table "user"
+    add column version bigint not null default 1;
+
+-- +goose Down
+
+alter table "user"
+    drop column if exists version;
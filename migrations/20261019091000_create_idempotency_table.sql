@@ -0,0 +1,18 @@
+-- +goose Up
+
+create table idempotency
+(
+    key          text      not null,
+    method       text      not null,
+    request_hash text      not null,
+    response     bytea,
+    created_at   timestamp not null default now(),
+    expires_at   timestamp not null,
+    primary key (key, method)
+);
+
+create index idempotency_expires_at_idx on idempotency (expires_at);
+
+-- +goose Down
+
+drop table if exists idempotency;
@@ -0,0 +1,23 @@
+-- +goose Up
+
+alter table "user"
+    add column username_canonical text;
+
+-- Приближение NFKC + case folding средствами Postgres. lower расходится с case folding
+-- для части символов, поэтому после миграций формы пересчитывает cmd/canonicalize-usernames
+-- той же функцией normalize.Username, что и сервис.
+-- Миграция завершится ошибкой, если существующие имена совпадают после нормализации
+update "user"
+set username_canonical = lower(normalize(username, NFKC));
+
+alter table "user"
+    alter column username_canonical set not null;
+
+create unique index user_username_canonical_idx on "user" (username_canonical);
+
+-- +goose Down
+
+drop index if exists user_username_canonical_idx;
+
+alter table "user"
+    drop column if exists username_canonical;
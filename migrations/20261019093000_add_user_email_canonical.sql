@@ -0,0 +1,20 @@
+-- +goose Up
+
+alter table "user"
+    add column email_canonical text;
+
+-- Миграция завершится ошибкой, если в таблице уже есть совпадающие адреса
+update "user"
+set email_canonical = lower(trim(email));
+
+alter table "user"
+    alter column email_canonical set not null;
+
+create unique index user_email_canonical_idx on "user" (email_canonical);
+
+-- +goose Down
+
+drop index if exists user_email_canonical_idx;
+
+alter table "user"
+    drop column if exists email_canonical;
@@ -0,0 +1,12 @@
+-- +goose Up
+
+create extension if not exists pgcrypto;
+
+-- Хеши bcrypt из pgcrypto совместимы с golang.org/x/crypto/bcrypt
+update "user"
+set password = crypt(password, gen_salt('bf', 10))
+where password not like '$2_$%';
+
+-- +goose Down
+
+-- Исходные пароли восстановить невозможно, хеши остаются как есть
@@ -0,0 +1,15 @@
+-- +goose Up
+
+create table password_history
+(
+    id            bigserial primary key,
+    username      text      not null references "user" (username) on update cascade on delete cascade,
+    password_hash text      not null,
+    created_at    timestamp not null default now()
+);
+
+create index password_history_username_idx on password_history (username, id desc);
+
+-- +goose Down
+
+drop table if exists password_history;
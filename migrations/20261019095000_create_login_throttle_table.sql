@@ -0,0 +1,14 @@
+-- +goose Up
+
+-- subject имеет вид "user:<каноническое имя>" или "ip:<адрес>"
+create table login_throttle
+(
+    subject         text primary key,
+    failures        integer   not null default 0,
+    last_failure_at timestamp not null default now(),
+    blocked_until   timestamp
+);
+
+-- +goose Down
+
+drop table if exists login_throttle;
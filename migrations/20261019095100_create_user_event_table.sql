@@ -0,0 +1,16 @@
+-- +goose Up
+
+create table user_event
+(
+    id         bigserial primary key,
+    type       text      not null,
+    subject    text      not null,
+    payload    jsonb     not null default '{}',
+    created_at timestamp not null default now()
+);
+
+create index user_event_subject_idx on user_event (subject, id);
+
+-- +goose Down
+
+drop table if exists user_event;
@@ -0,0 +1,17 @@
+-- +goose Up
+
+create table session
+(
+    id         bigserial primary key,
+    username   text      not null references "user" (username) on update cascade on delete cascade,
+    token_hash text      not null unique,
+    created_at timestamp not null default now(),
+    expires_at timestamp not null,
+    revoked_at timestamp
+);
+
+create index session_username_idx on session (username);
+
+-- +goose Down
+
+drop table if exists session;
@@ -0,0 +1,17 @@
+-- +goose Up
+
+create table password_reset_token
+(
+    id         bigserial primary key,
+    username   text      not null references "user" (username) on update cascade on delete cascade,
+    token_hash text      not null unique,
+    created_at timestamp not null default now(),
+    expires_at timestamp not null,
+    used_at    timestamp
+);
+
+create index password_reset_token_username_idx on password_reset_token (username);
+
+-- +goose Down
+
+drop table if exists password_reset_token;
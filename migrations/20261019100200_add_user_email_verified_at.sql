@@ -0,0 +1,9 @@
+-- +goose Up
+
+alter table "user"
+    add column email_verified_at timestamp;
+
+-- +goose Down
+
+alter table "user"
+    drop column if exists email_verified_at;
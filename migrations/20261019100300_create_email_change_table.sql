@@ -0,0 +1,19 @@
+-- +goose Up
+
+create table email_change
+(
+    id           bigserial primary key,
+    username     text      not null references "user" (username) on update cascade on delete cascade,
+    old_email    text      not null,
+    new_email    text      not null,
+    created_at   timestamp not null default now(),
+    expires_at   timestamp not null,
+    confirmed_at timestamp,
+    cancelled_at timestamp
+);
+
+create index email_change_username_idx on email_change (username);
+
+-- +goose Down
+
+drop table if exists email_change;
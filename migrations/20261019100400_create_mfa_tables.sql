@@ -0,0 +1,39 @@
+-- +goose Up
+
+create table user_mfa
+(
+    username       text      primary key references "user" (username) on update cascade on delete cascade,
+    secret         text      not null,
+    created_at     timestamp not null default now(),
+    confirmed_at   timestamp,
+    -- Последний принятый шаг TOTP, коды этого и предыдущих шагов не принимаются
+    last_used_step bigint    not null default 0
+);
+
+create table mfa_recovery_code
+(
+    id        bigserial primary key,
+    username  text not null references "user" (username) on update cascade on delete cascade,
+    code_hash text not null,
+    used_at   timestamp
+);
+
+create index mfa_recovery_code_username_idx on mfa_recovery_code (username);
+
+create table mfa_role_policy
+(
+    role     int     primary key references user_role (id) on delete cascade,
+    required boolean not null default false
+);
+
+-- Администраторы обязаны использовать второй фактор
+insert into mfa_role_policy (role, required)
+select id, true
+from user_role
+where name = 'admin';
+
+-- +goose Down
+
+drop table if exists mfa_role_policy;
+drop table if exists mfa_recovery_code;
+drop table if exists user_mfa;
@@ -0,0 +1,39 @@
+-- +goose Up
+
+-- Постоянный непрозрачный идентификатор пользователя для аутентификаторов (user.id в WebAuthn),
+-- не меняется при смене имени
+create table webauthn_user
+(
+    username    text  primary key references "user" (username) on update cascade on delete cascade,
+    user_handle bytea not null unique
+);
+
+create table webauthn_credential
+(
+    id            bigserial primary key,
+    username      text      not null references "user" (username) on update cascade on delete cascade,
+    credential_id bytea     not null unique,
+    name          text      not null default '',
+    public_key    bytea     not null,
+    sign_count    bigint    not null default 0,
+    transports    text[]    not null default '{}',
+    aaguid        bytea,
+    created_at    timestamp not null default now(),
+    last_used_at  timestamp
+);
+
+create index webauthn_credential_username_idx on webauthn_credential (username);
+
+create table webauthn_challenge
+(
+    challenge  bytea     primary key,
+    ceremony   text      not null,
+    username   text references "user" (username) on update cascade on delete cascade,
+    expires_at timestamp not null
+);
+
+-- +goose Down
+
+drop table if exists webauthn_challenge;
+drop table if exists webauthn_credential;
+drop table if exists webauthn_user;
@@ -0,0 +1,22 @@
+-- +goose Up
+
+create table api_key
+(
+    id           bigserial primary key,
+    username     text      not null references "user" (username) on update cascade on delete cascade,
+    name         text      not null default '',
+    -- Начало ключа для отображения в списке, сам ключ не хранится
+    hint         text      not null,
+    key_hash     text      not null unique,
+    scopes       text[]    not null default '{}',
+    created_at   timestamp not null default now(),
+    expires_at   timestamp,
+    last_used_at timestamp,
+    revoked_at   timestamp
+);
+
+create index api_key_username_idx on api_key (username);
+
+-- +goose Down
+
+drop table if exists api_key;
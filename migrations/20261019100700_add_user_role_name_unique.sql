@@ -0,0 +1,16 @@
+-- +goose Up
+
+alter table user_role
+    add constraint user_role_name_key unique (name),
+    -- Встроенные роли используются в коде по id и не переименовываются и не удаляются
+    add column built_in boolean not null default false;
+
+update user_role
+set built_in = true
+where name in ('user', 'admin');
+
+-- +goose Down
+
+alter table user_role
+    drop column built_in,
+    drop constraint user_role_name_key;
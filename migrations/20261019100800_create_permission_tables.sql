@@ -0,0 +1,50 @@
+-- +goose Up
+
+create table permission
+(
+    name        text primary key,
+    description text not null default ''
+);
+
+create table role_permission
+(
+    role       int  not null references user_role (id) on delete cascade,
+    permission text not null references permission (name) on update cascade on delete cascade,
+    primary key (role, permission)
+);
+
+-- Разрешения на методы UserV1. Без разрешения пользователь может вызывать
+-- эти методы только для своей учётной записи, если метод это допускает
+insert into permission (name, description)
+values ('users.read', 'Чтение любых пользователей'),
+       ('users.update', 'Изменение любых пользователей'),
+       ('users.delete', 'Удаление пользователей'),
+       ('users.unlock', 'Снятие блокировки входа'),
+       ('users.change_password', 'Смена пароля любого пользователя с указанием текущего'),
+       ('users.resend_verification', 'Повторная отправка письма для подтверждения email'),
+       ('users.set_password', 'Установка пароля через Update без текущего пароля'),
+       ('password_hash_stats.read', 'Статистика алгоритмов хеширования паролей'),
+       ('mfa.manage', 'Подключение и отключение второго фактора'),
+       ('mfa_policy.read', 'Чтение политики второго фактора'),
+       ('mfa_policy.update', 'Изменение политики второго фактора'),
+       ('webauthn.manage', 'Регистрация и удаление ключей доступа'),
+       ('webauthn.read', 'Просмотр ключей доступа'),
+       ('api_keys.manage', 'Создание и отзыв API-ключей'),
+       ('api_keys.read', 'Просмотр API-ключей'),
+       ('roles.manage', 'Создание, переименование и удаление ролей'),
+       ('roles.read', 'Просмотр ролей'),
+       ('roles.assign', 'Назначение ролей пользователям'),
+       ('permissions.manage', 'Выдача и отзыв разрешений ролей'),
+       ('permissions.read', 'Просмотр и проверка разрешений');
+
+-- Администраторы сохраняют полный доступ
+insert into role_permission (role, permission)
+select user_role.id, permission.name
+from user_role
+         cross join permission
+where user_role.name = 'admin';
+
+-- +goose Down
+
+drop table if exists role_permission;
+drop table if exists permission;
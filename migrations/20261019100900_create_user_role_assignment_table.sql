@@ -0,0 +1,36 @@
+-- +goose Up
+
+-- Назначения ролей пользователям. Роль, назначенная хотя бы одному пользователю, не удаляется
+create table user_role_assignment
+(
+    username   text      not null references "user" (username) on update cascade on delete cascade,
+    role       int       not null references user_role (id),
+    created_at timestamp not null default now(),
+    primary key (username, role)
+);
+
+create index user_role_assignment_role_idx on user_role_assignment (role);
+
+insert into user_role_assignment (username, role)
+select username, role
+from "user";
+
+alter table "user"
+    drop column role;
+
+-- +goose Down
+
+alter table "user"
+    add column role integer references user_role (id);
+
+-- Из нескольких ролей сохраняется встроенная с наибольшими правами
+update "user"
+set role = coalesce((select max(role)
+                     from user_role_assignment
+                     where user_role_assignment.username = "user".username
+                       and role in (1, 2)), 1);
+
+alter table "user"
+    alter column role set not null;
+
+drop table if exists user_role_assignment;
@@ -0,0 +1,23 @@
+-- +goose Up
+
+-- Временные назначения ролей. Назначение действует с valid_from до valid_until,
+-- пустые границы не ограничивают срок
+alter table user_role_assignment
+    add column valid_from  timestamp,
+    add column valid_until timestamp,
+    add column reason      text not null default '',
+    add constraint user_role_assignment_validity_check
+        check (valid_from is null or valid_until is null or valid_until > valid_from);
+
+create index user_role_assignment_valid_until_idx on user_role_assignment (valid_until)
+    where valid_until is not null;
+
+-- +goose Down
+
+drop index if exists user_role_assignment_valid_until_idx;
+
+alter table user_role_assignment
+    drop constraint user_role_assignment_validity_check,
+    drop column reason,
+    drop column valid_until,
+    drop column valid_from;
@@ -0,0 +1,578 @@
+-- +goose Up
+
+-- Организации (арендаторы). Данные пользователей разных организаций разделены,
+-- имена и адреса уникальны в пределах организации.
+-- Справочник ролей и прав общий для всех организаций
+create table organization
+(
+    id         bigserial primary key,
+    name       text      not null unique,
+    created_at timestamp not null default now()
+);
+
+-- Существующие данные переходят в организацию по умолчанию
+insert into organization (id, name)
+values (1, 'default');
+
+select setval('organization_id_seq', 1);
+
+-- Организациями управляют только пользователи организации по умолчанию
+insert into permission (name, description)
+values ('organizations.manage', 'Создание и просмотр организаций');
+
+insert into role_permission (role, permission)
+select id, 'organizations.manage'
+from user_role
+where name = 'admin';
+
+alter table "user"
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table "user"
+    alter column organization_id drop default;
+
+alter table password_history
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table password_history
+    alter column organization_id drop default;
+
+alter table session
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table session
+    alter column organization_id drop default;
+
+alter table password_reset_token
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table password_reset_token
+    alter column organization_id drop default;
+
+alter table email_change
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table email_change
+    alter column organization_id drop default;
+
+alter table user_mfa
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table user_mfa
+    alter column organization_id drop default;
+
+alter table mfa_recovery_code
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table mfa_recovery_code
+    alter column organization_id drop default;
+
+alter table webauthn_user
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table webauthn_user
+    alter column organization_id drop default;
+
+alter table webauthn_credential
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table webauthn_credential
+    alter column organization_id drop default;
+
+alter table webauthn_challenge
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table webauthn_challenge
+    alter column organization_id drop default;
+
+alter table api_key
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table api_key
+    alter column organization_id drop default;
+
+alter table user_role_assignment
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table user_role_assignment
+    alter column organization_id drop default;
+
+alter table login_throttle
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table login_throttle
+    alter column organization_id drop default;
+
+alter table user_event
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table user_event
+    alter column organization_id drop default;
+
+alter table idempotency
+    add column organization_id bigint not null default 1 references organization (id);
+
+alter table idempotency
+    alter column organization_id drop default;
+
+alter table password_history
+    drop constraint password_history_username_fkey;
+
+alter table session
+    drop constraint session_username_fkey;
+
+alter table password_reset_token
+    drop constraint password_reset_token_username_fkey;
+
+alter table email_change
+    drop constraint email_change_username_fkey;
+
+alter table user_mfa
+    drop constraint user_mfa_username_fkey;
+
+alter table mfa_recovery_code
+    drop constraint mfa_recovery_code_username_fkey;
+
+alter table webauthn_user
+    drop constraint webauthn_user_username_fkey;
+
+alter table webauthn_credential
+    drop constraint webauthn_credential_username_fkey;
+
+alter table webauthn_challenge
+    drop constraint webauthn_challenge_username_fkey;
+
+alter table api_key
+    drop constraint api_key_username_fkey;
+
+alter table user_role_assignment
+    drop constraint user_role_assignment_username_fkey;
+
+alter table "user"
+    drop constraint user_pkey,
+    add primary key (organization_id, username);
+
+drop index user_username_canonical_idx;
+create unique index user_username_canonical_idx on "user" (organization_id, username_canonical);
+
+drop index user_email_canonical_idx;
+create unique index user_email_canonical_idx on "user" (organization_id, email_canonical);
+
+alter table password_history
+    add constraint password_history_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table session
+    add constraint session_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table password_reset_token
+    add constraint password_reset_token_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table email_change
+    add constraint email_change_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table user_mfa
+    drop constraint user_mfa_pkey,
+    add primary key (organization_id, username),
+    add constraint user_mfa_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table mfa_recovery_code
+    add constraint mfa_recovery_code_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table webauthn_user
+    drop constraint webauthn_user_pkey,
+    add primary key (organization_id, username),
+    add constraint webauthn_user_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table webauthn_credential
+    add constraint webauthn_credential_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table webauthn_challenge
+    add constraint webauthn_challenge_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table api_key
+    add constraint api_key_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table user_role_assignment
+    drop constraint user_role_assignment_pkey,
+    add primary key (organization_id, username, role),
+    add constraint user_role_assignment_username_fkey foreign key (organization_id, username)
+        references "user" (organization_id, username) on update cascade on delete cascade;
+
+alter table login_throttle
+    drop constraint login_throttle_pkey,
+    add primary key (organization_id, subject);
+
+alter table idempotency
+    drop constraint idempotency_pkey,
+    add primary key (organization_id, key, method);
+
+drop index user_event_subject_idx;
+create index user_event_subject_idx on user_event (organization_id, subject, id);
+
+-- Вторая линия защиты: строки видны только в организации из настройки сеанса
+-- app.organization_id, которую сервис выставляет при выдаче соединения из пула.
+-- force распространяет политики и на владельца таблиц
+
+alter table "user"
+    enable row level security,
+    force row level security;
+
+create policy user_tenant_isolation on "user"
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table password_history
+    enable row level security,
+    force row level security;
+
+create policy password_history_tenant_isolation on password_history
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table session
+    enable row level security,
+    force row level security;
+
+create policy session_tenant_isolation on session
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table password_reset_token
+    enable row level security,
+    force row level security;
+
+create policy password_reset_token_tenant_isolation on password_reset_token
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table email_change
+    enable row level security,
+    force row level security;
+
+create policy email_change_tenant_isolation on email_change
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table user_mfa
+    enable row level security,
+    force row level security;
+
+create policy user_mfa_tenant_isolation on user_mfa
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table mfa_recovery_code
+    enable row level security,
+    force row level security;
+
+create policy mfa_recovery_code_tenant_isolation on mfa_recovery_code
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table webauthn_user
+    enable row level security,
+    force row level security;
+
+create policy webauthn_user_tenant_isolation on webauthn_user
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table webauthn_credential
+    enable row level security,
+    force row level security;
+
+create policy webauthn_credential_tenant_isolation on webauthn_credential
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table webauthn_challenge
+    enable row level security,
+    force row level security;
+
+create policy webauthn_challenge_tenant_isolation on webauthn_challenge
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table api_key
+    enable row level security,
+    force row level security;
+
+create policy api_key_tenant_isolation on api_key
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table user_role_assignment
+    enable row level security,
+    force row level security;
+
+create policy user_role_assignment_tenant_isolation on user_role_assignment
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table login_throttle
+    enable row level security,
+    force row level security;
+
+create policy login_throttle_tenant_isolation on login_throttle
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table user_event
+    enable row level security,
+    force row level security;
+
+create policy user_event_tenant_isolation on user_event
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table idempotency
+    enable row level security,
+    force row level security;
+
+create policy idempotency_tenant_isolation on idempotency
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+-- +goose Down
+
+-- Откат возможен, только если данные есть лишь в организации по умолчанию
+
+drop policy if exists idempotency_tenant_isolation on idempotency;
+
+alter table idempotency
+    no force row level security,
+    disable row level security;
+
+drop policy if exists user_event_tenant_isolation on user_event;
+
+alter table user_event
+    no force row level security,
+    disable row level security;
+
+drop policy if exists login_throttle_tenant_isolation on login_throttle;
+
+alter table login_throttle
+    no force row level security,
+    disable row level security;
+
+drop policy if exists user_role_assignment_tenant_isolation on user_role_assignment;
+
+alter table user_role_assignment
+    no force row level security,
+    disable row level security;
+
+drop policy if exists api_key_tenant_isolation on api_key;
+
+alter table api_key
+    no force row level security,
+    disable row level security;
+
+drop policy if exists webauthn_challenge_tenant_isolation on webauthn_challenge;
+
+alter table webauthn_challenge
+    no force row level security,
+    disable row level security;
+
+drop policy if exists webauthn_credential_tenant_isolation on webauthn_credential;
+
+alter table webauthn_credential
+    no force row level security,
+    disable row level security;
+
+drop policy if exists webauthn_user_tenant_isolation on webauthn_user;
+
+alter table webauthn_user
+    no force row level security,
+    disable row level security;
+
+drop policy if exists mfa_recovery_code_tenant_isolation on mfa_recovery_code;
+
+alter table mfa_recovery_code
+    no force row level security,
+    disable row level security;
+
+drop policy if exists user_mfa_tenant_isolation on user_mfa;
+
+alter table user_mfa
+    no force row level security,
+    disable row level security;
+
+drop policy if exists email_change_tenant_isolation on email_change;
+
+alter table email_change
+    no force row level security,
+    disable row level security;
+
+drop policy if exists password_reset_token_tenant_isolation on password_reset_token;
+
+alter table password_reset_token
+    no force row level security,
+    disable row level security;
+
+drop policy if exists session_tenant_isolation on session;
+
+alter table session
+    no force row level security,
+    disable row level security;
+
+drop policy if exists password_history_tenant_isolation on password_history;
+
+alter table password_history
+    no force row level security,
+    disable row level security;
+
+drop policy if exists user_tenant_isolation on "user";
+
+alter table "user"
+    no force row level security,
+    disable row level security;
+
+drop index user_event_subject_idx;
+create index user_event_subject_idx on user_event (subject, id);
+
+alter table idempotency
+    drop constraint idempotency_pkey,
+    add primary key (key, method);
+
+alter table login_throttle
+    drop constraint login_throttle_pkey,
+    add primary key (subject);
+
+alter table user_role_assignment
+    drop constraint user_role_assignment_username_fkey,
+    drop constraint user_role_assignment_pkey,
+    add primary key (username, role);
+
+alter table api_key
+    drop constraint api_key_username_fkey;
+
+alter table webauthn_challenge
+    drop constraint webauthn_challenge_username_fkey;
+
+alter table webauthn_credential
+    drop constraint webauthn_credential_username_fkey;
+
+alter table webauthn_user
+    drop constraint webauthn_user_username_fkey,
+    drop constraint webauthn_user_pkey,
+    add primary key (username);
+
+alter table mfa_recovery_code
+    drop constraint mfa_recovery_code_username_fkey;
+
+alter table user_mfa
+    drop constraint user_mfa_username_fkey,
+    drop constraint user_mfa_pkey,
+    add primary key (username);
+
+alter table email_change
+    drop constraint email_change_username_fkey;
+
+alter table password_reset_token
+    drop constraint password_reset_token_username_fkey;
+
+alter table session
+    drop constraint session_username_fkey;
+
+alter table password_history
+    drop constraint password_history_username_fkey;
+
+drop index user_email_canonical_idx;
+create unique index user_email_canonical_idx on "user" (email_canonical);
+
+drop index user_username_canonical_idx;
+create unique index user_username_canonical_idx on "user" (username_canonical);
+
+alter table "user"
+    drop constraint user_pkey,
+    add primary key (username);
+
+alter table password_history
+    add constraint password_history_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table session
+    add constraint session_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table password_reset_token
+    add constraint password_reset_token_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table email_change
+    add constraint email_change_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table user_mfa
+    add constraint user_mfa_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table mfa_recovery_code
+    add constraint mfa_recovery_code_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table webauthn_user
+    add constraint webauthn_user_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table webauthn_credential
+    add constraint webauthn_credential_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table webauthn_challenge
+    add constraint webauthn_challenge_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table api_key
+    add constraint api_key_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table user_role_assignment
+    add constraint user_role_assignment_username_fkey foreign key (username)
+        references "user" (username) on update cascade on delete cascade;
+
+alter table idempotency
+    drop column organization_id;
+
+alter table user_event
+    drop column organization_id;
+
+alter table login_throttle
+    drop column organization_id;
+
+alter table user_role_assignment
+    drop column organization_id;
+
+alter table api_key
+    drop column organization_id;
+
+alter table webauthn_challenge
+    drop column organization_id;
+
+alter table webauthn_credential
+    drop column organization_id;
+
+alter table webauthn_user
+    drop column organization_id;
+
+alter table mfa_recovery_code
+    drop column organization_id;
+
+alter table user_mfa
+    drop column organization_id;
+
+alter table email_change
+    drop column organization_id;
+
+alter table password_reset_token
+    drop column organization_id;
+
+alter table session
+    drop column organization_id;
+
+alter table password_history
+    drop column organization_id;
+
+alter table "user"
+    drop column organization_id;
+
+delete
+from permission
+where name = 'organizations.manage';
+
+drop table if exists organization;
\ No newline at end of file
@@ -0,0 +1,106 @@
+-- +goose Up
+
+-- Группы пользователей организации. Группа может входить в другие группы,
+-- её участники наследуют роли всех групп, в которые она входит прямо или косвенно
+create table user_group
+(
+    id              bigserial primary key,
+    organization_id bigint    not null references organization (id),
+    name            text      not null,
+    created_at      timestamp not null default now(),
+    unique (organization_id, name),
+    -- Для составных внешних ключей таблиц участников
+    unique (organization_id, id)
+);
+
+create table group_member_user
+(
+    organization_id bigint    not null,
+    group_id        bigint    not null,
+    username        text      not null,
+    created_at      timestamp not null default now(),
+    primary key (organization_id, group_id, username),
+    foreign key (organization_id, group_id) references user_group (organization_id, id) on delete cascade,
+    foreign key (organization_id, username) references "user" (organization_id, username) on update cascade on delete cascade
+);
+
+create index group_member_user_username_idx on group_member_user (organization_id, username);
+
+-- Вложенные группы. Циклы запрещаются при добавлении, запросы членства
+-- дополнительно устойчивы к ним
+create table group_member_group
+(
+    organization_id bigint    not null,
+    group_id        bigint    not null,
+    member_group_id bigint    not null,
+    created_at      timestamp not null default now(),
+    primary key (organization_id, group_id, member_group_id),
+    foreign key (organization_id, group_id) references user_group (organization_id, id) on delete cascade,
+    foreign key (organization_id, member_group_id) references user_group (organization_id, id) on delete cascade,
+    check (group_id <> member_group_id)
+);
+
+create index group_member_group_member_idx on group_member_group (organization_id, member_group_id);
+
+-- Роли групп. Роль, назначенная хотя бы одной группе, не удаляется
+create table group_role_assignment
+(
+    organization_id bigint    not null,
+    group_id        bigint    not null,
+    role            int       not null references user_role (id),
+    created_at      timestamp not null default now(),
+    primary key (organization_id, group_id, role),
+    foreign key (organization_id, group_id) references user_group (organization_id, id) on delete cascade
+);
+
+create index group_role_assignment_role_idx on group_role_assignment (role);
+
+alter table user_group
+    enable row level security,
+    force row level security;
+
+create policy user_group_tenant_isolation on user_group
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table group_member_user
+    enable row level security,
+    force row level security;
+
+create policy group_member_user_tenant_isolation on group_member_user
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table group_member_group
+    enable row level security,
+    force row level security;
+
+create policy group_member_group_tenant_isolation on group_member_group
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+alter table group_role_assignment
+    enable row level security,
+    force row level security;
+
+create policy group_role_assignment_tenant_isolation on group_role_assignment
+    using (organization_id = nullif(current_setting('app.organization_id', true), '')::bigint);
+
+insert into permission (name, description)
+values ('groups.manage', 'Создание, переименование и удаление групп, управление участниками'),
+       ('groups.read', 'Просмотр групп и их участников');
+
+insert into role_permission (role, permission)
+select user_role.id, permission.name
+from user_role
+         cross join permission
+where user_role.name = 'admin'
+  and permission.name in ('groups.manage', 'groups.read');
+
+-- +goose Down
+
+delete
+from permission
+where name in ('groups.manage', 'groups.read');
+
+drop table if exists group_role_assignment;
+drop table if exists group_member_group;
+drop table if exists group_member_user;
+drop table if exists user_group;
\ No newline at end of file
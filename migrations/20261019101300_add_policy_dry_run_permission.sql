@@ -0,0 +1,17 @@
+-- +goose Up
+
+insert into permission (name, description)
+values ('policies.dry_run', 'Пробная проверка запросов политиками доступа, в том числе черновиками политик');
+
+insert into role_permission (role, permission)
+select user_role.id, permission.name
+from user_role
+         cross join permission
+where user_role.name = 'admin'
+  and permission.name = 'policies.dry_run';
+
+-- +goose Down
+
+delete
+from permission
+where name = 'policies.dry_run';
\ No newline at end of file
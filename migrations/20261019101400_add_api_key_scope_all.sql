@@ -0,0 +1,33 @@
+-- +goose Up
+
+-- Ключ без областей действовал с правами владельца. Теперь это явная область all,
+-- а пустой список областей ничего не разрешает
+alter table api_key
+    alter column scopes set default '{all}';
+
+-- Ключи обновляются во всех организациях, поэтому на время обновления
+-- политики row level security не распространяются на владельца таблицы
+alter table api_key
+    no force row level security;
+
+update api_key
+set scopes = '{all}'
+where scopes = '{}';
+
+alter table api_key
+    force row level security;
+
+-- +goose Down
+
+alter table api_key
+    no force row level security;
+
+update api_key
+set scopes = '{}'
+where scopes = '{all}';
+
+alter table api_key
+    force row level security;
+
+alter table api_key
+    alter column scopes set default '{}';
\ No newline at end of file
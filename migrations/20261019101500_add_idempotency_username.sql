@@ -0,0 +1,30 @@
+-- +goose Up
+
+-- Ключ идемпотентности выбирает клиент, поэтому два пользователя могут прислать
+-- один и тот же ключ. Запись относится к вызывающему, иначе второй получит чужой ответ
+alter table idempotency
+    add column username text not null default '';
+
+alter table idempotency
+    drop constraint idempotency_pkey,
+    add primary key (organization_id, username, key, method);
+
+-- +goose Down
+
+-- Записи разных пользователей с одним ключом не уместятся в прежний первичный ключ.
+-- Это кэш ответов, его можно сбросить во всех организациях, поэтому на время удаления
+-- политики row level security не распространяются на владельца таблицы
+alter table idempotency
+    no force row level security;
+
+delete from idempotency;
+
+alter table idempotency
+    force row level security;
+
+alter table idempotency
+    drop constraint idempotency_pkey,
+    add primary key (organization_id, key, method);
+
+alter table idempotency
+    drop column username;
\ No newline at end of file
@@ -0,0 +1,11 @@
+-- +goose Up
+
+-- Сессия пользователя, которому роль предписывает второй фактор, пока он не подключён,
+-- позволяет только подключить его
+alter table session
+    add column mfa_enrollment_required boolean not null default false;
+
+-- +goose Down
+
+alter table session
+    drop column mfa_enrollment_required;
\ No newline at end of file
@@ -0,0 +1,47 @@
+-- +goose Up
+
+-- Роль сервиса без прав суперпользователя и без bypassrls: для неё действуют
+-- политики row level security. Роль с входом создаётся отдельно
+-- (postgres/init/01_create_app_user.sh) и включается в user_service_app.
+-- Миграции выполняет владелец таблиц, права на новые таблицы выдаются автоматически
+
+-- +goose StatementBegin
+do
+$$
+    begin
+        if not exists(select from pg_roles where rolname = 'user_service_app') then
+            create role user_service_app nologin nosuperuser nobypassrls;
+        end if;
+    end
+$$;
+-- +goose StatementEnd
+
+grant usage on schema public to user_service_app;
+
+grant select, insert, update, delete on all tables in schema public to user_service_app;
+
+grant usage, select on all sequences in schema public to user_service_app;
+
+revoke all on goose_db_version from user_service_app;
+
+alter default privileges in schema public
+    grant select, insert, update, delete on tables to user_service_app;
+
+alter default privileges in schema public
+    grant usage, select on sequences to user_service_app;
+
+-- +goose Down
+
+-- Роль общая для всего кластера и может использоваться в других базах, поэтому не удаляется
+
+alter default privileges in schema public
+    revoke usage, select on sequences from user_service_app;
+
+alter default privileges in schema public
+    revoke select, insert, update, delete on tables from user_service_app;
+
+revoke all on all sequences in schema public from user_service_app;
+
+revoke all on all tables in schema public from user_service_app;
+
+revoke usage on schema public from user_service_app;
\ No newline at end of file
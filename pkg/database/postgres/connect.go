@@ -5,14 +5,18 @@ import (
 	"fmt"
 
 	"github.com/Slintox/user-service/config"
+	"github.com/jackc/pgx/v4"
 	"github.com/jackc/pgx/v4/pgxpool"
 )
 
-func Connect(ctx context.Context, cfg *config.PostgresConfig) (*pgxpool.Pool, error) {
+// Connect создаёт пул соединений. beforeAcquire, если задан, вызывается с контекстом
+// запроса при каждой выдаче соединения из пула
+func Connect(ctx context.Context, cfg *config.PostgresConfig, beforeAcquire func(context.Context, *pgx.Conn) bool) (*pgxpool.Pool, error) {
 	pgCfg, err := pgxpool.ParseConfig(cfg.DSN)
 	if err != nil {
 		return nil, fmt.Errorf("failed to parse config: %w", err)
 	}
+	pgCfg.BeforeAcquire = beforeAcquire
 
 	pgPool, err := pgxpool.ConnectConfig(ctx, pgCfg)
 	if err != nil {
@@ -0,0 +1,13 @@
+#!/bin/sh
+# Создаёт роль, под которой работает сервис. Она не суперпользователь и не обходит
+# row level security, поэтому строки чужих организаций ей не видны.
+# Права на таблицы роль получает через user_service_app из миграций
+set -e
+
+psql -v ON_ERROR_STOP=1 --username "$POSTGRES_USER" --dbname "$POSTGRES_DB" \
+  -v app_user="$PG_APP_USER" -v app_password="$PG_APP_PASSWORD" <<-'EOSQL'
+	select 'create role user_service_app nologin nosuperuser nobypassrls'
+	where not exists(select from pg_roles where rolname = 'user_service_app')\gexec
+
+	create role :"app_user" login nosuperuser nobypassrls password :'app_password' in role user_service_app;
+EOSQL